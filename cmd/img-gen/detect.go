@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/invisible"
+)
+
+// runDetect implements `img-gen detect <image>`, which extracts an invisible watermark
+// It exits with status 1 when no watermark is found
+func runDetect(args []string) {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Output result in JSON format")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: img-gen detect [--json] <image>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		handleError("Failed to read image", err, *jsonPtr)
+	}
+
+	result, err := invisible.Detect(data)
+	if err != nil && !errors.Is(err, invisible.ErrNotFound) {
+		handleError("Failed to detect invisible watermark", err, *jsonPtr)
+	}
+
+	if *jsonPtr {
+		output := map[string]interface{}{
+			"status": "success",
+			"path":   path,
+			"found":  result != nil,
+		}
+		if result != nil {
+			output["payload"] = result.Payload
+			output["confidence"] = result.Confidence
+		}
+		jsonOut, _ := json.Marshal(output)
+		fmt.Println(string(jsonOut))
+	} else if result != nil {
+		fmt.Printf("Invisible watermark found: %q (confidence %.0f%%)\n", result.Payload, result.Confidence*100)
+	} else {
+		fmt.Println("No invisible watermark found")
+	}
+
+	if result == nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Parthipan-Natkunam/generate_image/internal/config"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/providers/nanobanana"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/watermark"
+)
+
+// dryRun describes what a run would do, after validating its options
+type dryRun struct {
+	Provider           string             `json:"provider"`
+	Model              string             `json:"model,omitempty"`
+	Request            *generator.Request `json:"request"`
+	Output             string             `json:"output,omitempty"` // Exact path from --output, replacing the two below
+	OutputDir          string             `json:"output_dir,omitempty"`
+	FilenameTemplate   string             `json:"filename_template,omitempty"`
+	RestrictTo         string             `json:"restrict_to,omitempty"`
+	Format             string             `json:"format,omitempty"`
+	Renditions         []string           `json:"renditions,omitempty"`
+	WatermarkLayers    []watermark.Config `json:"watermark_layers,omitempty"`
+	InvisibleWatermark string             `json:"invisible_watermark,omitempty"`
+	SignedBy           string             `json:"signed_by,omitempty"`
+	Cache              bool               `json:"cache"`
+	EstimatedCostUSD   *float64           `json:"estimated_cost_usd,omitempty"`
+	Warnings           []string           `json:"warnings,omitempty"` // Problems a real run would fail on, such as missing credentials
+}
+
+// dryRunTokenSource stands in for Vertex AI credentials that could not be
+// loaded, so a dry run can still show the request; dry runs never fetch a token
+type dryRunTokenSource struct {
+	err error
+}
+
+func (s dryRunTokenSource) Token(ctx context.Context) (string, error) {
+	return "", s.err
+}
+
+// dryRunVertexOptions configures Vertex AI without credentials, for a dry run
+// The project falls back to a placeholder, as the key file would name it.
+func dryRunVertexOptions(cfg *config.Config, err error) []nanobanana.ProviderOption {
+	project := cfg.VertexProject
+	if project == "" {
+		project = "PROJECT_ID"
+	}
+	return []nanobanana.ProviderOption{
+		nanobanana.WithVertex(project, cfg.VertexLocation),
+		nanobanana.WithTokenSource(dryRunTokenSource{err}),
+	}
+}
+
+// buildRequest returns the request gen would send for the prompt
+func buildRequest(gen generator.ImageGenerator, prompt string, opts []generator.Option) (*generator.Request, error) {
+	builder, ok := gen.(generator.RequestBuilder)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support dry runs", gen.Name())
+	}
+	return builder.BuildRequest(prompt, opts...)
+}
+
+// printDryRun prints the plan as JSON, or as a readable summary
+func printDryRun(plan *dryRun, jsonMode bool) {
+	if jsonMode {
+		out := struct {
+			Status string `json:"status"`
+			*dryRun
+		}{"dry_run", plan}
+		jsonOut, _ := json.Marshal(out)
+		fmt.Println(string(jsonOut))
+		return
+	}
+
+	fmt.Println("Dry run: no request was sent")
+	fmt.Printf("%-20s %s (%s)\n", "Provider:", plan.Provider, plan.Model)
+	fmt.Printf("%-20s %s %s\n", "Request:", plan.Request.Method, plan.Request.URL)
+
+	names := make([]string, 0, len(plan.Request.Headers))
+	for name := range plan.Request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-20s %s: %s\n", "Header:", name, plan.Request.Headers[name])
+	}
+
+	var body bytes.Buffer
+	if err := json.Indent(&body, plan.Request.Body, "", "  "); err == nil {
+		fmt.Printf("Body:\n%s\n", body.String())
+	}
+
+	fields := []struct{ name, value string }{
+		{"Output", plan.Output},
+		{"Output directory", plan.OutputDir},
+		{"Filename template", plan.FilenameTemplate},
+		{"Restricted to", plan.RestrictTo},
+		{"Format", plan.Format},
+		{"Invisible mark", plan.InvisibleWatermark},
+		{"Signed by", plan.SignedBy},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Printf("%-20s %s\n", field.name+":", field.value)
+		}
+	}
+	for _, name := range plan.Renditions {
+		fmt.Printf("%-20s %s\n", "Rendition:", name)
+	}
+	for i, layer := range plan.WatermarkLayers {
+		description := layer.Text
+		if layer.Image != "" {
+			description = layer.Image
+		}
+		fmt.Printf("%-20s %d: %q at %s\n", "Watermark layer:", i+1, description, layer.Position)
+	}
+	cache := "enabled"
+	if !plan.Cache {
+		cache = "disabled"
+	}
+	fmt.Printf("%-20s %s\n", "Response cache:", cache)
+	if plan.EstimatedCostUSD != nil {
+		fmt.Printf("%-20s %s\n", "Estimated cost:", dollars(*plan.EstimatedCostUSD))
+	}
+	for _, warning := range plan.Warnings {
+		fmt.Printf("%-20s %s\n", "Warning:", warning)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/history"
+)
+
+// currentRun is the history entry of the generation in progress, if history
+// is enabled. handleError records it as failed before exiting.
+var currentRun *historyRun
+
+// historyRun is a generation run waiting to be recorded
+type historyRun struct {
+	store *history.Store
+	entry history.Entry
+}
+
+// startRun begins recording a generation run
+// Flags that do not change the image, such as --json, are left out of the
+// recorded options but kept in the arguments replayed by rerun.
+func startRun(id, prompt string, args []string) {
+	path, err := history.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: generation history disabled: %v\n", err)
+		return
+	}
+
+	options := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "prompt", "json", "no-history":
+			return
+		}
+		options[f.Name] = f.Value.String()
+	})
+
+	// Relative paths in the arguments resolve against the working directory
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: history will not record the working directory: %v\n", err)
+	}
+
+	startedAt := time.Now()
+	currentRun = &historyRun{
+		store: history.Open(path),
+		entry: history.Entry{
+			ID:        id,
+			StartedAt: startedAt.UTC(),
+			Prompt:    prompt,
+			Options:   options,
+			Args:      args,
+			Dir:       dir,
+		},
+	}
+}
+
+// finishRun records the run as successful
+func finishRun(outPath string, renditionPaths []string, data []byte) {
+	if currentRun == nil {
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	entry := &currentRun.entry
+	entry.Status = history.StatusSuccess
+	entry.OutputPath = absPath(outPath)
+	for _, path := range renditionPaths {
+		entry.Renditions = append(entry.Renditions, absPath(path))
+	}
+	entry.SHA256 = hex.EncodeToString(sum[:])
+	recordRun()
+}
+
+// failRun records the run as failed
+func failRun(msg string, err error) {
+	if currentRun == nil {
+		return
+	}
+
+	currentRun.entry.Status = history.StatusError
+	currentRun.entry.Error = fmt.Sprintf("%s: %v", msg, err)
+	recordRun()
+}
+
+// recordRun appends the current run to the history
+// A history that cannot be written does not fail the generation.
+func recordRun() {
+	run := currentRun
+	currentRun = nil // Record once, even if recording itself fails
+
+	run.entry.DurationMS = time.Since(run.entry.StartedAt).Milliseconds()
+	if err := run.store.Append(run.entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record generation history: %v\n", err)
+	}
+}
+
+// absPath returns an absolute path, or path itself if it cannot be resolved
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// runHistory implements `img-gen history list|show|search|rerun`
+func runHistory(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  img-gen history list [--json] [--limit n]       List recent generations, newest first
+  img-gen history show [--json] <id|image>        Show how an image was generated
+  img-gen history search [--json] [--limit n] <query>
+                                                  Find generations by prompt, path or error
+  img-gen history rerun <id|image> [flags...]     Run a generation again without the cache,
+                                                  optionally overriding flags`)
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	path, err := history.DefaultPath()
+	if err != nil {
+		handleError("Failed to open history", err, false)
+	}
+	store := history.Open(path)
+
+	switch args[0] {
+	case "list":
+		runHistoryList(store, args[1:])
+	case "show":
+		runHistoryShow(store, args[1:])
+	case "search":
+		runHistorySearch(store, args[1:])
+	case "rerun":
+		runHistoryRerun(store, args[1:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+// runHistoryList prints the most recent entries
+func runHistoryList(store *history.Store, args []string) {
+	fs := flag.NewFlagSet("history list", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Output result in JSON format")
+	limitPtr := fs.Int("limit", 20, "Maximum number of entries to show (0 for all)")
+	fs.Parse(args)
+
+	entries, err := store.List()
+	if err != nil {
+		handleError("Failed to read history", err, *jsonPtr)
+	}
+	printEntries(entries, *limitPtr, *jsonPtr)
+}
+
+// runHistorySearch prints the most recent entries matching a query
+func runHistorySearch(store *history.Store, args []string) {
+	fs := flag.NewFlagSet("history search", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Output result in JSON format")
+	limitPtr := fs.Int("limit", 20, "Maximum number of entries to show (0 for all)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: img-gen history search [--json] [--limit n] <query>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	entries, err := store.Search(strings.Join(fs.Args(), " "))
+	if err != nil {
+		handleError("Failed to search history", err, *jsonPtr)
+	}
+	printEntries(entries, *limitPtr, *jsonPtr)
+}
+
+// printEntries prints up to limit entries, newest first
+func printEntries(entries []history.Entry, limit int, jsonMode bool) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedAt.After(entries[j].StartedAt) })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	if jsonMode {
+		output := map[string]interface{}{
+			"status":  "success",
+			"entries": entries,
+		}
+		jsonOut, _ := json.Marshal(output)
+		fmt.Println(string(jsonOut))
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No generations found")
+		return
+	}
+	for _, entry := range entries {
+		fmt.Printf("%-25s %s  %-7s  %s\n", entry.ID, entry.StartedAt.Local().Format("2006-01-02 15:04"), entry.Status, truncate(entry.Prompt, 60))
+	}
+}
+
+// runHistoryShow prints every recorded detail of an entry
+func runHistoryShow(store *history.Store, args []string) {
+	fs := flag.NewFlagSet("history show", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Output result in JSON format")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: img-gen history show [--json] <id|image>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	entry, err := store.Find(fs.Arg(0))
+	if err != nil {
+		handleError("Failed to find generation", err, *jsonPtr)
+	}
+
+	if *jsonPtr {
+		output := map[string]interface{}{
+			"status": "success",
+			"entry":  entry,
+		}
+		jsonOut, _ := json.Marshal(output)
+		fmt.Println(string(jsonOut))
+		return
+	}
+
+	fields := []struct{ name, value string }{
+		{"ID", entry.ID},
+		{"Started", entry.StartedAt.Local().Format("2006-01-02 15:04:05 MST")},
+		{"Duration", entry.Duration().String()},
+		{"Status", string(entry.Status)},
+		{"Error", entry.Error},
+		{"Prompt", entry.Prompt},
+		{"Provider", entry.Provider},
+		{"Model", entry.Model},
+		{"Cached", cachedLabel(entry.Cached)},
+		{"Cost", costLabel(entry.CostUSD)},
+		{"Output", entry.OutputPath},
+		{"SHA-256", entry.SHA256},
+		{"Directory", entry.Dir},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Printf("%-20s %s\n", field.name+":", field.value)
+		}
+	}
+	for _, path := range entry.Renditions {
+		fmt.Printf("%-20s %s\n", "Rendition:", path)
+	}
+
+	names := make([]string, 0, len(entry.Options))
+	for name := range entry.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-20s --%s=%s\n", "Option:", name, entry.Options[name])
+	}
+}
+
+// runHistoryRerun runs the recorded command again without the response
+// cache, with any extra flags appended so that they override the recorded ones
+// The command runs in the recorded working directory, so relative paths in
+// the recorded and the extra flags resolve as they did originally.
+func runHistoryRerun(store *history.Store, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: img-gen history rerun <id|image> [flags...]")
+		os.Exit(1)
+	}
+
+	entry, err := store.Find(args[0])
+	if err != nil {
+		handleError("Failed to find generation", err, false)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		handleError("Failed to locate img-gen", err, false)
+	}
+
+	cmd := exec.Command(executable, rerunArgs(entry.Args, args[1:])...)
+	if entry.Dir != "" {
+		if _, err := os.Stat(entry.Dir); err != nil {
+			handleError("Failed to rerun generation", fmt.Errorf("original working directory is gone: %w", err), false)
+		}
+		cmd.Dir = entry.Dir
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		handleError("Failed to rerun generation", err, false)
+	}
+}
+
+// rerunArgs returns the recorded arguments with the overrides appended
+// A recorded --output names an image that now exists, so it is replaced with
+// an --output-dir and --filename-template that save the new image next to it
+// under a free name, unless the overrides choose the output themselves.
+// --no-cache is added so that the run makes a new image rather than returning
+// the cached one; --no-cache=false in the overrides turns the cache back on.
+func rerunArgs(recorded, overrides []string) []string {
+	args, outPath := removeFlag(recorded, "output")
+	if !hasFlag(args, "no-cache") {
+		args = append(args, "--no-cache")
+	}
+	if outPath == "" || hasFlag(overrides, "output") {
+		return append(args, overrides...)
+	}
+
+	ext := filepath.Ext(outPath)
+	if !hasFlag(overrides, "output-dir", "filename-template") {
+		args = append(args, "--output-dir", filepath.Dir(outPath))
+		if stem := strings.TrimSuffix(filepath.Base(outPath), ext); stem != "" && !strings.ContainsAny(stem, "{}") {
+			args = append(args, "--filename-template", stem)
+		}
+	}
+	// The extension chose the format, so keep it
+	if ext != "" && !hasFlag(args, "format") && !hasFlag(overrides, "format") {
+		args = append(args, "--format", strings.TrimPrefix(ext, "."))
+	}
+	return append(args, overrides...)
+}
+
+// removeFlag removes a flag that takes a value from args, returning the
+// remaining arguments and the flag's last value
+func removeFlag(args []string, name string) ([]string, string) {
+	var rest []string
+	var value string
+	for i := 0; i < len(args); i++ {
+		argName, argValue, inline := parseFlagArg(args[i])
+		if argName != name {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !inline && i+1 < len(args) {
+			i++
+			argValue = args[i]
+		}
+		value = argValue
+	}
+	return rest, value
+}
+
+// hasFlag reports whether args set any of the named flags
+func hasFlag(args []string, names ...string) bool {
+	for _, arg := range args {
+		argName, _, _ := parseFlagArg(arg)
+		for _, name := range names {
+			if argName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseFlagArg splits a flag argument such as --output=a.png into its name
+// and inline value; name is empty if arg is not a flag
+func parseFlagArg(arg string) (name, value string, inline bool) {
+	if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+		return "", "", false
+	}
+	return strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// cachedLabel shows whether a run was served from the cache, and nothing otherwise
+func cachedLabel(cached bool) string {
+	if cached {
+		return "yes"
+	}
+	return ""
+}
+
+// costLabel shows the cost of a run, and nothing if it was free or unpriced
+func costLabel(costUSD float64) string {
+	if costUSD == 0 {
+		return ""
+	}
+	return dollars(costUSD)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRerunArgs(t *testing.T) {
+	out := filepath.Join("images", "hero.jpg")
+	tests := []struct {
+		name      string
+		recorded  []string
+		overrides []string
+		want      []string
+	}{
+		{
+			name:     "no output",
+			recorded: []string{"--prompt", "a lake", "--output-dir", "images"},
+			want:     []string{"--prompt", "a lake", "--output-dir", "images", "--no-cache"},
+		},
+		{
+			name:      "overrides come last",
+			recorded:  []string{"--prompt", "a lake", "--format", "png"},
+			overrides: []string{"--format", "webp"},
+			want:      []string{"--prompt", "a lake", "--format", "png", "--no-cache", "--format", "webp"},
+		},
+		{
+			name:     "output saved next to the original",
+			recorded: []string{"--prompt", "a lake", "--output", out},
+			want:     []string{"--prompt", "a lake", "--no-cache", "--output-dir", "images", "--filename-template", "hero", "--format", "jpg"},
+		},
+		{
+			name:     "inline output",
+			recorded: []string{"-output=" + out, "--prompt=a lake"},
+			want:     []string{"--prompt=a lake", "--no-cache", "--output-dir", "images", "--filename-template", "hero", "--format", "jpg"},
+		},
+		{
+			name:     "recorded format kept",
+			recorded: []string{"--output", out, "--format", "webp"},
+			want:     []string{"--format", "webp", "--no-cache", "--output-dir", "images", "--filename-template", "hero"},
+		},
+		{
+			name:      "output overridden",
+			recorded:  []string{"--prompt", "a lake", "--output", out},
+			overrides: []string{"--output", "new.png"},
+			want:      []string{"--prompt", "a lake", "--no-cache", "--output", "new.png"},
+		},
+		{
+			name:      "output directory overridden",
+			recorded:  []string{"--output", out},
+			overrides: []string{"--output-dir", "other"},
+			want:      []string{"--no-cache", "--format", "jpg", "--output-dir", "other"},
+		},
+		{
+			name:     "template placeholders not copied",
+			recorded: []string{"--output", filepath.Join("images", "{id}.png")},
+			want:     []string{"--no-cache", "--output-dir", "images", "--format", "png"},
+		},
+		{
+			name:     "recorded --no-cache not repeated",
+			recorded: []string{"--prompt", "a lake", "--no-cache"},
+			want:     []string{"--prompt", "a lake", "--no-cache"},
+		},
+		{
+			name:      "cache turned back on",
+			recorded:  []string{"--prompt", "a lake"},
+			overrides: []string{"--no-cache=false"},
+			want:      []string{"--prompt", "a lake", "--no-cache", "--no-cache=false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rerunArgs(tt.recorded, tt.overrides); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rerunArgs(%q, %q) =\n%q\nwant\n%q", tt.recorded, tt.overrides, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRerunArgsKeepsRecorded(t *testing.T) {
+	// The recorded arguments are stored in the history entry, so rerunArgs
+	// must not write to their backing array
+	recorded := make([]string, 2, 8)
+	copy(recorded, []string{"--prompt", "a lake"})
+	rerunArgs(recorded, []string{"--format", "webp"})
+	if got := recorded[:cap(recorded)]; got[2] != "" {
+		t.Errorf("rerunArgs wrote %q past the recorded arguments", got[2:])
+	}
+}
+
+func TestParseFlagArg(t *testing.T) {
+	tests := []struct {
+		arg, name, value string
+		inline           bool
+	}{
+		{"--output", "output", "", false},
+		{"-output", "output", "", false},
+		{"--output=a.png", "output", "a.png", true},
+		{"--prompt=a=b", "prompt", "a=b", true},
+		{"a.png", "", "", false},
+		{"-", "", "", false},
+		{"--", "", "", false},
+	}
+	for _, tt := range tests {
+		name, value, inline := parseFlagArg(tt.arg)
+		if name != tt.name || value != tt.value || inline != tt.inline {
+			t.Errorf("parseFlagArg(%q) = %q, %q, %v, want %q, %q, %v", tt.arg, name, value, inline, tt.name, tt.value, tt.inline)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/credentials"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+)
+
+// runInspect implements `img-gen inspect <image>`, which prints the generation
+// metadata and verifies any content credentials. It exits with status 1 when
+// the image carries neither, or when its content credentials fail verification.
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Output result in JSON format")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: img-gen inspect [--json] <image>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		handleError("Failed to read image", err, *jsonPtr)
+	}
+
+	md, err := metadata.Read(data)
+	if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		handleError("Failed to read metadata", err, *jsonPtr)
+	}
+
+	verification, verifyErr := credentials.Verify(data)
+	hasCredentials := !errors.Is(verifyErr, credentials.ErrNoManifest)
+
+	if *jsonPtr {
+		output := map[string]interface{}{
+			"status": "success",
+			"path":   path,
+			"found":  md != nil,
+		}
+		if md != nil {
+			output["metadata"] = md
+		}
+		if hasCredentials {
+			result := map[string]interface{}{"valid": verifyErr == nil}
+			if verification != nil {
+				result["manifest"] = verification
+			}
+			if verifyErr != nil {
+				result["error"] = verifyErr.Error()
+			}
+			output["credentials"] = result
+		}
+		jsonOut, _ := json.Marshal(output)
+		fmt.Println(string(jsonOut))
+	} else {
+		if md != nil {
+			printMetadata(md)
+		} else {
+			fmt.Println("No generation metadata found")
+		}
+		if hasCredentials {
+			printCredentials(verification, verifyErr)
+		}
+	}
+
+	if (md == nil && !hasCredentials) || (hasCredentials && verifyErr != nil) {
+		os.Exit(1)
+	}
+}
+
+// printCredentials prints the result of verifying content credentials
+func printCredentials(v *credentials.Verification, err error) {
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Content credentials: INVALID (%v)\n", err)
+	} else {
+		fmt.Println("Content credentials: valid")
+	}
+	if v == nil {
+		return
+	}
+
+	trust := "untrusted"
+	switch {
+	case v.Trusted:
+		trust = "trusted"
+	case v.SelfSigned:
+		trust = "self-signed, untrusted"
+	}
+	fmt.Printf("%-20s %s (%s)\n", "Signed by:", v.Signer, trust)
+	fmt.Printf("%-20s %s\n", "Signed at:", v.SignedAt.Format("2006-01-02 15:04:05 MST"))
+
+	for _, action := range v.Actions {
+		line := action.Action
+		if action.SoftwareAgent != "" {
+			line += " by " + action.SoftwareAgent
+		}
+		if action.DigitalSourceType == credentials.DigitalSourceTrainedAlgorithmicMedia {
+			line += " [AI-generated]"
+		}
+		if description := action.Parameters["description"]; description != "" {
+			line += ": " + description
+		}
+		fmt.Printf("%-20s %s\n", "Action:", line)
+	}
+}
+
+// printMetadata prints the metadata fields that are set
+func printMetadata(md *metadata.Metadata) {
+	var created string
+	if !md.CreatedAt.IsZero() {
+		created = md.CreatedAt.Format("2006-01-02 15:04:05 MST")
+	}
+
+	fields := []struct{ name, value string }{
+		{"Prompt", md.Prompt},
+		{"Provider", md.Provider},
+		{"Model", md.Model},
+		{"Aspect ratio", md.AspectRatio},
+		{"Image size", md.ImageSize},
+		{"Generation ID", md.GenerationID},
+		{"Created", created},
+		{"Software", md.Software},
+		{"Invisible watermark", md.InvisibleWatermark},
+		{"Watermarks", string(md.Watermarks)},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Printf("%-20s %s\n", field.name+":", field.value)
+		}
+	}
+}
@@ -2,50 +2,315 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"image"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Parthipan-Natkunam/generate_image/internal/config"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/cache"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/convert"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/credentials"
 	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/googleauth"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/invisible"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/output"
 	"github.com/Parthipan-Natkunam/generate_image/pkg/providers/nanobanana"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/rendition"
 	"github.com/Parthipan-Natkunam/generate_image/pkg/schema"
 	"github.com/Parthipan-Natkunam/generate_image/pkg/watermark"
 )
 
 func main() {
+	// Subcommands are dispatched before the generation flags are parsed
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "detect":
+			runDetect(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "spend":
+			runSpend(os.Args[2:])
+			return
+		}
+	}
+
 	promptPtr := flag.String("prompt", "", "Text prompt for image generation")
 	aspectRatioPtr := flag.String("aspect-ratio", "16:9", "Aspect ratio of the image")
-	imageSizePtr := flag.String("image-size", "2K", "Size of the image")
+	imageSizePtr := flag.String("image-size", "", "Size of the image (1K, 2K, 4K; default: the model's default size, 2K for "+nanobanana.DefaultModel+")")
+	modelPtr := flag.String("model", "", "Gemini image model: "+strings.Join(nanobanana.Models(), ", ")+" or another model name (default: $IMG_GEN_MODEL or "+nanobanana.DefaultModel+")")
+	apiVersionPtr := flag.String("api-version", "", "API version used in the endpoint (default: "+nanobanana.DefaultAPIVersion+", or "+nanobanana.DefaultVertexAPIVersion+" on Vertex AI)")
+
+	// Vertex AI flags
+	vertexPtr := flag.Bool("vertex", false, "Call the model through Vertex AI with a service account instead of an API key (default: $GOOGLE_GENAI_USE_VERTEXAI)")
+	vertexCredentialsPtr := flag.String("vertex-credentials", "", "Service account JSON key file for Vertex AI (default: $GOOGLE_APPLICATION_CREDENTIALS)")
+	vertexProjectPtr := flag.String("vertex-project", "", "Google Cloud project for Vertex AI (default: $GOOGLE_CLOUD_PROJECT or the key file's project)")
+	vertexLocationPtr := flag.String("vertex-location", "", "Vertex AI location, e.g. us-central1 (default: $GOOGLE_CLOUD_LOCATION or "+nanobanana.DefaultVertexLocation+")")
 	jsonPtr := flag.Bool("json", false, "Output result in JSON format")
 	describePtr := flag.Bool("describe", false, "Output tool definition JSON")
 	outputDirPtr := flag.String("output-dir", "./generated-images", "Directory to save generated images")
+	filenameTemplatePtr := flag.String("filename-template", output.DefaultTemplate, "File name (without extension) relative to --output-dir, with tokens {date}, {time}, {unix}, {id}, {slug}, {provider}, {model}, {ratio}, {size}, {hash} and {seq}")
+	outputPtr := flag.String("output", "", "Exact path to save the image to; the extension selects the format. Fails if the file exists")
+	restrictToPtr := flag.String("restrict-to", "", "Only write files inside this directory, rejecting '..' and symlink escapes (default: unrestricted)")
+
+	// Output format flags
+	formatPtr := flag.String("format", "", "Output format (png, jpeg, webp). Defaults to the provider's format")
+	qualityPtr := flag.Int("quality", convert.DefaultQuality, "JPEG or WebP quality (1-100; WebP defaults to 80, and 100 is lossless); not supported for PNG")
+	pngCompressionPtr := flag.String("png-compression", "default", "PNG compression level (default, none, fast, best)")
+	renditionsPtr := flag.String("renditions", "", "Comma-separated resized variants to save alongside the image (e.g. thumb=256w,card=800w,hero=1920w)")
 
 	// Watermark flags
+	wmDefaults := watermark.DefaultConfig()
+	watermarkLayersPtr := flag.String("watermark-layers", "", "Path to a JSON or YAML file listing watermark layers to apply in order")
+	var watermarkLayerFlags stringList
+	flag.Var(&watermarkLayerFlags, "watermark-layer", `Watermark layer as a JSON object, applied in order (repeatable), e.g. '{"text":"© Acme","position":"bottom-left"}'`)
 	watermarkTextPtr := flag.String("watermark-text", "", "Text to use as watermark")
 	watermarkImagePtr := flag.String("watermark-image", "", "Path to image file to use as watermark")
-	watermarkPositionPtr := flag.String("watermark-position", "bottom-right", "Watermark position (top-left, top-center, top-right, left-center, center, right-center, bottom-left, bottom-center, bottom-right)")
-	watermarkOpacityPtr := flag.Float64("watermark-opacity", 0.7, "Watermark opacity (0.0-1.0)")
-	watermarkMarginPtr := flag.Int("watermark-margin", 20, "Watermark margin from edge in pixels")
-	watermarkTextSizePtr := flag.Int("watermark-text-size", 24, "Font size for text watermark")
-	watermarkTextColorPtr := flag.String("watermark-text-color", "#FFFFFF", "Text color in hex format (e.g., #FFFFFF)")
-	watermarkScalePtr := flag.Float64("watermark-scale", 0.2, "Scale factor for image watermark (0.1-1.0)")
+	watermarkPositionPtr := flag.String("watermark-position", string(wmDefaults.Position), "Watermark position (top-left, top-center, top-right, left-center, center, right-center, bottom-left, bottom-center, bottom-right, tile, auto) or normalized coordinates (e.g., x=0.9,y=0.1)")
+	watermarkAutoPositionsPtr := flag.String("watermark-auto-positions", "", "Comma-separated candidate positions for auto placement (default: the four corners)")
+	watermarkAutoContrastPtr := flag.Bool("watermark-auto-contrast", false, "Use black or white text, or invert a monochrome logo, to contrast with the image (default true with --watermark-position auto and no --watermark-text-color)")
+	watermarkBlendModePtr := flag.String("watermark-blend-mode", string(wmDefaults.BlendMode), "Blend mode for compositing the watermark (normal, multiply, screen, overlay, soft-light)")
+	watermarkRotationPtr := flag.Float64("watermark-rotation", 0, "Counter-clockwise watermark rotation in degrees (e.g., 90 for a vertical side credit)")
+	watermarkTileSpacingPtr := flag.Int("watermark-tile-spacing", wmDefaults.TileSpacing, "Gap between repeated watermarks in pixels when position is tile")
+	watermarkTileAnglePtr := flag.Float64("watermark-tile-angle", wmDefaults.TileAngle, "Additional counter-clockwise rotation of each watermark in degrees when position is tile")
+	watermarkOpacityPtr := flag.Float64("watermark-opacity", wmDefaults.Opacity, "Watermark opacity (0.0-1.0)")
+	watermarkMarginPtr := flag.Int("watermark-margin", wmDefaults.Margin, "Watermark margin from edge in pixels")
+	watermarkMarginPercentPtr := flag.Float64("watermark-margin-percent", 0, "Watermark margin as a percentage of the image's shorter side (overrides --watermark-margin)")
+	watermarkTextSizePtr := flag.Int("watermark-text-size", wmDefaults.TextSize, "Font size for text watermark")
+	watermarkTextSizePercentPtr := flag.Float64("watermark-text-size-percent", 0, "Font size as a percentage of the image's shorter side (overrides --watermark-text-size)")
+	watermarkTextColorPtr := flag.String("watermark-text-color", wmDefaults.TextColor, "Text color in hex format (e.g., #FFFFFF)")
+	watermarkTextAlignPtr := flag.String("watermark-text-align", string(wmDefaults.TextAlign), "Alignment of multi-line text watermark (left, center, right)")
+	watermarkLineSpacingPtr := flag.Float64("watermark-line-spacing", wmDefaults.TextLineSpacing, "Line height multiplier for multi-line text watermark")
+	watermarkMaxWidthPtr := flag.Float64("watermark-max-width", 0, "Wrap text watermark lines wider than this fraction of image width (0.0-1.0, 0 disables)")
+	watermarkStrokeWidthPtr := flag.Int("watermark-stroke-width", 0, "Outline width in pixels for text watermark (0 disables)")
+	watermarkStrokeColorPtr := flag.String("watermark-stroke-color", wmDefaults.TextStrokeColor, "Outline color in hex format for text watermark")
+	watermarkShadowColorPtr := flag.String("watermark-shadow-color", "", "Drop shadow color in hex format, optionally with alpha (e.g., #00000080). Empty disables")
+	watermarkShadowXPtr := flag.Int("watermark-shadow-x", wmDefaults.TextShadowOffsetX, "Drop shadow horizontal offset in pixels")
+	watermarkShadowYPtr := flag.Int("watermark-shadow-y", wmDefaults.TextShadowOffsetY, "Drop shadow vertical offset in pixels")
+	watermarkShadowBlurPtr := flag.Int("watermark-shadow-blur", wmDefaults.TextShadowBlur, "Drop shadow blur radius in pixels")
+	watermarkBackgroundPtr := flag.String("watermark-background", "", "Background plate color in hex format, optionally with alpha (e.g., #00000099). Empty disables")
+	watermarkBackgroundPaddingPtr := flag.Int("watermark-background-padding", wmDefaults.TextBackgroundPadding, "Background plate padding in pixels")
+	watermarkBackgroundRadiusPtr := flag.Int("watermark-background-radius", wmDefaults.TextBackgroundRadius, "Background plate corner radius in pixels")
+	watermarkFontPtr := flag.String("watermark-font", "", "Path to a TTF/OTF font file for text watermark (default: bundled Go Regular)")
+	watermarkScalePtr := flag.Float64("watermark-scale", wmDefaults.Scale, "Scale factor for image watermark (0.1-1.0)")
+	watermarkResamplePtr := flag.String("watermark-resample", string(wmDefaults.Resample), "Resampling kernel for scaling image watermarks and rotating any watermark (nearest, bilinear, catmull-rom, lanczos)")
+
+	noMetadataPtr := flag.Bool("no-metadata", false, "Do not embed generation metadata (prompt, provider, model, settings) in the image")
+	noHistoryPtr := flag.Bool("no-history", false, "Do not record this generation in the history (see img-gen history)")
+	progressPtr := flag.Bool("progress", false, "Stream the response and report progress: NDJSON events on stdout with --json, lines on stderr otherwise (default: on when stderr is a terminal, without --json)")
+	dryRunPtr := flag.Bool("dry-run", false, "Validate the options and print the provider request (API key redacted) and output plan without calling the API")
+
+	// Response cache flags
+	noCachePtr := flag.Bool("no-cache", false, "Always call the provider, without reading or writing the response cache")
+	cacheTTLPtr := flag.Duration("cache-ttl", cache.DefaultTTL, "How long cached responses are reused (e.g. 24h); 0 keeps them until evicted for space")
+	cacheMaxSizePtr := flag.String("cache-max-size", "500MB", "Maximum size of the response cache (e.g. 500MB, 2GB); 0 is unlimited")
+
+	// Cost tracking flags
+	maxSpendPtr := flag.String("max-spend", "", "Refuse to generate past spending limits in USD, e.g. 5/day,100/month (default: $IMG_GEN_MAX_SPEND)")
+	priceTablePtr := flag.String("price-table", "", "JSON or YAML file of model prices overriding the built-in table (default: $IMG_GEN_PRICE_TABLE)")
+	projectPtr := flag.String("project", "", "Project to record spend under and apply --max-spend to (default: $IMG_GEN_PROJECT)")
+
+	// Content credential flags
+	signCertPtr := flag.String("sign-cert", "", "PEM certificate chain for signing content credentials (default: $IMG_GEN_SIGNING_CERT)")
+	signKeyPtr := flag.String("sign-key", "", "PEM private key for signing content credentials (default: $IMG_GEN_SIGNING_KEY)")
+
+	// Invisible watermark flags
+	invisiblePtr := flag.String("invisible-watermark", "", "Payload to embed as an invisible watermark, up to 32 bytes; {id} is replaced with the generation ID (e.g. acme:{id})")
 
 	flag.Parse()
 
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
 	// Validate watermark flags (mutual exclusivity)
 	if *watermarkTextPtr != "" && *watermarkImagePtr != "" {
 		handleError("Cannot use both --watermark-text and --watermark-image",
-			fmt.Errorf("flags are mutually exclusive"), *jsonPtr)
+			fmt.Errorf("flags are mutually exclusive; use --watermark-layer or --watermark-layers to combine watermarks"), *jsonPtr)
+	}
+
+	// Validate output format options (before image generation)
+	convOpts := convert.Options{
+		PNGCompression: convert.PNGCompression(*pngCompressionPtr),
+	}
+	if setFlags["quality"] {
+		convOpts.Quality = *qualityPtr
+	}
+	if *formatPtr != "" {
+		format, err := convert.ParseFormat(*formatPtr)
+		if err != nil {
+			handleError("Invalid output format", err, *jsonPtr)
+		}
+		convOpts.Format = format
+	}
+	if err := convOpts.Validate(); err != nil {
+		handleError("Invalid output options", err, *jsonPtr)
+	}
+
+	renditionSpecs, err := rendition.ParseSpecs(*renditionsPtr)
+	if err != nil {
+		handleError("Invalid renditions", err, *jsonPtr)
+	}
+
+	// Validate the output file name (before image generation)
+	filenameTemplate, err := output.ParseTemplate(*filenameTemplatePtr)
+	if err != nil {
+		handleError("Invalid filename template", err, *jsonPtr)
+	}
+	var pathFormat convert.Format
+	if *outputPtr != "" {
+		if setFlags["output-dir"] || setFlags["filename-template"] {
+			handleError("Cannot use --output with --output-dir or --filename-template",
+				fmt.Errorf("--output is the exact path of the image"), *jsonPtr)
+		}
+		if ext := filepath.Ext(*outputPtr); ext != "" {
+			if pathFormat, err = convert.ParseFormat(ext); err != nil {
+				handleError("Invalid --output extension", err, *jsonPtr)
+			}
+			if convOpts.Format != "" && convOpts.Format != pathFormat {
+				handleError("Invalid --output extension", fmt.Errorf("%s does not match --format %s", ext, convOpts.Format), *jsonPtr)
+			}
+		}
+		if _, err := os.Lstat(*outputPtr); err == nil {
+			handleError("Invalid --output", fmt.Errorf("%w: %s", output.ErrExists, *outputPtr), *jsonPtr)
+		}
+		if pathOpts := convOpts; pathOpts.Format == "" && pathFormat != "" {
+			pathOpts.Format = pathFormat
+			if err := pathOpts.Validate(); err != nil {
+				handleError("Invalid output options", err, *jsonPtr)
+			}
+		}
+	}
+	// The provider picks the format otherwise, and --quality only applies to
+	// some formats, so catch a mismatch before paying for the generation
+	if setFlags["quality"] && convOpts.Format == "" && pathFormat == "" {
+		handleError("Invalid output options",
+			fmt.Errorf("--quality needs the output format: use --format jpeg or --format webp, or an --output extension"), *jsonPtr)
+	}
+
+	// Confine output to a root directory
+	writer, err := output.NewWriter(*restrictToPtr)
+	if err != nil {
+		handleError("Invalid --restrict-to", err, *jsonPtr)
+	}
+	outputLocation := *outputDirPtr
+	if *outputPtr != "" {
+		outputLocation = *outputPtr
+	}
+	if err := writer.Check(outputLocation); err != nil {
+		handleError("Invalid output location", err, *jsonPtr)
+	}
+
+	cacheMaxSize, err := cache.ParseSize(*cacheMaxSizePtr)
+	if err != nil {
+		handleError("Invalid --cache-max-size", err, *jsonPtr)
+	}
+	if *cacheTTLPtr < 0 {
+		handleError("Invalid --cache-ttl", fmt.Errorf("must not be negative: %s", *cacheTTLPtr), *jsonPtr)
+	}
+
+	// Collect watermark layers: the layer file first, then each --watermark-layer,
+	// then the single watermark described by the --watermark-* flags
+	var wmLayers []watermark.Config
+	if *watermarkLayersPtr != "" {
+		fileLayers, err := watermark.LoadLayers(*watermarkLayersPtr)
+		if err != nil {
+			handleError("Invalid watermark layer file", err, *jsonPtr)
+		}
+		wmLayers = append(wmLayers, fileLayers...)
+	}
+	for _, raw := range watermarkLayerFlags {
+		layer, err := watermark.ParseLayer([]byte(raw))
+		if err != nil {
+			handleError("Invalid --watermark-layer", err, *jsonPtr)
+		}
+		wmLayers = append(wmLayers, layer)
+	}
+	if *watermarkTextPtr != "" || *watermarkImagePtr != "" {
+		// Normalized coordinates replace the anchor position
+		wmPosition, wmPoint, err := watermark.ParsePlacement(*watermarkPositionPtr)
+		if err != nil {
+			handleError("Invalid watermark position", err, *jsonPtr)
+		}
+
+		wmConfig := watermark.Config{
+			// Allow "\n" on the command line to start a new line
+			Text:            strings.ReplaceAll(*watermarkTextPtr, `\n`, "\n"),
+			Image:           *watermarkImagePtr,
+			Position:        wmPosition,
+			Point:           wmPoint,
+			Margin:          *watermarkMarginPtr,
+			AutoContrast:    *watermarkAutoContrastPtr,
+			MarginPercent:   *watermarkMarginPercentPtr,
+			TextSizePercent: *watermarkTextSizePercentPtr,
+			BlendMode:       watermark.BlendMode(*watermarkBlendModePtr),
+			Rotation:        *watermarkRotationPtr,
+			TileSpacing:     *watermarkTileSpacingPtr,
+			TileAngle:       *watermarkTileAnglePtr,
+			Opacity:         *watermarkOpacityPtr,
+			TextSize:        *watermarkTextSizePtr,
+			TextColor:       *watermarkTextColorPtr,
+			Font:            *watermarkFontPtr,
+			TextAlign:       watermark.TextAlign(*watermarkTextAlignPtr),
+			TextLineSpacing: *watermarkLineSpacingPtr,
+			TextMaxWidth:    *watermarkMaxWidthPtr,
+			Scale:           *watermarkScalePtr,
+			Resample:        watermark.Resample(*watermarkResamplePtr),
+
+			TextStrokeWidth:       *watermarkStrokeWidthPtr,
+			TextStrokeColor:       *watermarkStrokeColorPtr,
+			TextShadowColor:       *watermarkShadowColorPtr,
+			TextShadowOffsetX:     *watermarkShadowXPtr,
+			TextShadowOffsetY:     *watermarkShadowYPtr,
+			TextShadowBlur:        *watermarkShadowBlurPtr,
+			TextBackgroundColor:   *watermarkBackgroundPtr,
+			TextBackgroundPadding: *watermarkBackgroundPaddingPtr,
+			TextBackgroundRadius:  *watermarkBackgroundRadiusPtr,
+		}
+		// Auto placement picks a contrasting color too, unless one was given
+		if wmPosition == watermark.PositionAuto && !setFlags["watermark-text-color"] && !setFlags["watermark-auto-contrast"] {
+			wmConfig.AutoContrast = true
+		}
+		for _, pos := range strings.Split(*watermarkAutoPositionsPtr, ",") {
+			if pos = strings.TrimSpace(pos); pos != "" {
+				wmConfig.AutoPositions = append(wmConfig.AutoPositions, watermark.Position(pos))
+			}
+		}
+		wmLayers = append(wmLayers, wmConfig)
 	}
 
-	// Validate watermark image file exists and is valid (before image generation)
-	if err := watermark.ValidateWatermarkImage(*watermarkImagePtr); err != nil {
-		handleError("Invalid watermark image", err, *jsonPtr)
+	// Validate every watermark layer (before image generation)
+	for i, layer := range wmLayers {
+		if err := validateLayer(layer); err != nil {
+			handleError(fmt.Sprintf("Invalid watermark layer %d", i+1), err, *jsonPtr)
+		}
+	}
+
+	// Every run gets an ID, shared by its history entry, metadata, spend
+	// record and invisible watermark
+	id, err := newGenerationID()
+	if err != nil {
+		handleError("Failed to create a generation ID", err, *jsonPtr)
+	}
+
+	// Validate the invisible watermark payload (before image generation)
+	if *invisiblePtr != "" {
+		if err := invisible.ValidatePayload(invisiblePayload(*invisiblePtr, id)); err != nil {
+			handleError("Invalid invisible watermark", err, *jsonPtr)
+		}
 	}
 
 	if *describePtr {
@@ -63,77 +328,457 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Record the run in the generation history, including failures
+	if !*noHistoryPtr && !*dryRunPtr {
+		startRun(id, *promptPtr, os.Args[1:])
+	}
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		handleError("Failed to load configuration", err, *jsonPtr)
 	}
+	if *vertexPtr {
+		cfg.UseVertex = true
+	}
+	if *vertexCredentialsPtr != "" {
+		cfg.VertexCredentials = *vertexCredentialsPtr
+	}
+	if *vertexProjectPtr != "" {
+		cfg.VertexProject = *vertexProjectPtr
+	}
+	if *vertexLocationPtr != "" {
+		cfg.VertexLocation = *vertexLocationPtr
+	}
+	// A dry run sends nothing, so it does not need credentials
+	var dryRunWarnings []string
+	if err := cfg.Validate(); err != nil {
+		if !*dryRunPtr {
+			handleError("Failed to load configuration", err, *jsonPtr)
+		}
+		dryRunWarnings = append(dryRunWarnings, err.Error())
+	}
 
-	// Ensure output directory exists
-	err = os.MkdirAll(*outputDirPtr, 0755)
-	if err != nil {
-		handleError("Failed to create output directory", err, *jsonPtr)
+	// Load the content credential signer (before image generation)
+	var signer *credentials.Signer
+	if *signCertPtr != "" {
+		cfg.SigningCert = *signCertPtr
+	}
+	if *signKeyPtr != "" {
+		cfg.SigningKey = *signKeyPtr
+	}
+	if cfg.SigningCert != "" || cfg.SigningKey != "" {
+		if cfg.SigningCert == "" || cfg.SigningKey == "" {
+			handleError("Invalid signing configuration", fmt.Errorf("both a certificate and a key are required"), *jsonPtr)
+		}
+		signer, err = credentials.LoadSigner(cfg.SigningCert, cfg.SigningKey)
+		if err != nil {
+			handleError("Failed to load signing certificate", err, *jsonPtr)
+		}
 	}
 
 	// Initialize Provider (Defaulting to Nano Banana for now)
-	provider := nanobanana.New(cfg.NanoBananaAPIKey)
+	if *modelPtr != "" {
+		cfg.Model = *modelPtr
+	}
+	providerOpts := []nanobanana.ProviderOption{nanobanana.WithAPIVersion(*apiVersionPtr)}
+	if cfg.Model != "" {
+		providerOpts = append(providerOpts, nanobanana.WithModel(cfg.Model))
+	}
+	if cfg.UseVertex {
+		vertexOpts, err := vertexOptions(cfg)
+		if err != nil {
+			if !*dryRunPtr {
+				handleError("Failed to configure Vertex AI", err, *jsonPtr)
+			}
+			if cfg.VertexCredentials != "" {
+				dryRunWarnings = append(dryRunWarnings, fmt.Sprintf("failed to configure Vertex AI: %v", err))
+			}
+			vertexOpts = dryRunVertexOptions(cfg, err)
+		}
+		providerOpts = append(providerOpts, vertexOpts...)
+	}
+	provider := nanobanana.New(cfg.NanoBananaAPIKey, providerOpts...)
+
+	// Models differ in the sizes they support
+	if *imageSizePtr == "" {
+		if caps, ok := nanobanana.ModelCapabilities(provider.Model()); ok {
+			*imageSizePtr = caps.DefaultSize
+		}
+	}
+	if currentRun != nil {
+		currentRun.entry.Provider = provider.Name()
+		currentRun.entry.Model = provider.Model()
+	}
+
+	// Load prices and spending limits (before image generation)
+	if *priceTablePtr != "" {
+		cfg.PriceTable = *priceTablePtr
+	}
+	if *projectPtr != "" {
+		cfg.Project = *projectPtr
+	}
+	spend, err := newSpendTracker(cfg, *maxSpendPtr)
+	if err != nil {
+		handleError("Invalid cost tracking configuration", err, *jsonPtr)
+	}
 
 	ctx := context.Background()
+	var result generator.Result
 	opts := []generator.Option{
 		generator.WithAspectRatio(*aspectRatioPtr),
 		generator.WithImageSize(*imageSizePtr),
+		generator.WithResult(&result),
+	}
+	progress := newProgressReporter(*progressPtr, setFlags["progress"], *jsonPtr)
+	if progress != nil {
+		opts = append(opts, generator.WithProgress(progress.report))
+	}
+	if err := provider.Validate(opts...); err != nil {
+		handleError("Invalid generation options", err, *jsonPtr)
+	}
+
+	// Show what would be sent and written, without calling the API
+	if *dryRunPtr {
+		if err := spend.check(provider.Model(), *imageSizePtr); err != nil {
+			handleError("Generation failed", err, *jsonPtr)
+		}
+		request, err := buildRequest(provider, *promptPtr, opts)
+		if err != nil {
+			handleError("Dry run failed", err, *jsonPtr)
+		}
+		plan := &dryRun{
+			Provider:        provider.Name(),
+			Model:           provider.Model(),
+			Request:         request,
+			Output:          *outputPtr,
+			RestrictTo:      writer.Root(),
+			Format:          string(convOpts.Format),
+			WatermarkLayers: wmLayers,
+			Cache:           !*noCachePtr,
+
+			InvisibleWatermark: *invisiblePtr,
+			Warnings:           dryRunWarnings,
+		}
+		if estimate, err := spend.prices.Estimate(provider.Model(), *imageSizePtr, nil); err == nil {
+			plan.EstimatedCostUSD = &estimate
+		}
+		if *outputPtr == "" {
+			plan.OutputDir = *outputDirPtr
+			plan.FilenameTemplate = filenameTemplate.String()
+		}
+		if plan.Format == "" {
+			plan.Format = string(pathFormat)
+		}
+		for _, spec := range renditionSpecs {
+			plan.Renditions = append(plan.Renditions, fmt.Sprintf("%s=%d%s", spec.Name, spec.Size, spec.Dimension))
+		}
+		if signer != nil {
+			plan.SignedBy = signer.Certificate().Subject.String()
+		}
+		printDryRun(plan, *jsonPtr)
+		return
+	}
+
+	// Ensure output directory exists
+	if *outputPtr == "" {
+		err = os.MkdirAll(*outputDirPtr, 0755)
+		if err != nil {
+			handleError("Failed to create output directory", err, *jsonPtr)
+		}
+	}
+
+	// Refuse requests past a spending limit, and serve identical requests
+	// from the response cache, which costs nothing
+	var gen generator.ImageGenerator = &budgetGuard{next: provider, id: id, model: provider.Model(), spend: spend}
+	if !*noCachePtr {
+		cacheDir, err := cache.DefaultDir()
+		if err != nil {
+			handleError("Failed to open response cache", err, *jsonPtr)
+		}
+		gen = cache.New(gen, cacheDir, cache.WithTTL(*cacheTTLPtr), cache.WithMaxSize(cacheMaxSize))
 	}
 
 	if *jsonPtr == false {
 		fmt.Printf("Generating image with prompt: %q...\n", *promptPtr)
 	}
 
-	imageData, contentType, err := provider.Generate(ctx, *promptPtr, opts...)
+	imageData, contentType, err := gen.Generate(ctx, *promptPtr, opts...)
 	if err != nil {
 		handleError("Generation failed", err, *jsonPtr)
 	}
+	if result.Cached {
+		progress.stage(stageCached)
+		if currentRun != nil {
+			currentRun.entry.Cached = true
+		}
+		if *jsonPtr == false {
+			fmt.Println("Using cached image (pass --no-cache to generate a new one)")
+		}
+	}
 
-	// Apply watermark if requested
-	finalImageData := imageData
-	if *watermarkTextPtr != "" || *watermarkImagePtr != "" {
-		wmConfig := watermark.Config{
-			Text:      *watermarkTextPtr,
-			Image:     *watermarkImagePtr,
-			Position:  watermark.Position(*watermarkPositionPtr),
-			Margin:    *watermarkMarginPtr,
-			Opacity:   *watermarkOpacityPtr,
-			TextSize:  *watermarkTextSizePtr,
-			TextColor: *watermarkTextColorPtr,
-			Scale:     *watermarkScalePtr,
+	// Record the cost straight away, so it counts even if a later step fails
+	// Cached images cost nothing.
+	createdAt := time.Now()
+	var costUSD float64
+	costKnown := result.Cached
+	if !result.Cached {
+		costUSD, costKnown = spend.record(id, provider.Name(), provider.Model(), *imageSizePtr, result.Usage, createdAt)
+	}
+	if costKnown {
+		if currentRun != nil {
+			currentRun.entry.CostUSD = costUSD
 		}
+		if *jsonPtr == false && !result.Cached {
+			fmt.Printf("Estimated cost: %s\n", dollars(costUSD))
+		}
+	}
+
+	// Record each step for the content credentials
+	history := []credentials.Action{{
+		Action:            credentials.ActionCreated,
+		When:              createdAt.UTC(),
+		SoftwareAgent:     fmt.Sprintf("%s (%s)", provider.Name(), provider.Model()),
+		DigitalSourceType: credentials.DigitalSourceTrainedAlgorithmicMedia,
+	}}
 
-		watermarkedData, err := watermark.Apply(imageData, wmConfig)
+	// Resolve the output format first, so edited pixels are encoded once, in
+	// the output format and quality
+	outputFormat := convert.FormatFromContentType(contentType)
+	if convOpts.Format == "" && pathFormat != "" && pathFormat != outputFormat {
+		convOpts.Format = pathFormat
+	}
+	converting := convOpts.Format != "" || setFlags["quality"] || setFlags["png-compression"]
+
+	// Apply watermark layers if requested
+	finalImageData := imageData
+	var edited image.Image // Watermarked pixels, not yet encoded
+	if len(wmLayers) > 0 || *invisiblePtr != "" {
+		progress.stage(stageWatermark)
+	}
+	if len(wmLayers) > 0 {
+		edited, err = watermark.ApplyLayersImage(imageData, wmLayers)
 		if err != nil {
 			handleError("Failed to apply watermark", err, *jsonPtr)
 		}
-		finalImageData = watermarkedData
+		history = append(history, credentials.Action{
+			Action:        credentials.ActionEdited,
+			SoftwareAgent: metadata.Software,
+			Parameters:    map[string]string{"description": fmt.Sprintf("Added %d visible watermark layer(s)", len(wmLayers))},
+		})
 
 		if *jsonPtr == false {
 			fmt.Println("Watermark applied successfully")
 		}
 	}
 
-	ext := ".png"
-	if contentType == "image/jpeg" {
-		ext = ".jpg"
+	// Embed the invisible watermark on the final pixels; it is verified in
+	// the output encoding
+	var invisibleWatermark string
+	if *invisiblePtr != "" {
+		invisibleWatermark = invisiblePayload(*invisiblePtr, id)
+		if edited == nil {
+			if edited, _, err = convert.Decode(imageData); err != nil {
+				handleError("Failed to embed invisible watermark", err, *jsonPtr)
+			}
+		}
+		markedData, format, err := invisible.EmbedImage(edited, imageData, invisibleWatermark, convOpts)
+		if err != nil {
+			handleError("Failed to embed invisible watermark", err, *jsonPtr)
+		}
+		finalImageData, outputFormat, edited = markedData, format, nil
+		history = append(history, credentials.Action{
+			Action:        credentials.ActionWatermarked,
+			SoftwareAgent: metadata.Software,
+			Parameters:    map[string]string{"description": "Embedded an invisible watermark"},
+		})
+
+		if *jsonPtr == false {
+			fmt.Println("Invisible watermark embedded successfully")
+		}
+	}
+
+	// Encode the watermarked pixels, converting to the requested output
+	// format if needed
+	if converting {
+		progress.stage(stageConverting)
+	}
+	if edited != nil || (converting && *invisiblePtr == "") {
+		var encoded []byte
+		var format convert.Format
+		if edited != nil {
+			encoded, format, err = convert.ConvertImage(edited, imageData, convOpts)
+		} else {
+			encoded, format, err = convert.Convert(imageData, convOpts)
+		}
+		if err != nil {
+			handleError("Failed to convert image", err, *jsonPtr)
+		}
+		finalImageData = encoded
+		outputFormat = format
+	}
+	if converting {
+		history = append(history, credentials.Action{
+			Action:        credentials.ActionTranscoded,
+			SoftwareAgent: metadata.Software,
+			Parameters:    map[string]string{"format": string(outputFormat)},
+		})
+	}
+
+	// Record how the image was generated, unless opted out
+	var imageMetadata *metadata.Metadata
+	if !*noMetadataPtr {
+		imageMetadata = &metadata.Metadata{
+			Prompt:             *promptPtr,
+			Provider:           provider.Name(),
+			Model:              provider.Model(),
+			AspectRatio:        *aspectRatioPtr,
+			ImageSize:          *imageSizePtr,
+			GenerationID:       id,
+			CreatedAt:          createdAt.UTC(),
+			InvisibleWatermark: invisibleWatermark,
+		}
+		if imageMetadata.Watermarks, err = watermarkSettings(wmLayers); err != nil {
+			handleError("Failed to record watermark settings", err, *jsonPtr)
+		}
+
+		finalImageData, err = metadata.Embed(finalImageData, *imageMetadata)
+		if err != nil {
+			handleError("Failed to embed metadata", err, *jsonPtr)
+		}
+	}
+
+	// Pick a free file name; renditions are saved next to the image, so
+	// their names must be free too
+	ext := outputFormat.Extension()
+	if *outputPtr != "" {
+		ext = filepath.Ext(*outputPtr)
+	}
+	var companions []string
+	for _, spec := range renditionSpecs {
+		companions = append(companions, "_"+spec.Name+ext)
 	}
-	filename := fmt.Sprintf("img_%d%s", time.Now().Unix(), ext)
-	outPath := filepath.Join(*outputDirPtr, filename)
 
-	err = os.WriteFile(outPath, finalImageData, 0644)
+	// Sign content credentials last, since they cover the final bytes and
+	// record the file name
+	unsigned := finalImageData
+	render := func(path string) ([]byte, error) {
+		if signer == nil {
+			return unsigned, nil
+		}
+		signed, err := credentials.Sign(unsigned, filepath.Base(path), history, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign content credentials: %w", err)
+		}
+		finalImageData = signed
+		return signed, nil
+	}
+
+	progress.stage(stageSaving)
+	outPath := *outputPtr
+	if outPath != "" {
+		err = writer.SaveExact(outPath, companions, render)
+	} else {
+		outPath, err = writer.Save(*outputDirPtr, filenameTemplate, output.Fields{
+			Time:        createdAt,
+			ID:          id,
+			Prompt:      *promptPtr,
+			Provider:    provider.Name(),
+			Model:       provider.Model(),
+			AspectRatio: *aspectRatioPtr,
+			ImageSize:   *imageSizePtr,
+			Data:        unsigned,
+		}, ext, companions, render)
+	}
 	if err != nil {
 		handleError("Failed to save image", err, *jsonPtr)
 	}
 
+	// Save resized renditions next to the original
+	var renditions []map[string]interface{}
+	var renditionPaths []string
+	if len(renditionSpecs) > 0 {
+		progress.stage(stageRenditions)
+		finalImg, _, err := convert.Decode(finalImageData)
+		if err != nil {
+			handleError("Failed to decode image for renditions", err, *jsonPtr)
+		}
+
+		renditionOpts := convOpts
+		renditionOpts.Format = outputFormat
+		for _, spec := range renditionSpecs {
+			resized := rendition.Render(finalImg, spec)
+			data, err := convert.Encode(resized, renditionOpts)
+			if err != nil {
+				handleError(fmt.Sprintf("Failed to encode rendition %q", spec.Name), err, *jsonPtr)
+			}
+			if data, err = metadata.Preserve(finalImageData, data); err != nil {
+				handleError(fmt.Sprintf("Failed to preserve metadata in rendition %q", spec.Name), err, *jsonPtr)
+			}
+			if imageMetadata != nil {
+				if data, err = metadata.Embed(data, *imageMetadata); err != nil {
+					handleError(fmt.Sprintf("Failed to embed metadata in rendition %q", spec.Name), err, *jsonPtr)
+				}
+			}
+
+			renditionPath := strings.TrimSuffix(outPath, ext) + "_" + spec.Name + ext
+			if signer != nil {
+				resizedHistory := append(history[:len(history):len(history)], credentials.Action{
+					Action:        credentials.ActionResized,
+					SoftwareAgent: metadata.Software,
+					Parameters:    map[string]string{"rendition": spec.Name},
+				})
+				if data, err = credentials.Sign(data, filepath.Base(renditionPath), resizedHistory, signer); err != nil {
+					handleError(fmt.Sprintf("Failed to sign rendition %q", spec.Name), err, *jsonPtr)
+				}
+			}
+			if err := writer.WriteNew(renditionPath, data); err != nil {
+				handleError(fmt.Sprintf("Failed to save rendition %q", spec.Name), err, *jsonPtr)
+			}
+
+			renditionPaths = append(renditionPaths, renditionPath)
+			renditions = append(renditions, map[string]interface{}{
+				"name":   spec.Name,
+				"path":   renditionPath,
+				"width":  resized.Bounds().Dx(),
+				"height": resized.Bounds().Dy(),
+			})
+
+			if *jsonPtr == false {
+				fmt.Printf("Rendition %q saved to: %s\n", spec.Name, renditionPath)
+			}
+		}
+	}
+
+	finishRun(outPath, renditionPaths, finalImageData)
+
 	if *jsonPtr {
-		output := map[string]string{
+		output := map[string]interface{}{
 			"status": "success",
+			"id":     id,
 			"path":   outPath,
 			"prompt": *promptPtr,
+			"format": string(outputFormat),
+		}
+		if result.Cached {
+			output["cached"] = true
+		}
+		if result.Usage != nil {
+			output["usage"] = result.Usage
+		}
+		if costKnown {
+			output["cost_usd"] = costUSD
+			if spend.project != "" {
+				output["project"] = spend.project
+			}
+		}
+		if len(renditions) > 0 {
+			output["renditions"] = renditions
+		}
+		if invisibleWatermark != "" {
+			output["invisible_watermark"] = invisibleWatermark
+		}
+		if signer != nil {
+			output["signed_by"] = signer.Certificate().Subject.String()
 		}
 		jsonOut, _ := json.Marshal(output)
 		fmt.Println(string(jsonOut))
@@ -142,7 +787,92 @@ func main() {
 	}
 }
 
+// vertexOptions configures the provider to call Vertex AI, authenticating as
+// the service account in the configured key file
+func vertexOptions(cfg *config.Config) ([]nanobanana.ProviderOption, error) {
+	account, err := googleauth.LoadServiceAccount(cfg.VertexCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	project := cfg.VertexProject
+	if project == "" {
+		project = account.ProjectID
+	}
+	if project == "" {
+		return nil, fmt.Errorf("no project set (pass --vertex-project or set GOOGLE_CLOUD_PROJECT)")
+	}
+
+	return []nanobanana.ProviderOption{
+		nanobanana.WithVertex(project, cfg.VertexLocation),
+		nanobanana.WithTokenSource(googleauth.NewTokenSource(account, nil)),
+	}, nil
+}
+
+// newGenerationID returns a new generation ID, such as img_mb3k9x2q1c0a_9f86d081
+// The creation time in nanoseconds (base 36, so IDs sort by time) and four
+// random bytes keep IDs unique across parallel runs, while leaving room for a
+// prefix in a 32-byte invisible watermark payload.
+func newGenerationID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("img_%s_%s", strconv.FormatInt(time.Now().UnixNano(), 36), hex.EncodeToString(suffix)), nil
+}
+
+// watermarkSettings returns the watermark layers as JSON for the image metadata
+// Only the base names of watermark images and fonts are kept, so local paths
+// are not published with the image.
+func watermarkSettings(layers []watermark.Config) (json.RawMessage, error) {
+	if len(layers) == 0 {
+		return nil, nil
+	}
+
+	settings := make([]watermark.Config, len(layers))
+	for i, layer := range layers {
+		if layer.Image != "" {
+			layer.Image = filepath.Base(layer.Image)
+		}
+		if layer.Font != "" {
+			layer.Font = filepath.Base(layer.Font)
+		}
+		settings[i] = layer
+	}
+	return json.Marshal(settings)
+}
+
+// invisiblePayload expands the {id} token in an invisible watermark payload
+func invisiblePayload(payload, id string) string {
+	return strings.ReplaceAll(payload, "{id}", id)
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// validateLayer checks a watermark layer and the files it references
+func validateLayer(layer watermark.Config) error {
+	if err := watermark.ValidateWatermarkImage(layer.Image); err != nil {
+		return err
+	}
+	if err := watermark.ValidateFont(layer.Font); err != nil {
+		return err
+	}
+	return layer.Validate()
+}
+
 func handleError(msg string, err error, jsonMode bool) {
+	failRun(msg, err)
+
 	if jsonMode {
 		out := map[string]string{
 			"status": "error",
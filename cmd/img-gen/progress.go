@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// Progress stages of the steps after generation
+const (
+	stageCached     = "cached"
+	stageWatermark  = "watermarking"
+	stageConverting = "converting"
+	stageSaving     = "saving"
+	stageRenditions = "renditions"
+)
+
+// maxProgressText shortens model text in readable progress lines
+const maxProgressText = 80
+
+// progressReporter prints progress as NDJSON events on stdout in JSON mode,
+// and as readable lines on stderr otherwise. A nil reporter reports nothing.
+type progressReporter struct {
+	start    time.Time
+	jsonMode bool
+}
+
+// newProgressReporter returns a reporter, or nil if progress is not shown
+// Progress is shown with --progress, and by default on a terminal outside
+// JSON mode.
+func newProgressReporter(enabled, explicit, jsonMode bool) *progressReporter {
+	if !explicit {
+		info, err := os.Stderr.Stat()
+		enabled = !jsonMode && err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	if !enabled {
+		return nil
+	}
+	return &progressReporter{start: time.Now(), jsonMode: jsonMode}
+}
+
+// report prints one progress event
+func (r *progressReporter) report(event generator.ProgressEvent) {
+	if r == nil {
+		return
+	}
+	elapsed := time.Since(r.start)
+
+	if r.jsonMode {
+		out := struct {
+			Event     string `json:"event"`
+			Stage     string `json:"stage"`
+			ElapsedMS int64  `json:"elapsed_ms"`
+			Text      string `json:"text,omitempty"`
+			Bytes     int    `json:"bytes,omitempty"`
+		}{"progress", event.Stage, elapsed.Milliseconds(), event.Text, event.Bytes}
+		jsonOut, _ := json.Marshal(out)
+		fmt.Println(string(jsonOut))
+		return
+	}
+
+	var message string
+	switch event.Stage {
+	case generator.StageRequestSent:
+		message = "Request sent, waiting for the model"
+	case generator.StageFirstByte:
+		message = "Receiving response"
+	case generator.StageText:
+		message = "Model: " + truncate(event.Text, maxProgressText)
+	case generator.StageImageReceived:
+		message = fmt.Sprintf("Image received (%s)", formatBytes(event.Bytes))
+	case stageCached:
+		message = "Image found in the response cache"
+	case stageWatermark:
+		message = "Applying watermarks"
+	case stageConverting:
+		message = "Converting format"
+	case stageSaving:
+		message = "Saving"
+	case stageRenditions:
+		message = "Saving renditions"
+	default:
+		message = event.Stage
+	}
+	fmt.Fprintf(os.Stderr, "[%5.1fs] %s\n", elapsed.Seconds(), message)
+}
+
+// stage reports a step that has no details
+func (r *progressReporter) stage(stage string) {
+	r.report(generator.ProgressEvent{Stage: stage})
+}
+
+// formatBytes formats a size for people, e.g. 1.5 MB
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/internal/config"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/cost"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// spendTracker prices generations, records them in the spend ledger and
+// enforces spending limits
+type spendTracker struct {
+	prices  cost.Table
+	ledger  *cost.Ledger // nil if the ledger cannot be located
+	budgets []cost.Budget
+	project string
+}
+
+// newSpendTracker loads the price table and spending limits
+// maxSpend, if set, replaces the limits from the environment.
+func newSpendTracker(cfg *config.Config, maxSpend string) (*spendTracker, error) {
+	t := &spendTracker{prices: cost.DefaultTable(), project: cfg.Project}
+
+	if cfg.PriceTable != "" {
+		prices, err := cost.LoadTable(cfg.PriceTable)
+		if err != nil {
+			return nil, err
+		}
+		t.prices = prices
+	}
+
+	if maxSpend == "" {
+		maxSpend = cfg.MaxSpend
+	}
+	budgets, err := cost.ParseBudgets(maxSpend)
+	if err != nil {
+		return nil, err
+	}
+	t.budgets = budgets
+
+	path, err := cost.DefaultLedgerPath()
+	if err != nil {
+		if len(budgets) > 0 {
+			return nil, err // Limits cannot be enforced without the ledger
+		}
+		fmt.Fprintf(os.Stderr, "Warning: spend tracking disabled: %v\n", err)
+		return t, nil
+	}
+	t.ledger = cost.OpenLedger(path)
+	return t, nil
+}
+
+// check refuses a request that would exceed a spending limit, without
+// reserving its cost, for dry runs
+func (t *spendTracker) check(model, size string) error {
+	if len(t.budgets) == 0 {
+		return nil
+	}
+
+	estimate, err := t.prices.Estimate(model, size, nil)
+	if err != nil {
+		return err
+	}
+	records, err := t.ledger.Records()
+	if err != nil {
+		return err
+	}
+	return cost.CheckBudgets(t.budgets, records, t.project, estimate, time.Now())
+}
+
+// reserve holds the estimated cost of a generation in the ledger, so that
+// concurrent runs count it, and refuses the generation if it would exceed a
+// spending limit. The returned function releases the estimate if the
+// generation fails; otherwise record replaces it with the final cost.
+func (t *spendTracker) reserve(id, provider, model, size string) (func(), error) {
+	if len(t.budgets) == 0 {
+		return func() {}, nil
+	}
+
+	estimate, err := t.prices.Estimate(model, size, nil)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record := cost.Record{
+		Time:      now.UTC(),
+		ID:        id,
+		Project:   t.project,
+		Provider:  provider,
+		Model:     model,
+		ImageSize: size,
+		CostUSD:   estimate,
+	}
+	if err := t.ledger.Reserve(t.budgets, record, now); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := t.ledger.Cancel(record); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to release estimated spend: %v\n", err)
+		}
+	}, nil
+}
+
+// record prices a generation and adds it to the ledger
+// A ledger that cannot be written does not fail the generation.
+//
+// Returns:
+//   - the cost in US dollars
+//   - false if the model has no price
+func (t *spendTracker) record(id, provider, model, size string, usage *generator.Usage, at time.Time) (float64, bool) {
+	costUSD, err := t.prices.Estimate(model, size, usage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cost not recorded: %v\n", err)
+		return 0, false
+	}
+
+	if t.ledger != nil {
+		record := cost.Record{
+			Time:      at.UTC(),
+			ID:        id,
+			Project:   t.project,
+			Provider:  provider,
+			Model:     model,
+			ImageSize: size,
+			Usage:     usage,
+			CostUSD:   costUSD,
+		}
+		if err := t.ledger.Append(record); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record spend: %v\n", err)
+		}
+	}
+	return costUSD, true
+}
+
+// budgetGuard is an ImageGenerator decorator that refuses requests past a
+// spending limit. It wraps the provider inside the response cache, so cached
+// images, which cost nothing, are still served.
+type budgetGuard struct {
+	next  generator.ImageGenerator
+	id    string // The generation ID, which the spend record is kept under
+	model string
+	spend *spendTracker
+}
+
+func (g *budgetGuard) Generate(ctx context.Context, prompt string, opts ...generator.Option) ([]byte, string, error) {
+	genOpts := &generator.GenerateOptions{}
+	for _, opt := range opts {
+		opt(genOpts)
+	}
+	release, err := g.spend.reserve(g.id, g.Name(), g.model, genOpts.ImageSize)
+	if err != nil {
+		return nil, "", err
+	}
+	data, contentType, err := g.next.Generate(ctx, prompt, opts...)
+	if err != nil {
+		release()
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+func (g *budgetGuard) Name() string {
+	return g.next.Name()
+}
+
+// Model returns the model the request is priced for
+func (g *budgetGuard) Model() string {
+	return g.model
+}
+
+// Endpoint returns the wrapped provider's endpoint, for the cache key
+func (g *budgetGuard) Endpoint() string {
+	if e, ok := g.next.(interface{ Endpoint() string }); ok {
+		return e.Endpoint()
+	}
+	return ""
+}
+
+// Backend returns the wrapped provider's backend, for the cache key
+func (g *budgetGuard) Backend() string {
+	if b, ok := g.next.(interface{ Backend() string }); ok {
+		return b.Backend()
+	}
+	return ""
+}
+
+// spendTotals is the spend of one project, or of all projects
+type spendTotals struct {
+	Today     float64 `json:"today_usd"`
+	ThisMonth float64 `json:"this_month_usd"`
+	Total     float64 `json:"total_usd"`
+	Images    int     `json:"images"`
+}
+
+// add counts a record in the totals
+func (s *spendTotals) add(record cost.Record, day, month time.Time) {
+	s.Total += record.CostUSD
+	s.Images++
+	if !record.Time.Before(month) {
+		s.ThisMonth += record.CostUSD
+	}
+	if !record.Time.Before(day) {
+		s.Today += record.CostUSD
+	}
+}
+
+// runSpend implements `img-gen spend`
+func runSpend(args []string) {
+	fs := flag.NewFlagSet("spend", flag.ExitOnError)
+	jsonMode := fs.Bool("json", false, "Output result in JSON format")
+	project := fs.String("project", "", "Only report this project's spend")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: img-gen spend [--json] [--project name]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path, err := cost.DefaultLedgerPath()
+	if err != nil {
+		handleError("Failed to open spend ledger", err, *jsonMode)
+	}
+	records, err := cost.OpenLedger(path).Records()
+	if err != nil {
+		handleError("Failed to read spend ledger", err, *jsonMode)
+	}
+	records = cost.Final(records)
+
+	now := time.Now()
+	day := cost.Budget{Period: cost.PeriodDay}.Start(now)
+	month := cost.Budget{Period: cost.PeriodMonth}.Start(now)
+
+	var all spendTotals
+	projects := map[string]*spendTotals{}
+	for _, record := range records {
+		if *project != "" && record.Project != *project {
+			continue
+		}
+		all.add(record, day, month)
+		if projects[record.Project] == nil {
+			projects[record.Project] = &spendTotals{}
+		}
+		projects[record.Project].add(record, day, month)
+	}
+
+	if *jsonMode {
+		out := struct {
+			Status string `json:"status"`
+			spendTotals
+			Projects map[string]*spendTotals `json:"projects"`
+		}{"success", all, projects}
+		jsonOut, _ := json.Marshal(out)
+		fmt.Println(string(jsonOut))
+		return
+	}
+
+	names := make([]string, 0, len(projects))
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%-24s %10s %12s %10s %7s\n", "PROJECT", "TODAY", "THIS MONTH", "TOTAL", "IMAGES")
+	for _, name := range names {
+		label := name
+		if label == "" {
+			label = "(none)"
+		}
+		printTotals(label, projects[name])
+	}
+	if len(names) != 1 {
+		printTotals("all", &all)
+	}
+}
+
+// printTotals prints one row of the spend report
+func printTotals(label string, s *spendTotals) {
+	fmt.Printf("%-24s %10s %12s %10s %7d\n", truncate(label, 24), dollars(s.Today), dollars(s.ThisMonth), dollars(s.Total), s.Images)
+}
+
+// dollars formats an amount in US dollars
+func dollars(amount float64) string {
+	return fmt.Sprintf("$%.2f", amount)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/cost"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// fakeProvider returns a fixed image, or err
+type fakeProvider struct {
+	calls int
+	err   error
+}
+
+func (p *fakeProvider) Generate(ctx context.Context, prompt string, opts ...generator.Option) ([]byte, string, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, "", p.err
+	}
+	return []byte("image"), "image/png", nil
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+const testModel = "gemini-3-pro-image-preview"
+
+// newTestTracker returns a tracker with a $limit daily budget and an empty ledger
+func newTestTracker(t *testing.T, limit float64) *spendTracker {
+	t.Helper()
+	return &spendTracker{
+		prices:  cost.DefaultTable(),
+		ledger:  cost.OpenLedger(filepath.Join(t.TempDir(), "spend.jsonl")),
+		budgets: []cost.Budget{{Limit: limit, Period: cost.PeriodDay}},
+	}
+}
+
+// outstanding returns the spend that counts towards today's budget
+func outstanding(t *testing.T, spend *spendTracker) float64 {
+	t.Helper()
+	records, err := spend.ledger.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	return cost.Spent(cost.Outstanding(records, now), "", cost.Budget{Period: cost.PeriodDay}.Start(now))
+}
+
+func TestBudgetGuard(t *testing.T) {
+	estimate, err := cost.DefaultTable().Estimate(testModel, "1K", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := newTestTracker(t, 1.5*estimate)
+	provider := &fakeProvider{}
+	generate := func(id string) error {
+		guard := &budgetGuard{next: provider, id: id, model: testModel, spend: spend}
+		_, _, err := guard.Generate(context.Background(), "a lake", generator.WithImageSize("1K"))
+		return err
+	}
+
+	// The first request fits, and holds its estimate until it is recorded
+	if err := generate("img_1"); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if got := outstanding(t, spend); got != estimate {
+		t.Errorf("outstanding spend = %v, want the estimate %v", got, estimate)
+	}
+
+	// A second, in flight at the same time, would exceed the limit
+	if err := generate("img_2"); !errors.Is(err, cost.ErrBudgetExceeded) {
+		t.Fatalf("Generate past the limit = %v, want ErrBudgetExceeded", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times, want 1", provider.calls)
+	}
+
+	// Recording the final cost replaces the estimate
+	usage := &generator.Usage{PromptTokens: 10, OutputTokens: 100}
+	costUSD, ok := spend.record("img_1", "fake", testModel, "1K", usage, time.Now())
+	if !ok {
+		t.Fatal("cost not recorded")
+	}
+	if got := outstanding(t, spend); got != costUSD {
+		t.Errorf("outstanding spend = %v, want the recorded cost %v", got, costUSD)
+	}
+}
+
+func TestBudgetGuardReleasesFailedRequest(t *testing.T) {
+	estimate, err := cost.DefaultTable().Estimate(testModel, "1K", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := newTestTracker(t, 1.5*estimate)
+	failing := &budgetGuard{next: &fakeProvider{err: errors.New("quota exceeded")}, id: "img_1", model: testModel, spend: spend}
+	if _, _, err := failing.Generate(context.Background(), "a lake", generator.WithImageSize("1K")); err == nil {
+		t.Fatal("Generate succeeded")
+	}
+	if got := outstanding(t, spend); got != 0 {
+		t.Errorf("outstanding spend after a failure = %v, want 0", got)
+	}
+
+	guard := &budgetGuard{next: &fakeProvider{}, id: "img_2", model: testModel, spend: spend}
+	if _, _, err := guard.Generate(context.Background(), "a lake", generator.WithImageSize("1K")); err != nil {
+		t.Errorf("Generate after a failed request: %v", err)
+	}
+}
+
+func TestBudgetGuardWithoutBudgets(t *testing.T) {
+	spend := &spendTracker{prices: cost.DefaultTable(), ledger: cost.OpenLedger(filepath.Join(t.TempDir(), "spend.jsonl"))}
+	guard := &budgetGuard{next: &fakeProvider{}, id: "img_1", model: "unpriced-model", spend: spend}
+	if _, _, err := guard.Generate(context.Background(), "a lake"); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if records, _ := spend.ledger.Records(); len(records) != 0 {
+		t.Errorf("ledger has %d records without budgets, want 0", len(records))
+	}
+}
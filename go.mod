@@ -3,9 +3,11 @@ module github.com/Parthipan-Natkunam/generate_image
 go 1.25.7
 
 require (
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/srwiley/oksvg v0.0.0-20221011165216-be6e8873101c
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
 	golang.org/x/image v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -3,19 +3,60 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
 )
 
 type Config struct {
 	NanoBananaAPIKey string
+	Model            string // Gemini model overriding the provider's default (optional)
+
+	// Vertex AI, used instead of an API key when UseVertex is set
+	UseVertex         bool
+	VertexCredentials string // Service account JSON key file
+	VertexProject     string // Defaults to the key file's project
+	VertexLocation    string
+
+	// Certificate and key used to sign content credentials (optional)
+	SigningCert string
+	SigningKey  string
+
+	// Cost tracking (optional)
+	PriceTable string // Price table file overriding the built-in prices
+	MaxSpend   string // Spending limits, e.g. "5/day,100/month"
+	Project    string // Project that spend is recorded and limited under
 }
 
+// LoadConfig reads the configuration from the environment
+// Call Validate once command-line overrides have been applied.
 func LoadConfig() (*Config, error) {
-	apiKey := os.Getenv("NANOBANANA_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("NANOBANANA_API_KEY environment variable is not set")
-	}
+	useVertex, _ := strconv.ParseBool(os.Getenv("GOOGLE_GENAI_USE_VERTEXAI"))
 
 	return &Config{
-		NanoBananaAPIKey: apiKey,
+		NanoBananaAPIKey:  os.Getenv("NANOBANANA_API_KEY"),
+		Model:             os.Getenv("IMG_GEN_MODEL"),
+		UseVertex:         useVertex,
+		VertexCredentials: os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		VertexProject:     os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		VertexLocation:    os.Getenv("GOOGLE_CLOUD_LOCATION"),
+		SigningCert:       os.Getenv("IMG_GEN_SIGNING_CERT"),
+		SigningKey:        os.Getenv("IMG_GEN_SIGNING_KEY"),
+		PriceTable:        os.Getenv("IMG_GEN_PRICE_TABLE"),
+		MaxSpend:          os.Getenv("IMG_GEN_MAX_SPEND"),
+		Project:           os.Getenv("IMG_GEN_PROJECT"),
 	}, nil
 }
+
+// Validate checks that the credentials for the selected API are set
+func (c *Config) Validate() error {
+	if c.UseVertex {
+		if c.VertexCredentials == "" {
+			return fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS environment variable is not set (or pass --vertex-credentials)")
+		}
+		return nil
+	}
+
+	if c.NanoBananaAPIKey == "" {
+		return fmt.Errorf("NANOBANANA_API_KEY environment variable is not set")
+	}
+	return nil
+}
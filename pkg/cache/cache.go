@@ -0,0 +1,350 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// DirEnv overrides the location of the cache directory
+const DirEnv = "IMG_GEN_CACHE_DIR"
+
+// Defaults for the cache limits
+const (
+	DefaultTTL     = 7 * 24 * time.Hour
+	DefaultMaxSize = 500 << 20 // 500 MB
+)
+
+// keyVersion is part of every key, so that changing how keys are derived
+// invalidates old entries
+const keyVersion = 1
+
+// File suffixes of an entry's image and its description
+const (
+	dataSuffix = ".img"
+	metaSuffix = ".json"
+)
+
+// ErrInvalidSize is returned by ParseSize for malformed sizes
+var ErrInvalidSize = errors.New("invalid cache size")
+
+// Generator is an ImageGenerator decorator that stores responses on disk,
+// keyed by a hash of the provider, backend, endpoint, model, prompt and
+// options, and answers identical requests from the cache
+type Generator struct {
+	next    generator.ImageGenerator
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	now     func() time.Time
+}
+
+// Option is a functional option for configuring the cache
+type Option func(*Generator)
+
+// WithTTL sets how long entries are served; 0 keeps them until evicted for space
+func WithTTL(ttl time.Duration) Option {
+	return func(g *Generator) {
+		g.ttl = ttl
+	}
+}
+
+// WithMaxSize sets the total size of cached images in bytes; 0 is unlimited
+// The least recently used entries are evicted first.
+func WithMaxSize(size int64) Option {
+	return func(g *Generator) {
+		g.maxSize = size
+	}
+}
+
+// entry describes a cached image
+type entry struct {
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model,omitempty"`
+	Prompt      string    `json:"prompt"`
+}
+
+// DefaultDir returns $IMG_GEN_CACHE_DIR, or img-gen in the user's cache
+// directory (e.g. ~/.cache/img-gen on Linux)
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory (set %s): %w", DirEnv, err)
+	}
+	return filepath.Join(dir, "img-gen"), nil
+}
+
+// New wraps an ImageGenerator with a response cache
+//
+// Parameters:
+//   - next: the generator that serves cache misses
+//   - dir: the cache directory, created on the first store
+//   - opts: optional TTL and size limit
+//
+// Returns:
+//   - the caching generator
+func New(next generator.ImageGenerator, dir string, opts ...Option) *Generator {
+	g := &Generator{
+		next:    next,
+		dir:     dir,
+		ttl:     DefaultTTL,
+		maxSize: DefaultMaxSize,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Name returns the wrapped provider's name
+func (g *Generator) Name() string {
+	return g.next.Name()
+}
+
+// Model returns the wrapped provider's model, if it reports one
+func (g *Generator) Model() string {
+	if m, ok := g.next.(interface{ Model() string }); ok {
+		return m.Model()
+	}
+	return ""
+}
+
+// Endpoint returns the wrapped provider's API endpoint, if it reports one
+func (g *Generator) Endpoint() string {
+	if e, ok := g.next.(interface{ Endpoint() string }); ok {
+		return e.Endpoint()
+	}
+	return ""
+}
+
+// Backend returns the wrapped provider's backend, such as the Gemini API or
+// Vertex AI, if it reports one
+func (g *Generator) Backend() string {
+	if b, ok := g.next.(interface{ Backend() string }); ok {
+		return b.Backend()
+	}
+	return ""
+}
+
+// Generate returns the cached image for an identical earlier request, or
+// generates and caches a new one. Cache failures never fail a request; the
+// provider is used instead.
+func (g *Generator) Generate(ctx context.Context, prompt string, opts ...generator.Option) ([]byte, string, error) {
+	genOpts := &generator.GenerateOptions{}
+	for _, opt := range opts {
+		opt(genOpts)
+	}
+
+	key, err := g.key(prompt, genOpts)
+	if err != nil {
+		return g.next.Generate(ctx, prompt, opts...)
+	}
+
+	if data, contentType, ok := g.load(key); ok {
+		if genOpts.Result != nil {
+			genOpts.Result.Cached = true
+		}
+		return data, contentType, nil
+	}
+
+	data, contentType, err := g.next.Generate(ctx, prompt, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if g.store(key, data, entry{
+		ContentType: contentType,
+		CreatedAt:   g.now().UTC(),
+		Provider:    g.Name(),
+		Model:       g.Model(),
+		Prompt:      prompt,
+	}) == nil {
+		g.evict()
+	}
+	return data, contentType, nil
+}
+
+// key hashes everything that determines the response
+func (g *Generator) key(prompt string, opts *generator.GenerateOptions) (string, error) {
+	material, err := json.Marshal(struct {
+		Version  int                        `json:"version"`
+		Provider string                     `json:"provider"`
+		Backend  string                     `json:"backend"`
+		Endpoint string                     `json:"endpoint"` // Includes the API version
+		Model    string                     `json:"model"`
+		Prompt   string                     `json:"prompt"`
+		Options  *generator.GenerateOptions `json:"options"`
+	}{keyVersion, g.Name(), g.Backend(), g.Endpoint(), g.Model(), prompt, opts})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// load returns a cached, unexpired image
+func (g *Generator) load(key string) ([]byte, string, bool) {
+	metaData, err := os.ReadFile(filepath.Join(g.dir, key+metaSuffix))
+	if err != nil {
+		return nil, "", false
+	}
+	var e entry
+	if err := json.Unmarshal(metaData, &e); err != nil {
+		return nil, "", false
+	}
+	if g.ttl > 0 && g.now().Sub(e.CreatedAt) > g.ttl {
+		return nil, "", false
+	}
+
+	dataPath := filepath.Join(g.dir, key+dataSuffix)
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, "", false
+	}
+
+	// The modification time tracks use, for least-recently-used eviction
+	now := g.now()
+	os.Chtimes(dataPath, now, now)
+	return data, e.ContentType, true
+}
+
+// store writes an entry, image first, so a description always has its image
+func (g *Generator) store(key string, data []byte, e entry) error {
+	if g.maxSize > 0 && int64(len(data)) > g.maxSize {
+		return nil // Would be evicted straight away
+	}
+
+	if err := os.MkdirAll(g.dir, 0700); err != nil {
+		return err
+	}
+	metaData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	dataPath := filepath.Join(g.dir, key+dataSuffix)
+	if err := writeFile(dataPath, data); err != nil {
+		return err
+	}
+	now := g.now()
+	os.Chtimes(dataPath, now, now)
+	return writeFile(filepath.Join(g.dir, key+metaSuffix), metaData)
+}
+
+// evict removes expired entries, then the least recently used ones until
+// the cache fits in its size limit
+func (g *Generator) evict() {
+	files, err := os.ReadDir(g.dir)
+	if err != nil {
+		return
+	}
+
+	type cached struct {
+		key     string
+		size    int64
+		usedAt  time.Time
+		expired bool
+	}
+	var entries []cached
+	var total int64
+	for _, file := range files {
+		key, ok := strings.CutSuffix(file.Name(), dataSuffix)
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		c := cached{key: key, size: info.Size(), usedAt: info.ModTime()}
+		if g.ttl > 0 {
+			if metaData, err := os.ReadFile(filepath.Join(g.dir, key+metaSuffix)); err == nil {
+				var e entry
+				c.expired = json.Unmarshal(metaData, &e) != nil || g.now().Sub(e.CreatedAt) > g.ttl
+			}
+		}
+		entries = append(entries, c)
+		total += c.size
+	}
+
+	// Expired entries go first, then the least recently used
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].expired != entries[j].expired {
+			return entries[i].expired
+		}
+		return entries[i].usedAt.Before(entries[j].usedAt)
+	})
+	for _, c := range entries {
+		if !c.expired && (g.maxSize <= 0 || total <= g.maxSize) {
+			break
+		}
+		os.Remove(filepath.Join(g.dir, c.key+metaSuffix))
+		os.Remove(filepath.Join(g.dir, c.key+dataSuffix))
+		total -= c.size
+	}
+}
+
+// writeFile writes a file atomically, so concurrent readers never see part of it
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ParseSize parses a size such as "500MB", "2GB", "64KiB" or a plain number
+// of bytes; "0" means unlimited
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	}
+
+	multiplier := int64(1)
+	for _, unit := range units {
+		if rest, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s, multiplier = strings.TrimSpace(rest), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q (e.g. 500MB or 2GB)", ErrInvalidSize, value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
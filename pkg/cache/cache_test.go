@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// fakeProvider returns the prompt as the image, counting calls
+type fakeProvider struct {
+	model    string
+	endpoint string
+	calls    int
+	err      error
+}
+
+func (p *fakeProvider) Generate(ctx context.Context, prompt string, opts ...generator.Option) ([]byte, string, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, "", p.err
+	}
+	return []byte(prompt), "image/png", nil
+}
+
+func (p *fakeProvider) Name() string     { return "fake" }
+func (p *fakeProvider) Model() string    { return p.model }
+func (p *fakeProvider) Endpoint() string { return p.endpoint }
+
+// clock is a fake time source
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newCache(t *testing.T, provider *fakeProvider, opts ...Option) (*Generator, *clock) {
+	t.Helper()
+	c := &clock{now: time.Now().Truncate(time.Second)}
+	g := New(provider, t.TempDir(), opts...)
+	g.now = c.Now
+	return g, c
+}
+
+func generate(t *testing.T, g *Generator, prompt string, opts ...generator.Option) bool {
+	t.Helper()
+	var result generator.Result
+	data, contentType, err := g.Generate(context.Background(), prompt, append(opts, generator.WithResult(&result))...)
+	if err != nil {
+		t.Fatalf("Generate(%q): %v", prompt, err)
+	}
+	if string(data) != prompt || contentType != "image/png" {
+		t.Fatalf("Generate(%q) = %q, %s", prompt, data, contentType)
+	}
+	return result.Cached
+}
+
+func TestKeyStable(t *testing.T) {
+	g := New(&fakeProvider{model: "model-a", endpoint: "https://example.com/v1"}, t.TempDir())
+	opts := &generator.GenerateOptions{ImageSize: "2K", AspectRatio: "16:9"}
+
+	// Keys are stored on disk, so they must not change between releases
+	// unless keyVersion does
+	key, err := g.key("a lake", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	material := `{"version":1,"provider":"fake","backend":"","endpoint":"https://example.com/v1","model":"model-a",` +
+		`"prompt":"a lake","options":{"ImageSize":"2K","AspectRatio":"16:9"}}`
+	sum := sha256.Sum256([]byte(material))
+	if want := hex.EncodeToString(sum[:]); key != want {
+		t.Errorf("key = %s, want %s, the hash of %s", key, want, material)
+	}
+
+	// Per-call hooks are not part of the request
+	withHooks := *opts
+	withHooks.Result = &generator.Result{}
+	withHooks.Progress = func(generator.ProgressEvent) {}
+	if k, _ := g.key("a lake", &withHooks); k != key {
+		t.Errorf("key with result and progress = %s, want %s", k, key)
+	}
+}
+
+func TestKeyDistinguishesRequests(t *testing.T) {
+	base := &fakeProvider{model: "model-a", endpoint: "https://example.com/v1"}
+	opts := generator.GenerateOptions{ImageSize: "2K", AspectRatio: "16:9"}
+	key := func(p *fakeProvider, prompt string, o generator.GenerateOptions) string {
+		k, err := New(p, t.TempDir()).key(prompt, &o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	want := key(base, "a lake", opts)
+
+	otherSize, otherRatio := opts, opts
+	otherSize.ImageSize = "4K"
+	otherRatio.AspectRatio = "1:1"
+	variants := map[string]string{
+		"prompt":   key(base, "a hill", opts),
+		"size":     key(base, "a lake", otherSize),
+		"ratio":    key(base, "a lake", otherRatio),
+		"model":    key(&fakeProvider{model: "model-b", endpoint: base.endpoint}, "a lake", opts),
+		"endpoint": key(&fakeProvider{model: base.model, endpoint: "https://example.com/v2"}, "a lake", opts),
+	}
+	for name, k := range variants {
+		if k == want {
+			t.Errorf("changing the %s does not change the key", name)
+		}
+	}
+}
+
+func TestGenerateCaches(t *testing.T) {
+	provider := &fakeProvider{}
+	g, _ := newCache(t, provider)
+
+	if generate(t, g, "a lake") {
+		t.Error("first request served from the cache")
+	}
+	if !generate(t, g, "a lake") {
+		t.Error("identical request not served from the cache")
+	}
+	if generate(t, g, "a lake", generator.WithImageSize("4K")) {
+		t.Error("request with other options served from the cache")
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+}
+
+func TestGenerateErrorNotCached(t *testing.T) {
+	provider := &fakeProvider{err: errors.New("quota exceeded")}
+	g, _ := newCache(t, provider)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := g.Generate(context.Background(), "a lake"); err == nil {
+			t.Fatal("Generate succeeded")
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	provider := &fakeProvider{}
+	g, c := newCache(t, provider, WithTTL(time.Hour))
+
+	generate(t, g, "a lake")
+	c.advance(59 * time.Minute)
+	if !generate(t, g, "a lake") {
+		t.Error("entry expired before its TTL")
+	}
+
+	// Using an entry does not extend its life
+	c.advance(2 * time.Minute)
+	if generate(t, g, "a lake") {
+		t.Error("expired entry served")
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+}
+
+func TestTTLZeroKeepsEntries(t *testing.T) {
+	g, c := newCache(t, &fakeProvider{}, WithTTL(0))
+	generate(t, g, "a lake")
+	c.advance(365 * 24 * time.Hour)
+	if !generate(t, g, "a lake") {
+		t.Error("entry expired without a TTL")
+	}
+}
+
+func TestEvictionExpiredFirst(t *testing.T) {
+	g, c := newCache(t, &fakeProvider{}, WithTTL(time.Hour))
+	generate(t, g, "a lake")
+	c.advance(2 * time.Hour)
+
+	// Storing another entry removes the expired one, although there is room
+	generate(t, g, "a hill")
+	if keys := cachedKeys(t, g); len(keys) != 1 {
+		t.Errorf("%d entries cached, want 1", len(keys))
+	}
+}
+
+func TestEvictionLeastRecentlyUsed(t *testing.T) {
+	// Images are as large as their prompts: 10 bytes each, 30 at most
+	provider := &fakeProvider{}
+	g, c := newCache(t, provider, WithMaxSize(30))
+	prompts := []string{"image 0001", "image 0002", "image 0003"}
+	for _, prompt := range prompts {
+		generate(t, g, prompt)
+		c.advance(time.Minute)
+	}
+
+	// Using the oldest entry makes the second the least recently used
+	generate(t, g, prompts[0])
+	c.advance(time.Minute)
+	generate(t, g, "image 0004")
+
+	if n := len(cachedKeys(t, g)); n != 3 {
+		t.Errorf("%d entries cached, want 3", n)
+	}
+	calls := provider.calls
+	for _, prompt := range []string{prompts[0], prompts[2], "image 0004"} {
+		if !generate(t, g, prompt) {
+			t.Errorf("%q evicted", prompt)
+		}
+	}
+	if generate(t, g, prompts[1]) {
+		t.Errorf("%q, the least recently used, was kept", prompts[1])
+	}
+	if provider.calls != calls+1 {
+		t.Errorf("provider called %d times, want %d", provider.calls, calls+1)
+	}
+}
+
+func TestEvictionBySize(t *testing.T) {
+	g, c := newCache(t, &fakeProvider{}, WithMaxSize(25))
+
+	// One large entry makes room by evicting several small ones
+	for _, prompt := range []string{"small 1", "small 2", "small 3"} {
+		generate(t, g, prompt)
+		c.advance(time.Minute)
+	}
+	generate(t, g, "a much larger image")
+
+	var total int64
+	for _, key := range cachedKeys(t, g) {
+		info, err := os.Stat(filepath.Join(g.dir, key+dataSuffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	if total > 25 {
+		t.Errorf("cache holds %d bytes, over its 25 byte limit", total)
+	}
+	if !generate(t, g, "a much larger image") {
+		t.Error("newest entry evicted")
+	}
+
+	// An image larger than the whole cache is not stored
+	generate(t, g, strings.Repeat("x", 26))
+	if generate(t, g, strings.Repeat("x", 26)) {
+		t.Error("image larger than the cache was stored")
+	}
+}
+
+// cachedKeys returns the keys of the entries on disk
+func cachedKeys(t *testing.T, g *Generator) []string {
+	t.Helper()
+	files, err := os.ReadDir(g.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, file := range files {
+		if key, ok := strings.CutSuffix(file.Name(), dataSuffix); ok {
+			if _, err := os.Stat(filepath.Join(g.dir, key+metaSuffix)); err == nil {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"500MB", 500 << 20},
+		{"2GB", 2 << 30},
+		{"64KiB", 64 << 10},
+		{"1.5 gb", 3 << 29},
+		{"10b", 10},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "MB", "-1GB", "ten MB", "5TB"} {
+		if _, err := ParseSize(value); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("ParseSize(%q) = %v, want ErrInvalidSize", value, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/webp"
+)
+
+// Format represents an output image encoding
+type Format string
+
+// Supported output formats
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+// PNGCompression represents the zlib compression level used for PNG output
+type PNGCompression string
+
+// PNG compression levels
+const (
+	PNGCompressionDefault PNGCompression = "default"
+	PNGCompressionNone    PNGCompression = "none"
+	PNGCompressionFast    PNGCompression = "fast"
+	PNGCompressionBest    PNGCompression = "best"
+)
+
+// DefaultQuality is the JPEG quality used when none is specified
+const DefaultQuality = 95
+
+// DefaultWebPQuality is the WebP quality used when none is specified
+const DefaultWebPQuality = webp.DefaultQuality
+
+// Options contains the parameters for converting an image
+type Options struct {
+	Format         Format         // Target format (empty keeps the source format)
+	Quality        int            // JPEG or WebP quality (1-100, 0 for default); 100 makes WebP lossless
+	PNGCompression PNGCompression // Compression level for PNG output
+}
+
+// Validation errors
+var (
+	ErrUnsupportedFormat     = errors.New("unsupported output format")
+	ErrInvalidQuality        = errors.New("quality must be between 1 and 100")
+	ErrQualityUnsupported    = errors.New("quality is not supported for PNG output, which is always lossless")
+	ErrInvalidPNGCompression = errors.New("invalid PNG compression level")
+	ErrEmptyImage            = errors.New("image data is empty")
+)
+
+// ParseFormat parses a user-supplied format name such as "png", "jpg" or "webp"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	default:
+		return "", fmt.Errorf("%w: %s (supported formats: png, jpeg, webp)", ErrUnsupportedFormat, name)
+	}
+}
+
+// FormatFromContentType maps a MIME type to a Format, defaulting to PNG
+func FormatFromContentType(contentType string) Format {
+	switch contentType {
+	case "image/jpeg":
+		return FormatJPEG
+	case "image/webp":
+		return FormatWebP
+	default:
+		return FormatPNG
+	}
+}
+
+// Extension returns the file extension (including the dot) for the format
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+// Validate checks if the options are valid
+func (o *Options) Validate() error {
+	if o.Format != "" {
+		if _, err := ParseFormat(string(o.Format)); err != nil {
+			return err
+		}
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("%w: %d", ErrInvalidQuality, o.Quality)
+	}
+	if o.Quality != 0 && o.Format == FormatPNG {
+		return ErrQualityUnsupported
+	}
+
+	if _, err := o.pngLevel(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pngLevel maps the PNGCompression option to the encoder's level
+func (o *Options) pngLevel() (png.CompressionLevel, error) {
+	switch o.PNGCompression {
+	case "", PNGCompressionDefault:
+		return png.DefaultCompression, nil
+	case PNGCompressionNone:
+		return png.NoCompression, nil
+	case PNGCompressionFast:
+		return png.BestSpeed, nil
+	case PNGCompressionBest:
+		return png.BestCompression, nil
+	default:
+		return 0, fmt.Errorf("%w: %s (expected default, none, fast or best)", ErrInvalidPNGCompression, o.PNGCompression)
+	}
+}
+
+// Convert decodes image bytes and re-encodes them in the requested format
+//
+// Parameters:
+//   - data: the source image bytes (PNG, JPEG or WebP)
+//   - opts: conversion options
+//
+// Returns:
+//   - the encoded image bytes, with the source's ICC profile and metadata
+//   - the format the bytes were encoded in
+//   - error if conversion fails
+func Convert(data []byte, opts Options) ([]byte, Format, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid conversion options: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil, "", ErrEmptyImage
+	}
+
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ConvertImage(img, data, opts)
+}
+
+// ConvertImage encodes an edited image in the requested format, so edits
+// made to decoded pixels are encoded once, at the requested quality
+//
+// Parameters:
+//   - img: the image to encode
+//   - source: the bytes img was decoded from, whose format is kept unless
+//     opts names one, and whose ICC profile and metadata are carried over
+//   - opts: conversion options
+//
+// Returns:
+//   - the encoded image bytes
+//   - the format the bytes were encoded in
+//   - error if conversion fails
+func ConvertImage(img image.Image, source []byte, opts Options) ([]byte, Format, error) {
+	// Keep the source format unless a target was requested
+	if opts.Format == "" {
+		_, name, err := image.DecodeConfig(bytes.NewReader(source))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode image: %w", err)
+		}
+		if opts.Format, err = ParseFormat(name); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid conversion options: %w", err)
+	}
+
+	encoded, err := Encode(img, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Carry over the color profile and metadata the encoder dropped
+	encoded, err = metadata.Preserve(source, encoded)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to preserve image metadata: %w", err)
+	}
+
+	return encoded, opts.Format, nil
+}
+
+// Decode decodes PNG, JPEG or WebP image bytes
+func Decode(data []byte) (image.Image, Format, error) {
+	// Lossy WebP needs libwebp's colour conversion, which image.Decode lacks
+	if _, name, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && name == "webp" {
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode image: %w", err)
+		}
+		return img, FormatWebP, nil
+	}
+
+	img, name, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	format, err := ParseFormat(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, format, nil
+}
+
+// Encode encodes an image in the requested format
+func Encode(img image.Image, opts Options) ([]byte, error) {
+	format, err := ParseFormat(string(opts.Format))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatPNG:
+		level, err := opts.pngLevel()
+		if err != nil {
+			return nil, err
+		}
+		encoder := &png.Encoder{CompressionLevel: level}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+	case FormatJPEG:
+		quality := opts.Quality
+		if quality == 0 {
+			quality = DefaultQuality
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+	case FormatWebP:
+		if err := webp.Encode(&buf, img, &webp.Options{Quality: opts.Quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode WebP: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/watermark"
+)
+
+// photo returns a JPEG with a gradient and fine noise
+func photo(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 96, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 96; x++ {
+			n := (x*7 + y*13) % 9
+			img.SetNRGBA(x, y, color.NRGBA{uint8(40 + 2*x + n), uint8(60 + 3*y + n), uint8(120 + n), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sample returns photo carrying metadata
+func sample(t *testing.T) []byte {
+	t.Helper()
+	data, err := metadata.Embed(photo(t), metadata.Metadata{Prompt: "a gradient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestConvertWebPQuality(t *testing.T) {
+	src := sample(t)
+
+	var sizes []int
+	for _, quality := range []int{30, 90, 100} {
+		data, format, err := Convert(src, Options{Format: FormatWebP, Quality: quality})
+		if err != nil {
+			t.Fatalf("quality %d: %v", quality, err)
+		}
+		if format != FormatWebP {
+			t.Fatalf("quality %d: format = %s, want webp", quality, format)
+		}
+		if _, format, err := Decode(data); err != nil || format != FormatWebP {
+			t.Fatalf("quality %d: Decode = %s, %v", quality, format, err)
+		}
+		md, err := metadata.Read(data)
+		if err != nil || md.Prompt != "a gradient" {
+			t.Fatalf("quality %d: metadata = %+v, %v", quality, md, err)
+		}
+		sizes = append(sizes, len(data))
+	}
+	if sizes[0] >= sizes[1] || sizes[1] >= sizes[2] {
+		t.Errorf("sizes at quality 30, 90 and 100 = %v, want increasing", sizes)
+	}
+}
+
+func TestDecodeLossyWebPColours(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	want := color.NRGBA{200, 80, 30, 255}
+	for i := range img.Pix {
+		img.Pix[i] = [4]uint8{want.R, want.G, want.B, want.A}[i%4]
+	}
+	data, err := Encode(img, Options{Format: FormatWebP, Quality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, _, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := color.NRGBAModel.Convert(decoded.At(16, 16)).(color.NRGBA)
+	for _, d := range []int{int(got.R) - int(want.R), int(got.G) - int(want.G), int(got.B) - int(want.B)} {
+		if d < -3 || d > 3 {
+			t.Fatalf("colour = %v, want about %v", got, want)
+		}
+	}
+}
+
+func TestValidateQuality(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want error
+	}{
+		{Options{Format: FormatJPEG, Quality: 80}, nil},
+		{Options{Format: FormatWebP, Quality: 80}, nil},
+		{Options{Format: FormatWebP, Quality: 100}, nil},
+		{Options{Format: FormatPNG, Quality: 80}, ErrQualityUnsupported},
+		{Options{Format: FormatWebP, Quality: 101}, ErrInvalidQuality},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("Validate(%+v) = %v, want %v", tt.opts, err, tt.want)
+		}
+	}
+}
+
+func TestForeignXMPSurvivesWatermarkAndConversion(t *testing.T) {
+	// A provider image whose XMP has a property img-gen does not write
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/">` +
+		`<photoshop:Credit>Acme Studio</photoshop:Credit></rdf:Description></rdf:RDF></x:xmpmeta>`
+	src := photo(t)
+	app1 := append([]byte("\xFF\xE1\x00\x00http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(app1)-2))
+	src = append(append(append([]byte{}, src[:2]...), app1...), src[2:]...)
+
+	cfg := watermark.DefaultConfig()
+	cfg.Text = "©"
+	marked, err := watermark.Apply(src, cfg)
+	if err != nil {
+		t.Fatalf("watermark.Apply: %v", err)
+	}
+
+	for _, format := range []Format{FormatPNG, FormatJPEG, FormatWebP} {
+		converted, _, err := Convert(marked, Options{Format: format})
+		if err != nil {
+			t.Fatalf("%s: Convert: %v", format, err)
+		}
+		embedded, err := metadata.Embed(converted, metadata.Metadata{Prompt: "a gradient"})
+		if err != nil {
+			t.Fatalf("%s: Embed: %v", format, err)
+		}
+		if !bytes.Contains(embedded, []byte("<photoshop:Credit>Acme Studio</photoshop:Credit>")) {
+			t.Errorf("%s: the foreign XMP property was lost", format)
+		}
+		if md, err := metadata.Read(embedded); err != nil || md.Prompt != "a gradient" {
+			t.Errorf("%s: metadata = %+v, %v", format, md, err)
+		}
+	}
+}
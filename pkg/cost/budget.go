@@ -0,0 +1,97 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Budget errors
+var (
+	ErrInvalidBudget  = errors.New("invalid spending limit")
+	ErrBudgetExceeded = errors.New("spending limit reached")
+)
+
+// Period is the span a budget applies to
+type Period string
+
+// Period constants; periods follow the local calendar
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// Budget limits spending in a period
+type Budget struct {
+	Limit  float64 // US dollars
+	Period Period
+}
+
+// ParseBudgets parses limits such as "5/day" or "5/day,100/month"
+func ParseBudgets(value string) ([]Budget, error) {
+	var budgets []Budget
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		amount, period, ok := strings.Cut(item, "/")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q (expected amount/day or amount/month, e.g. 5/day)", ErrInvalidBudget, item)
+		}
+		limit, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(amount), "$"), 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("%w: %q has an invalid amount", ErrInvalidBudget, item)
+		}
+
+		budget := Budget{Limit: limit, Period: Period(strings.ToLower(strings.TrimSpace(period)))}
+		if budget.Period != PeriodDay && budget.Period != PeriodMonth {
+			return nil, fmt.Errorf("%w: %q has an unknown period (expected day or month)", ErrInvalidBudget, item)
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, nil
+}
+
+// Start returns when the period containing now began
+func (b Budget) Start(now time.Time) time.Time {
+	year, month, day := now.Date()
+	if b.Period == PeriodMonth {
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
+
+// CheckBudgets verifies that a request fits in every budget
+//
+// Parameters:
+//   - budgets: the limits to enforce
+//   - records: the spend ledger's records, including pending ones
+//   - project: the project whose spend counts; "" counts all spend
+//   - estimate: the expected cost of the request
+//   - now: the current time
+//
+// Returns:
+//   - ErrBudgetExceeded if the request would take spending past a limit
+func CheckBudgets(budgets []Budget, records []Record, project string, estimate float64, now time.Time) error {
+	records = Outstanding(records, now)
+	for _, budget := range budgets {
+		spent := Spent(records, project, budget.Start(now))
+		if spent+estimate > budget.Limit {
+			scope := ""
+			if project != "" {
+				scope = fmt.Sprintf(" for project %q", project)
+			}
+			period := "this month"
+			if budget.Period == PeriodDay {
+				period = "today"
+			}
+			return fmt.Errorf("%w%s: spent $%.2f of $%.2f %s, and this request is estimated at $%.2f",
+				ErrBudgetExceeded, scope, spent, budget.Limit, period, estimate)
+		}
+	}
+	return nil
+}
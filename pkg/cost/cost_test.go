@@ -0,0 +1,298 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEstimate(t *testing.T) {
+	table := DefaultTable()
+
+	// Before generating, the typical image tokens of the size are priced
+	got, err := table.Estimate("gemini-3-pro-image-preview", "4K", nil)
+	if err != nil || !near(got, 2000*120.0/1e6) {
+		t.Errorf("Estimate 4K = %v, %v, want %v", got, err, 2000*120.0/1e6)
+	}
+
+	// Afterwards, the reported usage is
+	usage := &generator.Usage{PromptTokens: 1000, OutputTokens: 1500}
+	got, err = table.Estimate("gemini-3-pro-image-preview", "4K", usage)
+	if want := 1000*2.0/1e6 + 1500*120.0/1e6; err != nil || !near(got, want) {
+		t.Errorf("Estimate with usage = %v, %v, want %v", got, err, want)
+	}
+
+	if _, err := table.Estimate("unknown-model", "1K", nil); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("Estimate of unknown model = %v, want ErrUnknownModel", err)
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prices.yaml")
+	table := `
+gemini-2.5-flash-image:
+  input_per_million: 1
+  output_per_million: 10
+  image_tokens: {1K: 1000}
+custom-model:
+  input_per_million: 1
+  per_image: {1K: 0.05}
+`
+	if err := os.WriteFile(path, []byte(table), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := LoadTable(path)
+	if err != nil {
+		t.Fatalf("LoadTable: %v", err)
+	}
+	if got, _ := prices.Estimate("gemini-2.5-flash-image", "1K", nil); !near(got, 0.01) {
+		t.Errorf("replaced model costs %v, want 0.01", got)
+	}
+	if _, ok := prices["gemini-3-pro-image-preview"]; !ok {
+		t.Error("default model missing from the loaded table")
+	}
+
+	// A flat price replaces output tokens, but prompt tokens are still charged
+	usage := &generator.Usage{PromptTokens: 1000, OutputTokens: 5000}
+	if got, _ := prices.Estimate("custom-model", "1K", usage); !near(got, 0.051) {
+		t.Errorf("per-image model costs %v, want 0.051", got)
+	}
+
+	if _, err := LoadTable(filepath.Join(dir, "prices.txt")); err == nil {
+		t.Error("LoadTable accepted a missing .txt file")
+	}
+}
+
+func TestParseBudgets(t *testing.T) {
+	budgets, err := ParseBudgets(" 5/day, $100/Month ,")
+	if err != nil {
+		t.Fatalf("ParseBudgets: %v", err)
+	}
+	want := []Budget{{Limit: 5, Period: PeriodDay}, {Limit: 100, Period: PeriodMonth}}
+	if len(budgets) != len(want) || budgets[0] != want[0] || budgets[1] != want[1] {
+		t.Errorf("ParseBudgets = %+v, want %+v", budgets, want)
+	}
+
+	if budgets, err := ParseBudgets(""); err != nil || len(budgets) != 0 {
+		t.Errorf("ParseBudgets(\"\") = %v, %v", budgets, err)
+	}
+	for _, value := range []string{"5", "five/day", "-1/day", "5/week"} {
+		if _, err := ParseBudgets(value); !errors.Is(err, ErrInvalidBudget) {
+			t.Errorf("ParseBudgets(%q) = %v, want ErrInvalidBudget", value, err)
+		}
+	}
+}
+
+func TestBudgetStart(t *testing.T) {
+	now := time.Date(2026, 3, 15, 18, 30, 0, 0, time.Local)
+	if got := (Budget{Period: PeriodDay}).Start(now); !got.Equal(time.Date(2026, 3, 15, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("day starts at %v", got)
+	}
+	if got := (Budget{Period: PeriodMonth}).Start(now); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("month starts at %v", got)
+	}
+}
+
+func TestCheckBudgets(t *testing.T) {
+	now := time.Date(2026, 3, 15, 18, 0, 0, 0, time.Local)
+	records := []Record{
+		{Time: now.AddDate(0, -1, 0), ID: "last-month", CostUSD: 50},
+		{Time: now.AddDate(0, 0, -1), ID: "yesterday", Project: "site", CostUSD: 3},
+		{Time: now.Add(-time.Hour), ID: "today-site", Project: "site", CostUSD: 2},
+		{Time: now.Add(-time.Hour), ID: "today-other", Project: "other", CostUSD: 2.5},
+	}
+	day := []Budget{{Limit: 5, Period: PeriodDay}}
+	month := []Budget{{Limit: 8, Period: PeriodMonth}}
+
+	tests := []struct {
+		name     string
+		budgets  []Budget
+		project  string
+		estimate float64
+		exceeded bool
+	}{
+		{"all projects under the day limit", day, "", 0.5, false},
+		{"all projects over the day limit", day, "", 0.6, true},
+		{"project under the day limit", day, "site", 3, false},
+		{"project over the month limit", month, "site", 3.1, true},
+		{"last month not counted", month, "", 0.5, false},
+		{"no budgets", nil, "", 1000, false},
+	}
+	for _, tt := range tests {
+		err := CheckBudgets(tt.budgets, records, tt.project, tt.estimate, now)
+		if exceeded := errors.Is(err, ErrBudgetExceeded); exceeded != tt.exceeded {
+			t.Errorf("%s: CheckBudgets = %v", tt.name, err)
+		}
+	}
+}
+
+func TestOutstanding(t *testing.T) {
+	now := time.Date(2026, 3, 15, 18, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: now.Add(-time.Minute), ID: "finished", CostUSD: 0.1, Pending: true},
+		{Time: now, ID: "finished", CostUSD: 0.12},
+		{Time: now.Add(-time.Minute), ID: "failed", CostUSD: 0.1, Pending: true},
+		{Time: now, ID: "failed", Canceled: true},
+		{Time: now.Add(-time.Minute), ID: "running", CostUSD: 0.1, Pending: true},
+		{Time: now.Add(-2 * PendingTTL), ID: "killed", CostUSD: 0.1, Pending: true},
+		{Time: now, ID: "unreserved", CostUSD: 0.2},
+	}
+
+	var ids []string
+	for _, record := range Outstanding(records, now) {
+		ids = append(ids, fmt.Sprintf("%s/%v", record.ID, record.Pending))
+	}
+	want := []string{"finished/false", "running/true", "unreserved/false"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("Outstanding = %v, want %v", ids, want)
+	}
+
+	var final []string
+	for _, record := range Final(records) {
+		final = append(final, record.ID)
+	}
+	if fmt.Sprint(final) != "[finished unreserved]" {
+		t.Errorf("Final = %v, want [finished unreserved]", final)
+	}
+}
+
+func newLedger(t *testing.T) *Ledger {
+	t.Helper()
+	return OpenLedger(filepath.Join(t.TempDir(), "img-gen", "spend.jsonl"))
+}
+
+func TestLedgerAppendRecords(t *testing.T) {
+	ledger := newLedger(t)
+	if records, err := ledger.Records(); err != nil || len(records) != 0 {
+		t.Fatalf("Records of missing ledger = %v, %v", records, err)
+	}
+
+	now := time.Date(2026, 3, 15, 18, 0, 0, 0, time.UTC)
+	usage := &generator.Usage{PromptTokens: 12, OutputTokens: 1290, TotalTokens: 1302}
+	if err := ledger.Append(Record{Time: now, ID: "img_1", Project: "site", Model: "m", Usage: usage, CostUSD: 0.15}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// Lines cut short by a crash are skipped
+	f, err := os.OpenFile(ledger.Path(), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"time\":\"2026-03-15T18:0\n")
+	f.Close()
+	if err := ledger.Append(Record{Time: now, ID: "img_2", CostUSD: 0.05}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ledger.Records()
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	if len(records) != 2 || records[0].ID != "img_1" || records[1].ID != "img_2" {
+		t.Fatalf("Records = %+v", records)
+	}
+	if *records[0].Usage != *usage || records[0].Project != "site" || !records[0].Time.Equal(now) {
+		t.Errorf("Records[0] = %+v", records[0])
+	}
+	if got := Spent(records, "", now); !near(got, 0.2) {
+		t.Errorf("Spent = %v, want 0.2", got)
+	}
+	if got := Spent(records, "site", now); !near(got, 0.15) {
+		t.Errorf("Spent by site = %v, want 0.15", got)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ledger := newLedger(t)
+	budgets := []Budget{{Limit: 1, Period: PeriodDay}}
+	now := time.Now()
+
+	first := Record{Time: now, ID: "img_1", CostUSD: 0.6}
+	if err := ledger.Reserve(budgets, first, now); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	// The pending estimate counts against the next run
+	second := Record{Time: now, ID: "img_2", CostUSD: 0.6}
+	if err := ledger.Reserve(budgets, second, now); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Reserve past the limit = %v, want ErrBudgetExceeded", err)
+	}
+
+	// The refused run's estimate is released, so a smaller request fits
+	third := Record{Time: now, ID: "img_3", CostUSD: 0.3}
+	if err := ledger.Reserve(budgets, third, now); err != nil {
+		t.Fatalf("Reserve after a refusal: %v", err)
+	}
+
+	// A failed generation releases its estimate, and the final cost of a
+	// successful one replaces it
+	if err := ledger.Cancel(first); err != nil {
+		t.Fatal(err)
+	}
+	third.CostUSD = 0.35
+	if err := ledger.Append(third); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ledger.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Spent(Outstanding(records, now), "", now.Add(-time.Hour)); !near(got, 0.35) {
+		t.Errorf("outstanding spend = %v, want 0.35", got)
+	}
+	if final := Final(records); len(final) != 1 || final[0].ID != "img_3" {
+		t.Errorf("Final = %+v, want img_3 only", final)
+	}
+}
+
+func TestReserveConcurrent(t *testing.T) {
+	ledger := newLedger(t)
+	budgets := []Budget{{Limit: 1, Period: PeriodDay}}
+	now := time.Now()
+
+	// Twenty runs of $0.15 start together; at most six fit in $1
+	const runs = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := ledger.Reserve(budgets, Record{Time: now, ID: fmt.Sprintf("img_%d", i), CostUSD: 0.15}, now)
+			if err != nil && !errors.Is(err, ErrBudgetExceeded) {
+				t.Errorf("Reserve: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if allowed > 6 {
+		t.Errorf("%d runs allowed, overshooting the limit", allowed)
+	}
+	records, err := ledger.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Spent(Outstanding(records, now), "", now.Add(-time.Hour)); got > 1 {
+		t.Errorf("outstanding spend = %v, over the $1 limit", got)
+	}
+}
@@ -0,0 +1,221 @@
+package cost
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// LedgerEnv overrides the location of the spend ledger
+const LedgerEnv = "IMG_GEN_SPEND_FILE"
+
+// PendingTTL is how long a pending record counts without a final one, after
+// which its run is taken to have been killed
+const PendingTTL = time.Hour
+
+// Record is the cost of one generation
+type Record struct {
+	Time      time.Time        `json:"time"`
+	ID        string           `json:"id"`
+	Project   string           `json:"project,omitempty"`
+	Provider  string           `json:"provider"`
+	Model     string           `json:"model"`
+	ImageSize string           `json:"image_size,omitempty"`
+	Usage     *generator.Usage `json:"usage,omitempty"`
+	CostUSD   float64          `json:"cost_usd"`
+	Pending   bool             `json:"pending,omitempty"`  // An estimate held while the generation runs
+	Canceled  bool             `json:"canceled,omitempty"` // Releases the pending record, for a generation that failed
+}
+
+// Ledger is an append-only JSON Lines file of generation costs, which
+// budgets are checked against. Unlike the history, it cannot be turned off.
+type Ledger struct {
+	path string
+}
+
+// DefaultLedgerPath returns $IMG_GEN_SPEND_FILE, or spend.jsonl in the
+// user's config directory (e.g. ~/.config/img-gen on Linux)
+func DefaultLedgerPath() (string, error) {
+	if path := os.Getenv(LedgerEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate spend ledger (set %s): %w", LedgerEnv, err)
+	}
+	return filepath.Join(dir, "img-gen", "spend.jsonl"), nil
+}
+
+// OpenLedger returns the ledger backed by the file at path
+// The file and its directory are created on the first Append.
+func OpenLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Path returns the location of the ledger file
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Append adds a record to the ledger
+func (l *Ledger) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create spend ledger directory: %w", err)
+	}
+
+	// One write per record, so concurrent runs append whole lines
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open spend ledger: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spend ledger: %w", err)
+	}
+	return f.Close()
+}
+
+// Reserve adds a pending record of a generation's estimated cost, if it fits
+// in every budget. The pending record counts towards the budgets of other
+// runs until Append records the final cost under the same ID, or Cancel
+// releases it. Since each run adds its record before reading the others,
+// runs started together cannot all fit in a budget that has room for one,
+// though they may all be refused.
+//
+// Parameters:
+//   - budgets: the limits to enforce
+//   - record: the generation, with CostUSD set to the estimate
+//   - now: the current time
+//
+// Returns:
+//   - ErrBudgetExceeded if the generation would take spending past a limit,
+//     in which case the pending record is released
+//   - error if the ledger cannot be read or written
+func (l *Ledger) Reserve(budgets []Budget, record Record, now time.Time) error {
+	record.Pending = true
+	if err := l.Append(record); err != nil {
+		return err
+	}
+
+	records, err := l.Records()
+	if err == nil {
+		// The run's own estimate is passed to CheckBudgets instead
+		others := records[:0]
+		for _, r := range records {
+			if !(r.Pending && r.ID == record.ID) {
+				others = append(others, r)
+			}
+		}
+		err = CheckBudgets(budgets, others, record.Project, record.CostUSD, now)
+	}
+	if err != nil {
+		l.Cancel(record)
+		return err
+	}
+	return nil
+}
+
+// Cancel releases the pending record of a generation that failed
+func (l *Ledger) Cancel(record Record) error {
+	record.Usage, record.CostUSD = nil, 0
+	record.Pending, record.Canceled = false, true
+	return l.Append(record)
+}
+
+// Records returns every record, oldest first
+// A missing ledger is empty. Lines that cannot be parsed are skipped.
+func (l *Ledger) Records() ([]Record, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open spend ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Time.IsZero() {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spend ledger: %w", err)
+	}
+	return records, nil
+}
+
+// Final returns the records of finished generations, leaving out pending
+// and canceled records
+func Final(records []Record) []Record {
+	var final []Record
+	for _, record := range records {
+		if !record.Pending && !record.Canceled {
+			final = append(final, record)
+		}
+	}
+	return final
+}
+
+// Outstanding returns the records that count towards budgets: those of
+// finished generations, and the pending records of generations still
+// running. A pending record stops counting once a final or canceled record
+// with its ID follows, or after PendingTTL.
+func Outstanding(records []Record, now time.Time) []Record {
+	settled := map[string]bool{}
+	for _, record := range records {
+		if !record.Pending {
+			settled[record.ID] = true
+		}
+	}
+
+	var outstanding []Record
+	for _, record := range records {
+		switch {
+		case record.Canceled:
+		case record.Pending && (settled[record.ID] || now.Sub(record.Time) > PendingTTL):
+		default:
+			outstanding = append(outstanding, record)
+		}
+	}
+	return outstanding
+}
+
+// Spent sums the cost of records since a time
+//
+// Parameters:
+//   - records: the ledger's records
+//   - project: only count this project's records; "" counts every record
+//   - since: only count records at or after this time
+//
+// Returns:
+//   - the total in US dollars
+func Spent(records []Record, project string, since time.Time) float64 {
+	var total float64
+	for _, record := range records {
+		if project != "" && record.Project != project {
+			continue
+		}
+		if record.Time.Before(since) {
+			continue
+		}
+		total += record.CostUSD
+	}
+	return total
+}
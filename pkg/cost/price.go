@@ -0,0 +1,109 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// ErrUnknownModel is returned when the price table has no entry for a model
+var ErrUnknownModel = errors.New("no price for model")
+
+// Price is what a model charges, in US dollars
+type Price struct {
+	InputPerMillion  float64            `json:"input_per_million" yaml:"input_per_million"`   // Per million prompt tokens
+	OutputPerMillion float64            `json:"output_per_million" yaml:"output_per_million"` // Per million output tokens
+	ImageTokens      map[string]int     `json:"image_tokens" yaml:"image_tokens"`             // Output tokens of an image, by size, for estimates
+	PerImage         map[string]float64 `json:"per_image" yaml:"per_image"`                   // Flat price of an image, by size, replacing output tokens
+}
+
+// Table maps model names to prices
+type Table map[string]Price
+
+// DefaultTable returns list prices of the supported models
+// Prices change; override them with a price table file.
+func DefaultTable() Table {
+	return Table{
+		"gemini-3-pro-image-preview": {
+			InputPerMillion:  2.00,
+			OutputPerMillion: 120.00,
+			ImageTokens:      map[string]int{"1K": 1120, "2K": 1120, "4K": 2000},
+		},
+		"gemini-2.5-flash-image": {
+			InputPerMillion:  0.30,
+			OutputPerMillion: 30.00,
+			ImageTokens:      map[string]int{"1K": 1290},
+		},
+	}
+}
+
+// LoadTable reads prices from a JSON or YAML file, keyed by model name, on
+// top of the default table
+//
+// Parameters:
+//   - path: the price table file (.json, .yaml or .yml)
+//
+// Returns:
+//   - the default table with the file's models added or replaced
+//   - error if the file cannot be read or parsed
+func LoadTable(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+	default:
+		return nil, fmt.Errorf("unsupported price table file: %s (expected .json, .yaml or .yml)", path)
+	}
+
+	// YAML is a superset of JSON
+	var prices Table
+	if err := yaml.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %w", err)
+	}
+
+	table := DefaultTable()
+	for model, price := range prices {
+		table[model] = price
+	}
+	return table, nil
+}
+
+// Estimate returns the cost of generating an image
+//
+// Parameters:
+//   - model: the model that generates it
+//   - size: the image size, e.g. "2K"
+//   - usage: the tokens the provider reported, or nil to estimate before
+//     generating from the typical output tokens of the size
+//
+// Returns:
+//   - the cost in US dollars
+//   - ErrUnknownModel if the table has no price for the model
+func (t Table) Estimate(model, size string, usage *generator.Usage) (float64, error) {
+	price, ok := t[model]
+	if !ok {
+		return 0, fmt.Errorf("%w %q (add it to the price table)", ErrUnknownModel, model)
+	}
+
+	var promptTokens, outputTokens int
+	if usage != nil {
+		promptTokens, outputTokens = usage.PromptTokens, usage.OutputTokens
+	} else {
+		outputTokens = price.ImageTokens[size]
+	}
+
+	cost := float64(promptTokens) * price.InputPerMillion / 1e6
+	if perImage, ok := price.PerImage[size]; ok {
+		return cost + perImage, nil
+	}
+	return cost + float64(outputTokens)*price.OutputPerMillion/1e6, nil
+}
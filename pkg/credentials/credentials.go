@@ -0,0 +1,337 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+)
+
+// ClaimGenerator identifies the software that made a claim
+const ClaimGenerator = "img-gen"
+
+// Action names from the C2PA actions assertion
+const (
+	ActionCreated     = "c2pa.created"
+	ActionEdited      = "c2pa.edited"
+	ActionWatermarked = "c2pa.watermarked"
+	ActionTranscoded  = "c2pa.transcoded"
+	ActionResized     = "c2pa.resized"
+)
+
+// DigitalSourceTrainedAlgorithmicMedia is the IPTC digital source type for
+// content created by a generative AI model
+const DigitalSourceTrainedAlgorithmicMedia = metadata.DigitalSourceTrainedAlgorithmicMedia
+
+// Assertion labels
+const (
+	labelActions  = "c2pa.actions"
+	labelDataHash = "c2pa.hash.data"
+)
+
+// Errors returned by Sign and Verify
+var (
+	ErrNoManifest         = metadata.ErrNoManifest
+	ErrMalformedManifest  = errors.New("malformed manifest")
+	ErrInvalidSignature   = errors.New("manifest signature is invalid")
+	ErrHashMismatch       = errors.New("image was modified after signing")
+	ErrInvalidCertificate = errors.New("invalid signing certificate")
+	ErrCertificateExpired = errors.New("signing certificate was not valid at signing time")
+	ErrInvalidKey         = errors.New("invalid signing key")
+)
+
+// Action records a step in the image's history
+type Action struct {
+	Action            string            `json:"action"`
+	When              time.Time         `json:"when,omitzero"`
+	SoftwareAgent     string            `json:"softwareAgent,omitempty"`
+	DigitalSourceType string            `json:"digitalSourceType,omitempty"`
+	Parameters        map[string]string `json:"parameters,omitempty"`
+}
+
+// Assertion is a labelled statement about the image
+type Assertion struct {
+	Label string          `json:"label"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Claim is the signed part of a manifest
+type Claim struct {
+	ClaimGenerator string      `json:"claim_generator"`
+	Title          string      `json:"title,omitempty"`
+	Format         string      `json:"format"`
+	InstanceID     string      `json:"instance_id"`
+	SignedAt       time.Time   `json:"signed_at"`
+	Assertions     []Assertion `json:"assertions"`
+}
+
+// Manifest is a claim and its signature as embedded in the image
+// The claim is kept as the exact bytes that were signed.
+type Manifest struct {
+	Claim     json.RawMessage `json:"claim"`
+	Signature Signature       `json:"signature"`
+}
+
+// Signature holds the signature over a claim and the signer's certificates
+type Signature struct {
+	Algorithm        string   `json:"alg"`
+	CertificateChain [][]byte `json:"certificate_chain"` // DER, leaf first
+	Value            []byte   `json:"value"`
+}
+
+// actionsAssertion is the data of a c2pa.actions assertion
+type actionsAssertion struct {
+	Actions []Action `json:"actions"`
+}
+
+// dataHash is the data of a c2pa.hash.data assertion; it binds the claim to
+// the image bytes without the manifest
+type dataHash struct {
+	Algorithm string `json:"alg"`
+	Hash      []byte `json:"hash"`
+}
+
+// Verification describes a verified manifest
+type Verification struct {
+	Claim      Claim     `json:"claim"`
+	Actions    []Action  `json:"actions"`
+	Signer     string    `json:"signer"`      // Subject of the signing certificate
+	Issuer     string    `json:"issuer"`      // Issuer of the signing certificate
+	SelfSigned bool      `json:"self_signed"` // The signing certificate signed itself
+	Trusted    bool      `json:"trusted"`     // The certificate chains to a system root
+	SignedAt   time.Time `json:"signed_at"`
+}
+
+// Sign embeds a manifest declaring the image's history, signed by signer
+//
+// Parameters:
+//   - data: the final encoded image (PNG, JPEG or WebP); any existing manifest is replaced
+//   - title: the image's file name
+//   - actions: the steps that produced the image, e.g. ActionCreated with
+//     DigitalSourceTrainedAlgorithmicMedia followed by edits
+//   - signer: the certificate and key to sign with
+//
+// Returns:
+//   - image bytes with the manifest embedded
+//   - error if signing or embedding fails
+func Sign(data []byte, title string, actions []Action, signer *Signer) ([]byte, error) {
+	base, err := metadata.WithoutManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceID, err := newInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(base)
+	actionsData, err := json.Marshal(actionsAssertion{Actions: actions})
+	if err != nil {
+		return nil, err
+	}
+	hashData, err := json.Marshal(dataHash{Algorithm: "sha256", Hash: hash[:]})
+	if err != nil {
+		return nil, err
+	}
+
+	claim, err := json.Marshal(Claim{
+		ClaimGenerator: ClaimGenerator,
+		Title:          title,
+		Format:         http.DetectContentType(base),
+		InstanceID:     instanceID,
+		SignedAt:       time.Now().UTC(),
+		Assertions: []Assertion{
+			{Label: labelActions, Data: actionsData},
+			{Label: labelDataHash, Data: hashData},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	alg, signature, err := signer.sign(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([][]byte, len(signer.chain))
+	for i, cert := range signer.chain {
+		chain[i] = cert.Raw
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		Claim: claim,
+		Signature: Signature{
+			Algorithm:        alg,
+			CertificateChain: chain,
+			Value:            signature,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.EmbedManifest(base, manifest)
+}
+
+// Verify reads and checks the manifest embedded in an image
+//
+// Parameters:
+//   - data: the encoded image (PNG, JPEG or WebP)
+//
+// Returns:
+//   - the manifest's claim and signer; returned whenever the manifest can be
+//     parsed, even if it fails verification
+//   - ErrNoManifest if the image has no manifest, or an error describing why
+//     verification failed (ErrInvalidSignature, ErrHashMismatch, ...)
+func Verify(data []byte) (*Verification, error) {
+	raw, err := metadata.ReadManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedManifest, err)
+	}
+
+	var claim Claim
+	if err := json.Unmarshal(manifest.Claim, &claim); err != nil {
+		return nil, fmt.Errorf("%w: invalid claim: %v", ErrMalformedManifest, err)
+	}
+
+	chain, err := parseChain(manifest.Signature.CertificateChain)
+	if err != nil {
+		return nil, err
+	}
+	leaf := chain[0]
+
+	v := &Verification{
+		Claim:      claim,
+		Signer:     leaf.Subject.String(),
+		Issuer:     leaf.Issuer.String(),
+		SelfSigned: isSelfSigned(leaf),
+		SignedAt:   claim.SignedAt,
+	}
+
+	var hash *dataHash
+	for _, assertion := range claim.Assertions {
+		switch assertion.Label {
+		case labelActions:
+			var actions actionsAssertion
+			if err := json.Unmarshal(assertion.Data, &actions); err != nil {
+				return v, fmt.Errorf("%w: invalid actions: %v", ErrMalformedManifest, err)
+			}
+			v.Actions = actions.Actions
+		case labelDataHash:
+			hash = &dataHash{}
+			if err := json.Unmarshal(assertion.Data, hash); err != nil {
+				return v, fmt.Errorf("%w: invalid data hash: %v", ErrMalformedManifest, err)
+			}
+		}
+	}
+
+	// The signature covers the claim, including the data hash
+	if err := verifySignature(manifest.Signature.Algorithm, leaf.PublicKey, manifest.Claim, manifest.Signature.Value); err != nil {
+		return v, err
+	}
+
+	if err := verifyChain(chain, claim.SignedAt); err != nil {
+		return v, err
+	}
+	v.Trusted = isTrusted(chain, claim.SignedAt)
+
+	if hash == nil || hash.Algorithm != "sha256" {
+		return v, fmt.Errorf("%w: missing sha256 data hash", ErrMalformedManifest)
+	}
+	base, err := metadata.WithoutManifest(data)
+	if err != nil {
+		return v, err
+	}
+	if sum := sha256.Sum256(base); !bytes.Equal(sum[:], hash.Hash) {
+		return v, ErrHashMismatch
+	}
+
+	return v, nil
+}
+
+// parseChain parses DER certificates
+func parseChain(certs [][]byte) ([]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: no certificates", ErrInvalidCertificate)
+	}
+
+	chain := make([]*x509.Certificate, len(certs))
+	for i, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		chain[i] = cert
+	}
+	return chain, nil
+}
+
+// isSelfSigned reports whether a certificate signed itself
+// CheckSignatureFrom is not used since it also requires the CA flag, which
+// self-signed leaf certificates often lack.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// verifyChain checks that each certificate was valid at signing time and
+// was issued by the next one in the chain
+func verifyChain(chain []*x509.Certificate, signedAt time.Time) error {
+	for i, cert := range chain {
+		if signedAt.Before(cert.NotBefore) || signedAt.After(cert.NotAfter) {
+			return fmt.Errorf("%w: %s", ErrCertificateExpired, cert.Subject)
+		}
+		if i+1 < len(chain) {
+			if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+				return fmt.Errorf("%w: %s was not issued by %s", ErrInvalidCertificate, cert.Subject, chain[i+1].Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// isTrusted reports whether the chain leads to a root in the system pool
+func isTrusted(chain []*x509.Certificate, signedAt time.Time) bool {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return false
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil
+}
+
+// newInstanceID returns a random XMP instance ID
+func newInstanceID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0F | 0x40 // UUID version 4
+	b[8] = b[8]&0x3F | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("xmp:iid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
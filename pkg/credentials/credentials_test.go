@@ -0,0 +1,271 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/convert"
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
+)
+
+// newCertificate returns a self-signed certificate for key
+func newCertificate(t *testing.T, key crypto.Signer, name string) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(key, []*x509.Certificate{newCertificate(t, key, "Test Signer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testImages returns a small image encoded in every supported format
+func testImages(t *testing.T) map[string][]byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(8 * x), uint8(10 * y), 128, 255})
+		}
+	}
+
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	webpData, err := convert.Encode(img, convert.Options{Format: convert.FormatWebP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][]byte{"png": pngData.Bytes(), "jpeg": jpegData.Bytes(), "webp": webpData}
+}
+
+var testActions = []Action{
+	{Action: ActionCreated, SoftwareAgent: "test-provider", DigitalSourceType: DigitalSourceTrainedAlgorithmicMedia},
+	{Action: ActionWatermarked, SoftwareAgent: ClaimGenerator},
+}
+
+func TestSignVerify(t *testing.T) {
+	signer := newSigner(t)
+	for format, data := range testImages(t) {
+		t.Run(format, func(t *testing.T) {
+			signed, err := Sign(data, "image."+format, testActions, signer)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			v, err := Verify(signed)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if v.Claim.Title != "image."+format || v.Signer != "CN=Test Signer" || !v.SelfSigned {
+				t.Errorf("Verify = %+v", v)
+			}
+			if len(v.Actions) != 2 || v.Actions[0].DigitalSourceType != DigitalSourceTrainedAlgorithmicMedia {
+				t.Errorf("actions = %+v", v.Actions)
+			}
+
+			// Signing again replaces the manifest rather than adding one
+			resigned, err := Sign(signed, "image."+format, testActions, signer)
+			if err != nil {
+				t.Fatalf("Sign signed image: %v", err)
+			}
+			if _, err := Verify(resigned); err != nil {
+				t.Errorf("Verify re-signed image: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	for format, data := range testImages(t) {
+		if _, err := Verify(data); !errors.Is(err, ErrNoManifest) {
+			t.Errorf("%s: Verify = %v, want ErrNoManifest", format, err)
+		}
+	}
+}
+
+func TestVerifyTamperedImage(t *testing.T) {
+	signer := newSigner(t)
+	for format, data := range testImages(t) {
+		t.Run(format, func(t *testing.T) {
+			signed, err := Sign(data, "image."+format, testActions, signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Changing the metadata changes the image bytes, as a pixel edit would
+			tampered, err := metadata.Embed(signed, metadata.Metadata{Prompt: "something else"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Verify(tampered); !errors.Is(err, ErrHashMismatch) {
+				t.Errorf("Verify = %v, want ErrHashMismatch", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaim(t *testing.T) {
+	data := testImages(t)["png"]
+	signed, err := Sign(data, "image.png", testActions, newSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the claim to hide that the image is AI-generated
+	raw, err := metadata.ReadManifest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(raw, []byte(`trainedAlgorithmicMedia`), []byte(`digitalCapture`), 1)
+	if bytes.Equal(tampered, raw) {
+		t.Fatal("claim does not name the digital source type")
+	}
+	base, err := metadata.WithoutManifest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := metadata.EmbedManifest(base, tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(rewritten); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifySwappedCertificate(t *testing.T) {
+	data := testImages(t)["png"]
+	signed, err := Sign(data, "image.png", testActions, newSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Claim another signer's identity by replacing the certificate
+	other := newSigner(t)
+	raw, err := metadata.ReadManifest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	manifest.Signature.CertificateChain = [][]byte{other.Certificate().Raw}
+	raw, err = json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := metadata.WithoutManifest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := metadata.EmbedManifest(base, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(rewritten); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestNewSignerMismatchedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newCertificate(t, key, "Test Signer")
+
+	for _, k := range []crypto.Signer{otherKey, edKey} {
+		if _, err := NewSigner(k, []*x509.Certificate{cert}); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("NewSigner(%T) = %v, want ErrInvalidKey", k, err)
+		}
+	}
+	if _, err := NewSigner(key, nil); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("NewSigner without certificates = %v, want ErrInvalidCertificate", err)
+	}
+}
+
+func TestVerifyExpiredCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Expired"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(key, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := Sign(testImages(t)["png"], "image.png", testActions, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(signed); !errors.Is(err, ErrCertificateExpired) {
+		t.Errorf("Verify = %v, want ErrCertificateExpired", err)
+	}
+}
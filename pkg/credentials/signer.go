@@ -0,0 +1,238 @@
+package credentials
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Signature algorithms, named as in COSE/JOSE
+const (
+	AlgorithmES256   = "ES256"
+	AlgorithmES384   = "ES384"
+	AlgorithmES512   = "ES512"
+	AlgorithmPS256   = "PS256"
+	AlgorithmEd25519 = "Ed25519"
+)
+
+// Signer signs manifests with a private key and its certificate chain
+type Signer struct {
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+// LoadSigner loads a PEM certificate chain (leaf first) and a PEM private key
+//
+// Parameters:
+//   - certPath: path to the PEM certificate chain
+//   - keyPath: path to the PEM private key (PKCS#8, SEC 1 EC or PKCS#1 RSA)
+//
+// Returns:
+//   - a Signer whose key matches the leaf certificate
+//   - error if either file cannot be read or they do not match
+func LoadSigner(certPath, keyPath string) (*Signer, error) {
+	chain, err := loadCertificates(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigner(key, chain)
+}
+
+// NewSigner returns a Signer for a key and its certificate chain (leaf first)
+func NewSigner(key crypto.Signer, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: no certificates", ErrInvalidCertificate)
+	}
+
+	leaf := chain[0]
+	if !publicKeysEqual(leaf.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("%w: private key does not match the certificate", ErrInvalidKey)
+	}
+	if _, err := algorithmFor(key.Public()); err != nil {
+		return nil, err
+	}
+
+	return &Signer{key: key, chain: chain}, nil
+}
+
+// Certificate returns the signer's leaf certificate
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.chain[0]
+}
+
+// sign signs a message, returning the algorithm name and signature
+func (s *Signer) sign(message []byte) (string, []byte, error) {
+	alg, err := algorithmFor(s.key.Public())
+	if err != nil {
+		return "", nil, err
+	}
+
+	digest, opts := digestFor(alg, message)
+	signature, err := s.key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	return alg, signature, nil
+}
+
+// algorithmFor picks the signature algorithm for a public key
+func algorithmFor(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return AlgorithmES256, nil
+		case elliptic.P384():
+			return AlgorithmES384, nil
+		case elliptic.P521():
+			return AlgorithmES512, nil
+		}
+		return "", fmt.Errorf("%w: unsupported elliptic curve %s", ErrInvalidKey, k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return "", fmt.Errorf("%w: RSA keys must be at least 2048 bits", ErrInvalidKey)
+		}
+		return AlgorithmPS256, nil
+	case ed25519.PublicKey:
+		return AlgorithmEd25519, nil
+	}
+	return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, pub)
+}
+
+// digestFor returns what is passed to crypto.Signer.Sign for an algorithm
+// Ed25519 signs the message itself; the others sign its digest.
+func digestFor(alg string, message []byte) ([]byte, crypto.SignerOpts) {
+	switch alg {
+	case AlgorithmES384:
+		sum := crypto.SHA384.New()
+		sum.Write(message)
+		return sum.Sum(nil), crypto.SHA384
+	case AlgorithmES512:
+		sum := crypto.SHA512.New()
+		sum.Write(message)
+		return sum.Sum(nil), crypto.SHA512
+	case AlgorithmPS256:
+		sum := crypto.SHA256.New()
+		sum.Write(message)
+		return sum.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	case AlgorithmEd25519:
+		return message, crypto.Hash(0)
+	default:
+		sum := crypto.SHA256.New()
+		sum.Write(message)
+		return sum.Sum(nil), crypto.SHA256
+	}
+}
+
+// verifySignature checks a signature made by sign
+func verifySignature(alg string, pub crypto.PublicKey, message, signature []byte) error {
+	expected, err := algorithmFor(pub)
+	if err != nil {
+		return err
+	}
+	if alg != expected {
+		return fmt.Errorf("%w: algorithm %s does not match the certificate key", ErrInvalidSignature, alg)
+	}
+
+	digest, opts := digestFor(alg, message)
+	valid := false
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, digest, signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPSS(k, crypto.SHA256, digest, signature, opts.(*rsa.PSSOptions)) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, digest, signature)
+	}
+
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// loadCertificates reads every certificate in a PEM file
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: no PEM certificates in %s", ErrInvalidCertificate, path)
+	}
+	return chain, nil
+}
+
+// loadPrivateKey reads a PEM private key
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%w: no PEM private key in %s", ErrInvalidKey, path)
+		}
+
+		var key any
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		default:
+			continue // e.g. EC PARAMETERS
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+		}
+		return signer, nil
+	}
+}
+
+// publicKeysEqual compares two public keys
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
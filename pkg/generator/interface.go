@@ -2,6 +2,7 @@ package generator
 
 import (
 	"context"
+	"encoding/json"
 )
 
 type ImageGenerator interface {
@@ -13,11 +14,63 @@ type ImageGenerator interface {
 	Name() string
 }
 
+// Request is the API request a provider would send, with credentials redacted
+type Request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// RequestBuilder is implemented by generators that can show the request
+// Generate would send, without sending it
+type RequestBuilder interface {
+	BuildRequest(prompt string, opts ...Option) (*Request, error)
+}
+
 type GenerateOptions struct {
-	ImageSize string
-	AspectRatio  string
+	ImageSize   string
+	AspectRatio string
+
+	// Result, if set, is filled in with details of how the request was served
+	Result *Result `json:"-"`
+
+	// Progress, if set, receives progress events; providers that support it
+	// stream the response to report them
+	Progress ProgressFunc `json:"-"`
 }
 
+// Result describes how a Generate call was served
+type Result struct {
+	Cached bool   // The image came from the response cache, not the provider
+	Usage  *Usage // Tokens the provider reported, if any
+}
+
+// Usage is the token usage a provider reported for a request
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	OutputTokens int `json:"output_tokens"` // Generated text and image tokens, including thinking
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Progress stages reported by providers
+const (
+	StageRequestSent   = "request_sent"   // The request was sent
+	StageFirstByte     = "first_byte"     // The response started to arrive
+	StageText          = "text"           // The model produced text, such as a thought summary
+	StageImageReceived = "image_received" // The image arrived
+)
+
+// ProgressEvent reports a step of a generation
+type ProgressEvent struct {
+	Stage string
+	Text  string // The text, for StageText
+	Bytes int    // The size of the image, for StageImageReceived
+}
+
+// ProgressFunc receives progress events as they happen
+type ProgressFunc func(ProgressEvent)
+
 // Option is a functional option for configuring GenerateOptions.
 type Option func(*GenerateOptions)
 
@@ -32,3 +85,17 @@ func WithImageSize(size string) Option {
 		o.ImageSize = size
 	}
 }
+
+// WithResult asks Generate to describe how the request was served in r
+func WithResult(r *Result) Option {
+	return func(o *GenerateOptions) {
+		o.Result = r
+	}
+}
+
+// WithProgress reports the progress of the request to fn
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *GenerateOptions) {
+		o.Progress = fn
+	}
+}
@@ -0,0 +1,242 @@
+package googleauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudPlatformScope grants access to Google Cloud APIs, including Vertex AI
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// defaultTokenURI is used when a key file does not name a token endpoint
+const defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+// jwtBearerGrant is the OAuth2 grant type for signed JWT assertions (RFC 7523)
+const jwtBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// Tokens are refreshed this long before they expire
+const expiryMargin = time.Minute
+
+// Service account errors
+var (
+	ErrInvalidKeyFile = errors.New("invalid service account key file")
+	ErrTokenExchange  = errors.New("token exchange failed")
+)
+
+// ServiceAccount is a Google Cloud service account JSON key
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// LoadServiceAccount reads a service account JSON key file
+//
+// Parameters:
+//   - path: the key file downloaded from the Google Cloud console
+//
+// Returns:
+//   - the service account
+//   - error if the file cannot be read or is not a service account key
+func LoadServiceAccount(path string) (*ServiceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key file: %w", err)
+	}
+
+	var account ServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKeyFile, path, err)
+	}
+	if account.Type != "service_account" {
+		return nil, fmt.Errorf("%w: %s has type %q, expected \"service_account\"", ErrInvalidKeyFile, path, account.Type)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("%w: %s is missing client_email or private_key", ErrInvalidKeyFile, path)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = defaultTokenURI
+	}
+
+	account.key, err = parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKeyFile, path, err)
+	}
+	return &account, nil
+}
+
+// parsePrivateKey decodes a PEM RSA key in PKCS #8 or PKCS #1 form
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private_key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key is not an RSA key")
+	}
+	return key, nil
+}
+
+// TokenSource returns OAuth2 access tokens for the service account, cached
+// until shortly before they expire
+type TokenSource struct {
+	account *ServiceAccount
+	scope   string
+	client  *http.Client
+	now     func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewTokenSource returns a token source for the service account
+//
+// Parameters:
+//   - account: the service account that signs token requests
+//   - client: the HTTP client for the token endpoint; nil uses a default
+//   - scopes: the OAuth2 scopes to request; none requests CloudPlatformScope
+//
+// Returns:
+//   - the token source
+func NewTokenSource(account *ServiceAccount, client *http.Client, scopes ...string) *TokenSource {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{CloudPlatformScope}
+	}
+	return &TokenSource{
+		account: account,
+		scope:   strings.Join(scopes, " "),
+		client:  client,
+		now:     time.Now,
+	}
+}
+
+// Token returns a valid access token, exchanging a signed JWT for a new one
+// if the cached token is missing or about to expire
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.now().Add(expiryMargin).Before(s.expires) {
+		return s.token, nil
+	}
+
+	assertion, err := s.assertion()
+	if err != nil {
+		return "", err
+	}
+	token, expiresIn, err := s.exchange(ctx, assertion)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = token
+	s.expires = s.now().Add(expiresIn)
+	return token, nil
+}
+
+// assertion returns a JWT asserting the service account's identity, signed
+// with its private key
+func (s *TokenSource) assertion() (string, error) {
+	now := s.now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.account.PrivateKeyID}
+	claims := map[string]interface{}{
+		"iss":   s.account.ClientEmail,
+		"scope": s.scope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.account.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// exchange trades a signed JWT for an access token at the token endpoint
+func (s *TokenSource) exchange(ctx context.Context, assertion string) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type": {jwtBearerGrant},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("%w: token endpoint returned %d: %s", ErrTokenExchange, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("%w: failed to decode response: %v", ErrTokenExchange, err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("%w: response has no access_token", ErrTokenExchange)
+	}
+	if token.ExpiresIn <= 0 {
+		token.ExpiresIn = 3600
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
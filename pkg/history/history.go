@@ -0,0 +1,242 @@
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PathEnv overrides the location of the history file
+const PathEnv = "IMG_GEN_HISTORY_FILE"
+
+// Status is the outcome of a generation run
+type Status string
+
+// Status constants
+const (
+	StatusSuccess Status = "success"
+	StatusError   Status = "error"
+)
+
+// Errors returned by the store
+var (
+	ErrNotFound  = errors.New("no history entry found")
+	ErrAmbiguous = errors.New("several history entries match")
+	ErrNoQuery   = errors.New("search query is empty")
+)
+
+// Entry records a single generation run
+type Entry struct {
+	ID         string            `json:"id"`
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMS int64             `json:"duration_ms"`
+	Status     Status            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Prompt     string            `json:"prompt"`
+	Provider   string            `json:"provider,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	Cached     bool              `json:"cached,omitempty"`   // Served from the response cache
+	CostUSD    float64           `json:"cost_usd,omitempty"` // Estimated from the price table; 0 if cached or unpriced
+	Options    map[string]string `json:"options,omitempty"`  // Flags set on the command line, other than the prompt
+	Args       []string          `json:"args"`               // Command-line arguments, replayed by rerun
+	Dir        string            `json:"dir,omitempty"`      // Working directory, where rerun replays the arguments
+	OutputPath string            `json:"output_path,omitempty"`
+	Renditions []string          `json:"renditions,omitempty"`
+	SHA256     string            `json:"sha256,omitempty"` // Hash of the saved image
+}
+
+// Duration returns how long the run took
+func (e *Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMS) * time.Millisecond
+}
+
+// Store is an append-only JSON Lines file of entries, oldest first
+type Store struct {
+	path string
+}
+
+// DefaultPath returns $IMG_GEN_HISTORY_FILE, or history.jsonl in the user's
+// config directory (e.g. ~/.config/img-gen on Linux)
+func DefaultPath() (string, error) {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate history file (set %s): %w", PathEnv, err)
+	}
+	return filepath.Join(dir, "img-gen", "history.jsonl"), nil
+}
+
+// Open returns the store backed by the file at path
+// The file and its directory are created on the first Append.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the location of the history file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds an entry to the end of the history
+//
+// Parameters:
+//   - entry: the run to record
+//
+// Returns:
+//   - error if the history file cannot be written
+func (s *Store) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	// One write per entry, so concurrent runs append whole lines
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return f.Close()
+}
+
+// List returns every entry, oldest first
+// A missing history file is an empty history. Lines that cannot be parsed,
+// such as one cut short by a crash, are skipped.
+func (s *Store) List() ([]Entry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Find returns the entry with the given ID, or the one that saved the given
+// image path (as the main image or a rendition)
+//
+// Parameters:
+//   - ref: an entry ID such as img_mb3k9x2q1c0a_9f86d081, or an image path
+//
+// Returns:
+//   - the matching entry
+//   - ErrNotFound if no entry matches
+//   - ErrAmbiguous if several entries saved the image path and none of them
+//     saved the image now on disk
+func (s *Store) Find(ref string) (*Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].ID == ref {
+			return &entries[i], nil
+		}
+	}
+
+	// Compare absolute paths, so relative paths match from any directory
+	target, err := filepath.Abs(ref)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Entry
+	for i := range entries {
+		for _, path := range append([]string{entries[i].OutputPath}, entries[i].Renditions...) {
+			if path != "" && path == target {
+				matches = append(matches, &entries[i])
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	case 1:
+		return matches[0], nil
+	}
+
+	// A path is reused once its image is deleted, so pick the entry that
+	// saved the image now on disk
+	if data, err := os.ReadFile(target); err == nil {
+		sum := sha256.Sum256(data)
+		var saved []*Entry
+		for _, entry := range matches {
+			if entry.SHA256 == hex.EncodeToString(sum[:]) {
+				saved = append(saved, entry)
+			}
+		}
+		if len(saved) == 1 {
+			return saved[0], nil
+		}
+	}
+	ids := make([]string, len(matches))
+	for i, entry := range matches {
+		ids[i] = entry.ID
+	}
+	return nil, fmt.Errorf("%w: %s was saved by %s; use an ID instead", ErrAmbiguous, ref, strings.Join(ids, ", "))
+}
+
+// Search returns the entries whose ID, prompt, output path or error contains
+// every word of the query, ignoring case, oldest first
+func (s *Store) Search(query string) ([]Entry, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, ErrNoQuery
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Entry
+	for _, entry := range entries {
+		text := strings.ToLower(strings.Join([]string{entry.ID, entry.Prompt, entry.OutputPath, entry.Error}, "\n"))
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,214 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	return Open(filepath.Join(t.TempDir(), "img-gen", "history.jsonl"))
+}
+
+func appendEntries(t *testing.T, store *Store, entries ...Entry) {
+	t.Helper()
+	for _, entry := range entries {
+		if err := store.Append(entry); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAppendList(t *testing.T) {
+	store := newStore(t)
+	if entries, err := store.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List of missing history = %v, %v", entries, err)
+	}
+
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	appendEntries(t, store,
+		Entry{ID: "img_1", StartedAt: started, Status: StatusSuccess, Prompt: "a lake", Args: []string{"--prompt", "a lake"}},
+		Entry{ID: "img_2", Status: StatusError, Error: "quota exceeded", Prompt: "a hill"},
+	)
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "img_1" || entries[1].ID != "img_2" {
+		t.Fatalf("List = %+v, want img_1 then img_2", entries)
+	}
+	if !entries[0].StartedAt.Equal(started) || len(entries[0].Args) != 2 || entries[1].Error != "quota exceeded" {
+		t.Errorf("List = %+v", entries)
+	}
+}
+
+func TestListSkipsCorruptLines(t *testing.T) {
+	store := newStore(t)
+	appendEntries(t, store, Entry{ID: "img_1"})
+
+	// A run that crashed mid-write leaves part of a line
+	f, err := os.OpenFile(store.Path(), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("{\"id\":\"img_\n{}\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	appendEntries(t, store, Entry{ID: "img_2"})
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "img_1" || entries[1].ID != "img_2" {
+		t.Errorf("List = %+v, want img_1 and img_2", entries)
+	}
+}
+
+func TestFindByID(t *testing.T) {
+	store := newStore(t)
+	appendEntries(t, store, Entry{ID: "img_1", Prompt: "a lake"}, Entry{ID: "img_2", Prompt: "a hill"})
+
+	entry, err := store.Find("img_2")
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if entry.Prompt != "a hill" {
+		t.Errorf("Find = %+v, want img_2", entry)
+	}
+
+	if _, err := store.Find("img_3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find unknown ID = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindByPath(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "lake.png")
+	rendition := filepath.Join(dir, "lake.webp")
+
+	store := newStore(t)
+	appendEntries(t, store,
+		Entry{ID: "img_1", OutputPath: filepath.Join(dir, "hill.png")},
+		Entry{ID: "img_2", OutputPath: image, Renditions: []string{rendition}},
+	)
+
+	for _, ref := range []string{image, rendition} {
+		entry, err := store.Find(ref)
+		if err != nil {
+			t.Fatalf("Find(%s): %v", ref, err)
+		}
+		if entry.ID != "img_2" {
+			t.Errorf("Find(%s) = %s, want img_2", ref, entry.ID)
+		}
+	}
+
+	// Relative paths resolve from the current directory
+	t.Chdir(dir)
+	entry, err := store.Find("lake.png")
+	if err != nil {
+		t.Fatalf("Find relative path: %v", err)
+	}
+	if entry.ID != "img_2" {
+		t.Errorf("Find relative path = %s, want img_2", entry.ID)
+	}
+}
+
+func TestFindReusedPath(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "lake.png")
+	first, second := []byte("first image"), []byte("second image")
+
+	store := newStore(t)
+	appendEntries(t, store,
+		Entry{ID: "img_1", OutputPath: image, SHA256: sha(first)},
+		Entry{ID: "img_2", OutputPath: image, SHA256: sha(second)},
+	)
+
+	// The entry that saved the image on disk wins, whichever came first
+	for _, tt := range []struct {
+		data []byte
+		want string
+	}{{first, "img_1"}, {second, "img_2"}} {
+		if err := os.WriteFile(image, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := store.Find(image)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if entry.ID != tt.want {
+			t.Errorf("Find = %s, want %s", entry.ID, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(image, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Find(image); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Find edited image = %v, want ErrAmbiguous", err)
+	}
+	if err := os.Remove(image); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Find(image); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Find deleted image = %v, want ErrAmbiguous", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := newStore(t)
+	appendEntries(t, store,
+		Entry{ID: "img_1", Prompt: "Mountain lake at sunrise", OutputPath: "/images/lake.png"},
+		Entry{ID: "img_2", Prompt: "Lake at night", Status: StatusError, Error: "quota exceeded"},
+		Entry{ID: "img_3", Prompt: "Desert at sunrise"},
+	)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"lake", []string{"img_1", "img_2"}},
+		{"SUNRISE lake", []string{"img_1"}},
+		{"quota", []string{"img_2"}},
+		{"lake.png", []string{"img_1"}},
+		{"img_3", []string{"img_3"}},
+		{"forest", nil},
+	}
+	for _, tt := range tests {
+		entries, err := store.Search(tt.query)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.query, err)
+		}
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		if len(ids) != len(tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+				break
+			}
+		}
+	}
+
+	if _, err := store.Search("  "); !errors.Is(err, ErrNoQuery) {
+		t.Errorf("Search of blank query = %v, want ErrNoQuery", err)
+	}
+}
@@ -0,0 +1,119 @@
+package invisible
+
+import (
+	"image"
+	"math"
+)
+
+// blockSize is the side of a DCT block, matching JPEG's 8x8 blocks
+const blockSize = 8
+
+// coefficientPair is a pair of DCT frequencies whose relative magnitude
+// carries one bit. Each basis is precomputed for a whole block.
+type coefficientPair struct {
+	a, b [blockSize * blockSize]float64
+}
+
+var (
+	// lowPair holds the (1,2) and (2,1) frequencies, used on the normalized grid
+	lowPair = newCoefficientPair(1, 2)
+
+	// midPair holds the (2,3) and (3,2) frequencies, used at full resolution
+	// where lower frequencies would be visible
+	midPair = newCoefficientPair(2, 3)
+)
+
+// newCoefficientPair returns the pair of frequencies (u,v) and (v,u)
+func newCoefficientPair(u, v int) coefficientPair {
+	var pair coefficientPair
+	for y := 0; y < blockSize; y++ {
+		for x := 0; x < blockSize; x++ {
+			pair.a[y*blockSize+x] = basis(u, v, x, y)
+			pair.b[y*blockSize+x] = basis(v, u, x, y)
+		}
+	}
+	return pair
+}
+
+// basis returns the orthonormal 8x8 DCT-II basis value for frequency (u,v) at (x,y)
+func basis(u, v, x, y int) float64 {
+	scale := func(k int) float64 {
+		if k == 0 {
+			return math.Sqrt(1.0 / blockSize)
+		}
+		return math.Sqrt(2.0 / blockSize)
+	}
+	return scale(u) * scale(v) *
+		math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*blockSize)) *
+		math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*blockSize))
+}
+
+// separation returns how far the difference between a coefficient pair must
+// move so that its sign carries bit with at least strength of margin
+func separation(c1, c2 float64, bit bool, strength float64) float64 {
+	diff := c1 - c2
+	if bit && diff < strength {
+		return strength - diff
+	}
+	if !bit && diff > -strength {
+		return -strength - diff
+	}
+	return 0
+}
+
+// plane is a single channel of floating point samples
+type plane struct {
+	pix           []float64
+	width, height int
+}
+
+// newPlane returns a zeroed plane
+func newPlane(width, height int) *plane {
+	return &plane{pix: make([]float64, width*height), width: width, height: height}
+}
+
+// luminancePlane returns the JPEG (BT.601) luminance of every pixel, 0-255
+func luminancePlane(img image.Image) *plane {
+	bounds := img.Bounds()
+	p := newPlane(bounds.Dx(), bounds.Dy())
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			p.pix[y*p.width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+
+	return p
+}
+
+// crop returns a copy of the width x height region of p at (x,y)
+func (p *plane) crop(x, y, width, height int) *plane {
+	cropped := newPlane(width, height)
+	for row := 0; row < height; row++ {
+		copy(cropped.pix[row*width:(row+1)*width], p.pix[(y+row)*p.width+x:])
+	}
+	return cropped
+}
+
+// coefficients returns the pair's DCT coefficients for the block at (x,y)
+func (p *plane) coefficients(x, y int, pair *coefficientPair) (c1, c2 float64) {
+	for by := 0; by < blockSize; by++ {
+		row := p.pix[(y+by)*p.width+x:]
+		for bx := 0; bx < blockSize; bx++ {
+			c1 += row[bx] * pair.a[by*blockSize+bx]
+			c2 += row[bx] * pair.b[by*blockSize+bx]
+		}
+	}
+	return c1, c2
+}
+
+// addPair raises the first coefficient and lowers the second of the block at (x,y) by amount
+func (p *plane) addPair(x, y int, pair *coefficientPair, amount float64) {
+	for by := 0; by < blockSize; by++ {
+		row := p.pix[(y+by)*p.width+x:]
+		for bx := 0; bx < blockSize; bx++ {
+			row[bx] += amount * (pair.a[by*blockSize+bx] - pair.b[by*blockSize+bx])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package invisible
+
+import (
+	"math"
+	"math/rand"
+)
+
+// The grid mark is embedded in a fixed-size, resampled copy of the luminance.
+// Because detection resamples to the same grid, it does not depend on the
+// image's resolution and survives resizing, but not cropping.
+const (
+	gridSize   = 512
+	gridBlocks = (gridSize / blockSize) * (gridSize / blockSize)
+
+	// repetitions is how many copies of the frame fit in the grid
+	repetitions = gridBlocks / frameBits
+
+	// gridSeed fixes the pseudo-random spread of bits across the grid
+	gridSeed = 0x1a9e6e
+)
+
+// embedGrid returns the full-resolution luminance change that embeds bits in the grid
+func embedGrid(p *plane, bits []bool, strength float64) *plane {
+	grid := downscale(p, gridSize, gridSize)
+	delta := newPlane(gridSize, gridSize)
+	order := blockOrder()
+
+	for r := 0; r < repetitions; r++ {
+		for i, bit := range bits {
+			x, y := blockOrigin(order[r*frameBits+i])
+			c1, c2 := grid.coefficients(x, y, &lowPair)
+			if change := separation(c1, c2, bit, strength); change != 0 {
+				delta.addPair(x, y, &lowPair, change/2)
+			}
+		}
+	}
+
+	// Spread the grid changes over the full-resolution image
+	return upscale(delta, p.width, p.height)
+}
+
+// detectGrid reads the grid mark with a majority vote over every repetition
+func detectGrid(p *plane) (*Result, bool) {
+	grid := downscale(p, gridSize, gridSize)
+	order := blockOrder()
+
+	bits := make([]bool, frameBits)
+	agreement := 0
+	for i := range bits {
+		votes := 0
+		for r := 0; r < repetitions; r++ {
+			x, y := blockOrigin(order[r*frameBits+i])
+			if c1, c2 := grid.coefficients(x, y, &lowPair); c1 > c2 {
+				votes++
+			}
+		}
+		bits[i] = votes*2 > repetitions
+		agreement += max(votes, repetitions-votes)
+	}
+
+	payload, ok := decodeFrame(bits)
+	if !ok {
+		return nil, false
+	}
+
+	return &Result{
+		Payload:    payload,
+		Confidence: float64(agreement) / float64(frameBits*repetitions),
+	}, true
+}
+
+// blockOrder returns the pseudo-random order bits are spread across grid blocks
+func blockOrder() []int {
+	return rand.New(rand.NewSource(gridSeed)).Perm(gridBlocks)
+}
+
+// blockOrigin returns the top-left grid coordinates of a block
+func blockOrigin(block int) (x, y int) {
+	perRow := gridSize / blockSize
+	return (block % perRow) * blockSize, (block / perRow) * blockSize
+}
+
+// downscale resamples a plane by averaging the source samples under each destination sample
+func downscale(src *plane, width, height int) *plane {
+	dst := newPlane(width, height)
+
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * src.height / height
+		y1 := max((dy+1)*src.height/height, y0+1)
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * src.width / width
+			x1 := max((dx+1)*src.width/width, x0+1)
+
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += src.pix[y*src.width+x]
+				}
+			}
+			dst.pix[dy*width+dx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	return dst
+}
+
+// upscale resamples a plane to a larger size with bilinear interpolation
+func upscale(src *plane, width, height int) *plane {
+	dst := newPlane(width, height)
+
+	for dy := 0; dy < height; dy++ {
+		// Map sample centres between the two sizes
+		sy := (float64(dy)+0.5)*float64(src.height)/float64(height) - 0.5
+		y0 := int(math.Floor(sy))
+		fy := sy - float64(y0)
+		y0, y1 := clampIndex(y0, src.height), clampIndex(y0+1, src.height)
+
+		for dx := 0; dx < width; dx++ {
+			sx := (float64(dx)+0.5)*float64(src.width)/float64(width) - 0.5
+			x0 := int(math.Floor(sx))
+			fx := sx - float64(x0)
+			x0, x1 := clampIndex(x0, src.width), clampIndex(x0+1, src.width)
+
+			top := src.pix[y0*src.width+x0]*(1-fx) + src.pix[y0*src.width+x1]*fx
+			bottom := src.pix[y1*src.width+x0]*(1-fx) + src.pix[y1*src.width+x1]*fx
+			dst.pix[dy*width+dx] = top*(1-fy) + bottom*fy
+		}
+	}
+
+	return dst
+}
+
+// clampIndex clamps an index to [0, size)
+func clampIndex(i, size int) int {
+	return max(0, min(i, size-1))
+}
@@ -0,0 +1,258 @@
+package invisible
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/convert"
+)
+
+// MaxPayloadLength is the maximum payload size in bytes
+const MaxPayloadLength = 32
+
+const (
+	// A frame is a length byte, the zero-padded payload and a CRC-32
+	frameBytes = 1 + MaxPayloadLength + 4
+	frameBits  = frameBytes * 8
+
+	// initialStrength is the starting coefficient separation; it is raised
+	// until the payload survives JPEG recompression
+	initialStrength = 10.0
+	maxAttempts     = 6
+
+	// verifyQuality is the JPEG quality the embedded mark must survive
+	verifyQuality = 75
+)
+
+// Errors returned by Embed and Detect
+var (
+	ErrEmptyPayload   = errors.New("invisible watermark payload is empty")
+	ErrPayloadTooLong = fmt.Errorf("invisible watermark payload must be at most %d bytes", MaxPayloadLength)
+	ErrNotFound       = errors.New("no invisible watermark found")
+	ErrEmbedFailed    = errors.New("failed to embed a recoverable invisible watermark")
+)
+
+// Result describes a detected invisible watermark
+type Result struct {
+	Payload    string  // The embedded payload
+	Confidence float64 // Fraction of repeated bits that agreed with the majority (0.5-1.0)
+}
+
+// ValidatePayload checks that a payload can be embedded
+func ValidatePayload(payload string) error {
+	if payload == "" {
+		return ErrEmptyPayload
+	}
+	if len(payload) > MaxPayloadLength {
+		return fmt.Errorf("%w: got %d", ErrPayloadTooLong, len(payload))
+	}
+	return nil
+}
+
+// Embed hides a short payload (e.g. team ID + generation ID) in the image's
+// luminance via DCT coefficients
+//
+// The payload is embedded twice: once in a resolution-independent grid that
+// survives resizing, and once tiled at full resolution so it survives cropping.
+//
+// Parameters:
+//   - data: the image bytes (PNG, JPEG or WebP)
+//   - payload: up to MaxPayloadLength bytes to embed
+//
+// Returns:
+//   - image bytes in the same format as input, keeping its ICC profile and metadata
+//   - error if embedding fails
+func Embed(data []byte, payload string) ([]byte, error) {
+	if err := ValidatePayload(payload); err != nil {
+		return nil, err
+	}
+
+	img, format, err := convert.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, _, err := EmbedImage(img, data, payload, convert.Options{Format: format})
+	return encoded, err
+}
+
+// EmbedImage embeds a payload into a decoded image and encodes the result,
+// so an edited image is encoded once, in its output format and quality
+//
+// Parameters:
+//   - img: the image to mark
+//   - source: the bytes img was decoded from, whose ICC profile and metadata
+//     are carried over
+//   - payload: up to MaxPayloadLength bytes to embed
+//   - opts: how to encode the result; the payload is verified in this encoding
+//
+// Returns:
+//   - the encoded image bytes
+//   - the format the bytes were encoded in
+//   - error if embedding fails
+func EmbedImage(img image.Image, source []byte, payload string, opts convert.Options) ([]byte, convert.Format, error) {
+	if err := ValidatePayload(payload); err != nil {
+		return nil, "", err
+	}
+
+	original := luminancePlane(img)
+	bits := encodeFrame(payload)
+
+	strength := initialStrength
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		marked := embedBits(img, original, bits, strength)
+
+		encoded, format, err := convert.ConvertImage(marked, source, opts)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Make sure the payload can be read back, including after recompression
+		if verify(encoded, payload) {
+			return encoded, format, nil
+		}
+		strength *= 1.5
+	}
+
+	return nil, "", ErrEmbedFailed
+}
+
+// Detect extracts an invisible watermark from image bytes
+//
+// Parameters:
+//   - data: the image bytes (PNG, JPEG or WebP)
+//
+// Returns:
+//   - the detected payload and confidence
+//   - ErrNotFound if the image carries no readable watermark
+func Detect(data []byte) (*Result, error) {
+	img, _, err := convert.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return DetectImage(img)
+}
+
+// DetectImage extracts an invisible watermark from a decoded image
+func DetectImage(img image.Image) (*Result, error) {
+	p := luminancePlane(img)
+
+	// The grid mark is cheap to read, so try it before searching for tiles
+	if result, ok := detectGrid(p); ok {
+		return result, nil
+	}
+	if result, ok := detectTiled(p); ok {
+		return result, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// embedBits returns a copy of img with both marks embedded at the given strength
+func embedBits(img image.Image, original *plane, bits []bool, strength float64) image.Image {
+	marked := embedGrid(original, bits, strength)
+	for i, v := range original.pix {
+		marked.pix[i] += v
+	}
+	embedTiled(marked, bits, strength)
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < original.height; y++ {
+		for x := 0; x < original.width; x++ {
+			i := y*original.width + x
+			d := marked.pix[i] - original.pix[i]
+
+			// Adding the same amount to every channel shifts luminance by d
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			result.Set(x, y, color.NRGBA{
+				R: clampChannel(float64(c.R) + d),
+				G: clampChannel(float64(c.G) + d),
+				B: clampChannel(float64(c.B) + d),
+				A: c.A,
+			})
+		}
+	}
+
+	return result
+}
+
+// verify checks that both marks can be read from the encoded output and
+// after a JPEG recompression
+func verify(encoded []byte, payload string) bool {
+	img, _, err := convert.Decode(encoded)
+	if err != nil {
+		return false
+	}
+	if result, ok := detectGrid(luminancePlane(img)); !ok || result.Payload != payload {
+		return false
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: verifyQuality}); err != nil {
+		return false
+	}
+	recompressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		return false
+	}
+
+	p := luminancePlane(recompressed)
+	if result, ok := detectGrid(p); !ok || result.Payload != payload {
+		return false
+	}
+	// The tiles were embedded unshifted, so only that alignment needs checking
+	result, ok := decodeTiled(p, 0, 0)
+	return ok && result.Payload == payload
+}
+
+// encodeFrame packs the payload into a fixed-length bit frame
+func encodeFrame(payload string) []bool {
+	frame := make([]byte, frameBytes)
+	frame[0] = byte(len(payload))
+	copy(frame[1:], payload)
+	checksum := crc32.ChecksumIEEE(frame[:1+MaxPayloadLength])
+	frame[frameBytes-4] = byte(checksum >> 24)
+	frame[frameBytes-3] = byte(checksum >> 16)
+	frame[frameBytes-2] = byte(checksum >> 8)
+	frame[frameBytes-1] = byte(checksum)
+
+	bits := make([]bool, frameBits)
+	for i := range bits {
+		bits[i] = frame[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+// decodeFrame unpacks a bit frame and verifies its checksum
+func decodeFrame(bits []bool) (string, bool) {
+	frame := make([]byte, frameBytes)
+	for i, bit := range bits {
+		if bit {
+			frame[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	checksum := uint32(frame[frameBytes-4])<<24 | uint32(frame[frameBytes-3])<<16 |
+		uint32(frame[frameBytes-2])<<8 | uint32(frame[frameBytes-1])
+	if crc32.ChecksumIEEE(frame[:1+MaxPayloadLength]) != checksum {
+		return "", false
+	}
+
+	length := int(frame[0])
+	if length == 0 || length > MaxPayloadLength {
+		return "", false
+	}
+	return string(frame[1 : 1+length]), true
+}
+
+// clampChannel rounds and clamps a color channel to 0-255
+func clampChannel(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
@@ -0,0 +1,129 @@
+package invisible
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const testPayload = "img_test_0001"
+
+// photo returns a deterministic image with gradients, edges and noise, like
+// a photograph
+func photo(width, height int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			noise := rng.Intn(13) - 6
+			r := 50 + 150*x/width + noise
+			g := 70 + 120*y/height + noise
+			b := 110 + noise
+			if (x/64+y/48)%3 == 0 {
+				r, g = r/2, g/2
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), 255})
+		}
+	}
+	return img
+}
+
+// marked returns a PNG of photo(width, height) carrying testPayload
+func marked(t *testing.T, width, height int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, photo(width, height)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Embed(buf.Bytes(), testPayload)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// recompress returns img after a JPEG round trip at the given quality
+func recompress(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func checkDetect(t *testing.T, img image.Image) {
+	t.Helper()
+	result, err := DetectImage(img)
+	if err != nil {
+		t.Fatalf("DetectImage: %v", err)
+	}
+	if result.Payload != testPayload {
+		t.Fatalf("payload = %q, want %q", result.Payload, testPayload)
+	}
+}
+
+func TestDetectAfterJPEG(t *testing.T) {
+	checkDetect(t, recompress(t, marked(t, 640, 480), 75))
+}
+
+func TestDetectAfterDownscale(t *testing.T) {
+	img := marked(t, 800, 600)
+	half := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	xdraw.CatmullRom.Scale(half, half.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	checkDetect(t, half)
+}
+
+func TestDetectAfterCrop(t *testing.T) {
+	// The crop is off the 8-pixel block grid and the tile grid, and removes
+	// enough of the image to break the grid mark. It keeps four by two whole
+	// tiles, which after JPEG recompression is about the least that works.
+	img := recompress(t, marked(t, 800, 600), 75)
+	cropped := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(image.Rect(101, 99, 101+600, 99+400))
+
+	if _, ok := detectGrid(luminancePlane(cropped)); ok {
+		t.Fatal("grid mark survived the crop, so the tiled mark is untested")
+	}
+	checkDetect(t, cropped)
+}
+
+func TestDetectUnmarked(t *testing.T) {
+	for _, img := range []image.Image{photo(640, 480), recompress(t, photo(640, 480), 75)} {
+		if result, err := DetectImage(img); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DetectImage = %+v, %v, want ErrNotFound", result, err)
+		}
+	}
+}
+
+func TestDetectLargeCrop(t *testing.T) {
+	// Tiles are only searched for in the centre of a large image
+	if testing.Short() {
+		t.Skip("large image")
+	}
+	img := recompress(t, marked(t, 1600, 1500), 75)
+	cropped := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(image.Rect(301, 277, 1600, 1500))
+
+	if _, ok := detectGrid(luminancePlane(cropped)); ok {
+		t.Fatal("grid mark survived the crop, so the tiled mark is untested")
+	}
+	checkDetect(t, cropped)
+}
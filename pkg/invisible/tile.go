@@ -0,0 +1,100 @@
+package invisible
+
+// The tiled mark repeats the frame in a fixed pattern of full-resolution
+// blocks, one bit per block. Any crop that keeps a few whole tiles still
+// carries the payload; detection searches every block alignment and tile
+// offset to find it. It does not survive resizing, which the grid mark covers.
+const (
+	tileColumns = 17
+	tileRows    = 18
+	tileCells   = tileColumns * tileRows
+
+	// searchTiles bounds the search to the centre of the image, this many
+	// tiles across and down, so detection time does not grow with its size
+	searchTiles = 8
+)
+
+// embedTiled embeds bits into the full-resolution plane in place
+func embedTiled(p *plane, bits []bool, strength float64) {
+	for j := 0; (j+1)*blockSize <= p.height; j++ {
+		for i := 0; (i+1)*blockSize <= p.width; i++ {
+			cell := (j%tileRows)*tileColumns + i%tileColumns
+			if cell >= frameBits {
+				continue // Spare cells are left untouched
+			}
+
+			x, y := i*blockSize, j*blockSize
+			c1, c2 := p.coefficients(x, y, &midPair)
+			if change := separation(c1, c2, bits[cell], strength); change != 0 {
+				p.addPair(x, y, &midPair, change/2)
+			}
+		}
+	}
+}
+
+// detectTiled searches every block alignment for the tiled mark
+func detectTiled(p *plane) (*Result, bool) {
+	// Every tile carries the whole frame, so a window of a few tiles has as
+	// many votes as a clean copy needs
+	width := min(p.width, searchTiles*tileColumns*blockSize)
+	height := min(p.height, searchTiles*tileRows*blockSize)
+	p = p.crop((p.width-width)/2, (p.height-height)/2, width, height)
+
+	for ay := 0; ay < blockSize; ay++ {
+		for ax := 0; ax < blockSize; ax++ {
+			if result, ok := decodeTiled(p, ax, ay); ok {
+				return result, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// decodeTiled reads the tiled mark with blocks aligned at (ax,ay), trying every tile offset
+func decodeTiled(p *plane, ax, ay int) (*Result, bool) {
+	// Blocks at the same position within a tile carry the same bit, so
+	// collect their votes once and reuse them for every offset
+	var votes, counts [tileCells]int
+	for j := 0; ay+(j+1)*blockSize <= p.height; j++ {
+		for i := 0; ax+(i+1)*blockSize <= p.width; i++ {
+			class := (j%tileRows)*tileColumns + i%tileColumns
+			counts[class]++
+			if c1, c2 := p.coefficients(ax+i*blockSize, ay+j*blockSize, &midPair); c1 > c2 {
+				votes[class]++
+			}
+		}
+	}
+
+	bits := make([]bool, frameBits)
+	for ty := 0; ty < tileRows; ty++ {
+		for tx := 0; tx < tileColumns; tx++ {
+			agreement, total := 0, 0
+			complete := true
+			for cell := range bits {
+				// Block column i holds cell column (i+tx) mod tileColumns
+				column := (cell%tileColumns - tx + tileColumns) % tileColumns
+				row := (cell/tileColumns - ty + tileRows) % tileRows
+				class := row*tileColumns + column
+				if counts[class] == 0 {
+					complete = false
+					break
+				}
+				bits[cell] = votes[class]*2 > counts[class]
+				agreement += max(votes[class], counts[class]-votes[class])
+				total += counts[class]
+			}
+			if !complete {
+				return nil, false // The image is smaller than a tile
+			}
+
+			if payload, ok := decodeFrame(bits); ok {
+				return &Result{
+					Payload:    payload,
+					Confidence: float64(agreement) / float64(total),
+				}, true
+			}
+		}
+	}
+
+	return nil, false
+}
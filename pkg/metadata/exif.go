@@ -0,0 +1,184 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+)
+
+// exifHeader prefixes EXIF data in a JPEG APP1 segment
+var exifHeader = []byte("Exif\x00\x00")
+
+// IFD0 tags written by Embed
+const (
+	tagImageDescription = 0x010E
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagOrientation      = 0x0112
+)
+
+// exifDateTime is the EXIF date format
+const exifDateTime = "2006:01:02 15:04:05"
+
+// TIFF field types
+const (
+	typeASCII = 2 // NUL-terminated string
+	typeShort = 3 // 16-bit unsigned integer
+)
+
+// buildExif returns a big-endian TIFF structure with the metadata as IFD0 strings
+// The provider and model are written as the camera make and model.
+func buildExif(md Metadata) []byte {
+	fields := map[uint16]string{
+		tagImageDescription: md.Prompt,
+		tagMake:             md.Provider,
+		tagModel:            md.Model,
+		tagSoftware:         md.Software,
+		tagDateTime:         md.CreatedAt.UTC().Format(exifDateTime),
+	}
+
+	var tags []uint16
+	for tag, value := range fields {
+		if value != "" {
+			tags = append(tags, tag)
+		}
+	}
+	// IFD entries must be sorted by tag
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	// Header, entry count, entries and the next-IFD offset come before the values
+	const headerSize = 8
+	dataOffset := headerSize + 2 + 12*len(tags) + 4
+
+	var ifd, values bytes.Buffer
+	binary.Write(&ifd, binary.BigEndian, uint16(len(tags)))
+	for _, tag := range tags {
+		value := append([]byte(fields[tag]), 0)
+		binary.Write(&ifd, binary.BigEndian, tag)
+		binary.Write(&ifd, binary.BigEndian, uint16(typeASCII))
+		binary.Write(&ifd, binary.BigEndian, uint32(len(value)))
+
+		if len(value) <= 4 {
+			// Short values are stored in the offset field itself
+			inline := make([]byte, 4)
+			copy(inline, value)
+			ifd.Write(inline)
+			continue
+		}
+		binary.Write(&ifd, binary.BigEndian, uint32(dataOffset+values.Len()))
+		values.Write(value)
+		if values.Len()%2 == 1 {
+			values.WriteByte(0) // Keep offsets word-aligned
+		}
+	}
+	binary.Write(&ifd, binary.BigEndian, uint32(0))
+
+	var buf bytes.Buffer
+	buf.WriteString("MM")
+	binary.Write(&buf, binary.BigEndian, uint16(42))
+	binary.Write(&buf, binary.BigEndian, uint32(headerSize))
+	buf.Write(ifd.Bytes())
+	buf.Write(values.Bytes())
+	return buf.Bytes()
+}
+
+// parseExif reads the IFD0 strings written by buildExif from a TIFF structure
+// It returns nil if the structure carries none of them.
+func parseExif(data []byte) *Metadata {
+	ifd := readIFD0(data)
+	if ifd == nil {
+		return nil
+	}
+
+	if ifd.ascii(tagImageDescription) == "" && ifd.ascii(tagSoftware) == "" {
+		return nil
+	}
+
+	md := &Metadata{
+		Prompt:   ifd.ascii(tagImageDescription),
+		Provider: ifd.ascii(tagMake),
+		Model:    ifd.ascii(tagModel),
+		Software: ifd.ascii(tagSoftware),
+	}
+	if created, err := time.Parse(exifDateTime, ifd.ascii(tagDateTime)); err == nil {
+		md.CreatedAt = created
+	}
+	return md
+}
+
+// isOwnExif reports whether a TIFF structure was written by Embed
+func isOwnExif(data []byte) bool {
+	ifd := readIFD0(data)
+	return ifd == nil || ifd.ascii(tagSoftware) == Software
+}
+
+// ifd0 gives access to the entries of the first IFD of a TIFF structure
+type ifd0 struct {
+	order   binary.ByteOrder
+	data    []byte
+	entries map[uint16]int // Offset of each tag's 12-byte entry
+}
+
+// readIFD0 parses the first IFD of a TIFF structure, with or without the
+// JPEG "Exif" header. It returns nil if the structure is malformed.
+func readIFD0(data []byte) *ifd0 {
+	data = bytes.TrimPrefix(data, exifHeader)
+	if len(data) < 8 {
+		return nil
+	}
+
+	ifd := &ifd0{data: data, entries: map[uint16]int{}}
+	switch string(data[:2]) {
+	case "MM":
+		ifd.order = binary.BigEndian
+	case "II":
+		ifd.order = binary.LittleEndian
+	default:
+		return nil
+	}
+
+	offset := int(ifd.order.Uint32(data[4:]))
+	if offset < 8 || offset+2 > len(data) {
+		return nil
+	}
+	count := int(ifd.order.Uint16(data[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + 12*i
+		if entry+12 > len(data) {
+			break
+		}
+		ifd.entries[ifd.order.Uint16(data[entry:])] = entry
+	}
+
+	return ifd
+}
+
+// ascii returns a string tag, or "" if it is missing
+func (d *ifd0) ascii(tag uint16) string {
+	entry, ok := d.entries[tag]
+	if !ok || d.order.Uint16(d.data[entry+2:]) != typeASCII {
+		return ""
+	}
+
+	size := int(d.order.Uint32(d.data[entry+4:]))
+	start := entry + 8
+	if size > 4 {
+		start = int(d.order.Uint32(d.data[entry+8:]))
+	}
+	if size == 0 || start < 0 || start+size > len(d.data) {
+		return ""
+	}
+	return string(bytes.TrimRight(d.data[start:start+size], "\x00"))
+}
+
+// short returns a single SHORT tag
+func (d *ifd0) short(tag uint16) (uint16, bool) {
+	entry, ok := d.entries[tag]
+	if !ok || d.order.Uint16(d.data[entry+2:]) != typeShort || d.order.Uint32(d.data[entry+4:]) != 1 {
+		return 0, false
+	}
+	return d.order.Uint16(d.data[entry+8:]), true
+}
@@ -0,0 +1,157 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// xmpHeader prefixes XMP data in a JPEG APP1 segment
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// JPEG markers
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+)
+
+// maxSegmentData is the largest payload a JPEG segment can hold
+const maxSegmentData = 0xFFFF - 2
+
+// jpegSegment is a marker segment preceding the image scan
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// readJPEGSegments splits a JPEG file into the segments before the first
+// scan and the remaining bytes (scan data onwards), which are kept verbatim
+func readJPEGSegments(data []byte) ([]jpegSegment, []byte, error) {
+	var segments []jpegSegment
+	pos := 2 // Skip SOI
+
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, nil, fmt.Errorf("%w: invalid JPEG marker", ErrMalformedImage)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // Fill byte
+			continue
+		}
+		if marker == markerSOS {
+			return segments, data[pos:], nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, nil, fmt.Errorf("%w: truncated JPEG segment", ErrMalformedImage)
+		}
+		segments = append(segments, jpegSegment{marker: marker, data: data[pos+4 : pos+2+length]})
+		pos += 2 + length
+	}
+}
+
+// writeJPEGSegments joins segments and the scan data into a JPEG file
+func writeJPEGSegments(segments []jpegSegment, scan []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, markerSOI})
+	for _, segment := range segments {
+		buf.Write([]byte{0xFF, segment.marker})
+		binary.Write(&buf, binary.BigEndian, uint16(len(segment.data)+2))
+		buf.Write(segment.data)
+	}
+	buf.Write(scan)
+	return buf.Bytes()
+}
+
+// isExifSegment reports whether a segment holds EXIF data
+func isExifSegment(segment jpegSegment) bool {
+	return segment.marker == markerAPP1 && bytes.HasPrefix(segment.data, exifHeader)
+}
+
+// isXMPSegment reports whether a segment holds an XMP packet
+func isXMPSegment(segment jpegSegment) bool {
+	return segment.marker == markerAPP1 && bytes.HasPrefix(segment.data, xmpHeader)
+}
+
+// embedJPEG merges the metadata into the XMP segment, keeping properties
+// from other sources. EXIF from another source, such as a camera or the
+// provider, is kept since it holds the orientation; otherwise it is replaced.
+func embedJPEG(data []byte, md Metadata) ([]byte, error) {
+	segments, scan, err := readJPEGSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var foreignExif *jpegSegment
+	var existing []byte
+	for i, segment := range segments {
+		if isExifSegment(segment) && !isOwnExif(segment.data) && foreignExif == nil {
+			foreignExif = &segments[i]
+		}
+		if isXMPSegment(segment) && existing == nil {
+			existing = segment.data[len(xmpHeader):]
+		}
+	}
+
+	packet, err := buildXMP(md)
+	if err != nil {
+		return nil, err
+	}
+	packet = mergeXMP(existing, packet)
+	exif := append(append([]byte{}, exifHeader...), buildExif(md)...)
+	xmp := append(append([]byte{}, xmpHeader...), packet...)
+	if len(exif) > maxSegmentData || len(xmp) > maxSegmentData {
+		return nil, fmt.Errorf("%w: JPEG metadata segments are limited to %d bytes", ErrTooLarge, maxSegmentData)
+	}
+
+	// JFIF (APP0) segments must stay first
+	var result []jpegSegment
+	i := 0
+	for ; i < len(segments) && segments[i].marker == markerAPP0; i++ {
+		result = append(result, segments[i])
+	}
+	if foreignExif != nil {
+		result = append(result, *foreignExif)
+	} else {
+		result = append(result, jpegSegment{marker: markerAPP1, data: exif})
+	}
+	result = append(result, jpegSegment{marker: markerAPP1, data: xmp})
+	for _, segment := range segments[i:] {
+		if isExifSegment(segment) || isXMPSegment(segment) {
+			continue // Replaced above
+		}
+		result = append(result, segment)
+	}
+
+	return writeJPEGSegments(result, scan), nil
+}
+
+// readJPEG reads the XMP packet, falling back to EXIF
+func readJPEG(data []byte) (*Metadata, error) {
+	segments, _, err := readJPEGSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		if isXMPSegment(segment) {
+			md, err := parseXMP(segment.data[len(xmpHeader):])
+			if md != nil || err != nil {
+				return md, err
+			}
+		}
+	}
+	for _, segment := range segments {
+		if isExifSegment(segment) {
+			if md := parseExif(segment.data); md != nil {
+				return md, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,173 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Containers for a signed manifest. They are private to img-gen so that
+// readers expecting standard C2PA JUMBF boxes skip them.
+const (
+	// pngManifestChunk is ancillary, private and unsafe to copy, since the
+	// manifest is bound to the exact image bytes
+	pngManifestChunk  = "igCR"
+	webpManifestChunk = "IGCR"
+	markerAPP10       = 0xEA
+)
+
+// jpegManifestHeader prefixes the manifest in a JPEG APP10 segment
+var jpegManifestHeader = []byte("img-gen manifest\x00")
+
+// EmbedManifest adds a signed manifest to an image returned by WithoutManifest
+//
+// Parameters:
+//   - base: the image without a manifest, as returned by WithoutManifest
+//   - manifest: the serialized manifest
+//
+// Returns:
+//   - image bytes with the manifest embedded; removing it with WithoutManifest
+//     yields base again
+//   - error if the format is unsupported or the manifest does not fit
+func EmbedManifest(base, manifest []byte) ([]byte, error) {
+	switch sniff(base) {
+	case formatPNG:
+		chunks, err := readPNGChunks(base)
+		if err != nil {
+			return nil, err
+		}
+		// Insert just before IEND
+		last := len(chunks) - 1
+		chunks = append(chunks[:last:last], pngChunk{typ: pngManifestChunk, data: manifest}, chunks[last])
+		return writePNGChunks(chunks), nil
+
+	case formatJPEG:
+		segments, scan, err := readJPEGSegments(base)
+		if err != nil {
+			return nil, err
+		}
+		data := append(append([]byte{}, jpegManifestHeader...), manifest...)
+		if len(data) > maxSegmentData {
+			return nil, fmt.Errorf("%w: JPEG manifest is limited to %d bytes", ErrTooLarge, maxSegmentData-len(jpegManifestHeader))
+		}
+		// Append after the other segments, just before the scan
+		segments = append(segments, jpegSegment{marker: markerAPP10, data: data})
+		return writeJPEGSegments(segments, scan), nil
+
+	case formatWebP:
+		chunks, err := readWebPChunks(base)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, webpChunk{fourCC: webpManifestChunk, data: manifest})
+		return writeWebPChunks(chunks), nil
+
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// WithoutManifest returns the image with any manifest removed, in the
+// canonical layout EmbedManifest builds on. The result is what a manifest's
+// content hash covers. Simple WebP files are converted to the extended format
+// so that the manifest chunk can be added.
+func WithoutManifest(data []byte) ([]byte, error) {
+	switch sniff(data) {
+	case formatPNG:
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		var kept []pngChunk
+		for _, chunk := range chunks {
+			if chunk.typ != pngManifestChunk {
+				kept = append(kept, chunk)
+			}
+		}
+		return writePNGChunks(kept), nil
+
+	case formatJPEG:
+		segments, scan, err := readJPEGSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		var kept []jpegSegment
+		for _, segment := range segments {
+			if !isManifestSegment(segment) {
+				kept = append(kept, segment)
+			}
+		}
+		return writeJPEGSegments(kept, scan), nil
+
+	case formatWebP:
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		if chunks[0].fourCC != "VP8X" {
+			header, err := extendedHeader(chunks[0])
+			if err != nil {
+				return nil, err
+			}
+			chunks = append([]webpChunk{header}, chunks...)
+		}
+		var kept []webpChunk
+		for _, chunk := range chunks {
+			if chunk.fourCC != webpManifestChunk {
+				kept = append(kept, chunk)
+			}
+		}
+		return writeWebPChunks(kept), nil
+
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// ReadManifest returns the serialized manifest embedded in an image
+// It returns ErrNoManifest if the image has no manifest.
+func ReadManifest(data []byte) ([]byte, error) {
+	switch sniff(data) {
+	case formatPNG:
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			if chunk.typ == pngManifestChunk {
+				return chunk.data, nil
+			}
+		}
+
+	case formatJPEG:
+		segments, _, err := readJPEGSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments {
+			if isManifestSegment(segment) {
+				return segment.data[len(jpegManifestHeader):], nil
+			}
+		}
+
+	case formatWebP:
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			if chunk.fourCC == webpManifestChunk {
+				return chunk.data, nil
+			}
+		}
+
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return nil, ErrNoManifest
+}
+
+// isManifestSegment reports whether a JPEG segment holds a manifest
+func isManifestSegment(segment jpegSegment) bool {
+	return segment.marker == markerAPP10 && bytes.HasPrefix(segment.data, jpegManifestHeader)
+}
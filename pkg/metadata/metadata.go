@@ -0,0 +1,157 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Software is the name written as the creating application
+const Software = "img-gen"
+
+// DigitalSourceTrainedAlgorithmicMedia is the IPTC digital source type for
+// content created by a generative AI model, written to every image's XMP
+const DigitalSourceTrainedAlgorithmicMedia = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+
+// Metadata describes how an image was generated
+type Metadata struct {
+	Prompt             string          `json:"prompt"`
+	Provider           string          `json:"provider,omitempty"`
+	Model              string          `json:"model,omitempty"`
+	AspectRatio        string          `json:"aspect_ratio,omitempty"`
+	ImageSize          string          `json:"image_size,omitempty"`
+	GenerationID       string          `json:"generation_id,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	Software           string          `json:"software,omitempty"`
+	Watermarks         json.RawMessage `json:"watermarks,omitempty"`          // Watermark layers as JSON
+	InvisibleWatermark string          `json:"invisible_watermark,omitempty"` // Invisible watermark payload
+}
+
+// Errors returned by Embed, Read and the manifest functions
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format for metadata (supported: png, jpeg, webp)")
+	ErrMalformedImage    = errors.New("malformed image data")
+	ErrNotFound          = errors.New("no generation metadata found")
+	ErrNoManifest        = errors.New("no manifest found")
+	ErrTooLarge          = errors.New("metadata is too large")
+)
+
+// format identifies an image container
+type format int
+
+const (
+	formatUnknown format = iota
+	formatPNG
+	formatJPEG
+	formatWebP
+)
+
+// sniff identifies the container of encoded image data from its signature
+func sniff(data []byte) format {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return formatPNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return formatJPEG
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return formatWebP
+	default:
+		return formatUnknown
+	}
+}
+
+// Embed writes generation metadata into encoded image data without re-encoding
+// the pixels. PNG images get tEXt/iTXt chunks and XMP; JPEG and WebP images
+// get XMP and EXIF. The XMP declares the image AI-generated with the IPTC
+// digital source type. Existing metadata written by this package is replaced.
+//
+// Parameters:
+//   - data: the encoded image (PNG, JPEG or WebP)
+//   - md: the metadata to embed
+//
+// Returns:
+//   - image bytes with the metadata embedded
+//   - error if the format is unsupported or the image is malformed
+func Embed(data []byte, md Metadata) ([]byte, error) {
+	if md.Software == "" {
+		md.Software = Software
+	}
+
+	switch sniff(data) {
+	case formatPNG:
+		return embedPNG(data, md)
+	case formatJPEG:
+		return embedJPEG(data, md)
+	case formatWebP:
+		return embedWebP(data, md)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// Read extracts generation metadata from encoded image data
+//
+// Parameters:
+//   - data: the encoded image (PNG, JPEG or WebP)
+//
+// Returns:
+//   - the embedded metadata; fields come from standard tags (PNG text,
+//     EXIF) when the image has no img-gen record
+//   - ErrNotFound if the image carries no generation metadata
+func Read(data []byte) (*Metadata, error) {
+	var md *Metadata
+	var err error
+
+	switch sniff(data) {
+	case formatPNG:
+		md, err = readPNG(data)
+	case formatJPEG:
+		md, err = readJPEG(data)
+	case formatWebP:
+		md, err = readWebP(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		return nil, ErrNotFound
+	}
+	return md, nil
+}
+
+// source describes the provider and model, e.g. "nano-banana-pro (gemini-3-pro-image-preview)"
+func (m Metadata) source() string {
+	if m.Model == "" {
+		return m.Provider
+	}
+	return fmt.Sprintf("%s (%s)", m.Provider, m.Model)
+}
+
+// setSource parses a description written by source
+func (m *Metadata) setSource(source string) {
+	provider, model, found := strings.Cut(source, " (")
+	m.Provider = provider
+	if found {
+		m.Model = strings.TrimSuffix(model, ")")
+	}
+}
+
+// record returns the JSON form of the metadata stored in img-gen's own tag
+func record(md Metadata) ([]byte, error) {
+	return json.Marshal(md)
+}
+
+// parseRecord parses img-gen's own tag
+func parseRecord(data []byte) (*Metadata, error) {
+	var md Metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("%w: invalid img-gen record: %v", ErrMalformedImage, err)
+	}
+	return &md, nil
+}
@@ -0,0 +1,268 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// testImages returns a small image encoded in every supported format
+func testImages(t *testing.T) map[string][]byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{A: 255})
+
+	images := map[string][]byte{}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	images["png"] = bytes.Clone(buf.Bytes())
+	buf.Reset()
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	images["jpeg"] = bytes.Clone(buf.Bytes())
+	buf.Reset()
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	images["webp"] = bytes.Clone(buf.Bytes())
+	return images
+}
+
+var testMetadata = Metadata{
+	Prompt:    "A lighthouse at dusk",
+	Provider:  "test-provider",
+	Model:     "test-model",
+	CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestEmbedRead(t *testing.T) {
+	for format, data := range testImages(t) {
+		t.Run(format, func(t *testing.T) {
+			embedded, err := Embed(data, testMetadata)
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			md, err := Read(embedded)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if md.Prompt != testMetadata.Prompt || md.Model != testMetadata.Model || !md.CreatedAt.Equal(testMetadata.CreatedAt) {
+				t.Errorf("Read = %+v", md)
+			}
+		})
+	}
+}
+
+func TestEmbedDigitalSourceType(t *testing.T) {
+	want := "<Iptc4xmpExt:DigitalSourceType>" + DigitalSourceTrainedAlgorithmicMedia + "</Iptc4xmpExt:DigitalSourceType>"
+	for format, data := range testImages(t) {
+		t.Run(format, func(t *testing.T) {
+			embedded, err := Embed(data, testMetadata)
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			carried, err := readAncillary(embedded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(carried.xmp), want) {
+				t.Errorf("XMP does not declare the digital source type:\n%s", carried.xmp)
+			}
+		})
+	}
+}
+
+// foreignXMP is an XMP packet written by another application
+const foreignXMP = `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmp:CreatorTool="Photoshop"
+    xmp:Rating="5">
+   <photoshop:Credit>Acme Studio</photoshop:Credit>
+   <dc:description><rdf:Alt><rdf:li xml:lang="x-default">Old caption</rdf:li></rdf:Alt></dc:description>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// withXMP returns a JPEG image with an XMP packet
+func withXMP(t *testing.T, packet string) []byte {
+	t.Helper()
+	segments, scan, err := readJPEGSegments(testImages(t)["jpeg"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp := jpegSegment{marker: markerAPP1, data: append(append([]byte{}, xmpHeader...), packet...)}
+	return writeJPEGSegments(append([]jpegSegment{xmp}, segments...), scan)
+}
+
+// xmpOf returns the XMP packet of an image, checking it is well-formed
+func xmpOf(t *testing.T, data []byte) string {
+	t.Helper()
+	carried, err := readAncillary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(carried.xmp))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("XMP is not well-formed: %v\n%s", err, carried.xmp)
+		}
+	}
+	return string(carried.xmp)
+}
+
+func TestEmbedMergesXMP(t *testing.T) {
+	embedded, err := Embed(withXMP(t, foreignXMP), testMetadata)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	packet := xmpOf(t, embedded)
+	for _, want := range []string{"<photoshop:Credit>Acme Studio</photoshop:Credit>", `xmp:Rating="5"`, testMetadata.Prompt} {
+		if !strings.Contains(packet, want) {
+			t.Errorf("merged XMP lacks %s:\n%s", want, packet)
+		}
+	}
+	// Properties img-gen writes replace the existing ones
+	for _, unwanted := range []string{"Photoshop", "Old caption"} {
+		if strings.Contains(packet, unwanted) {
+			t.Errorf("merged XMP still has %s:\n%s", unwanted, packet)
+		}
+	}
+
+	md, err := Read(embedded)
+	if err != nil || md.Prompt != testMetadata.Prompt {
+		t.Errorf("Read = %+v, %v", md, err)
+	}
+
+	// Embedding again replaces img-gen's description instead of adding one
+	again, err := Embed(embedded, testMetadata)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if !bytes.Equal(again, embedded) {
+		t.Errorf("embedding twice changed the XMP:\n%s", xmpOf(t, again))
+	}
+}
+
+func TestEmbedMergesXMPInEveryFormat(t *testing.T) {
+	source := withXMP(t, foreignXMP)
+	for format, data := range testImages(t) {
+		t.Run(format, func(t *testing.T) {
+			// Conversion carries the XMP over, then Embed merges into it
+			preserved, err := Preserve(source, data)
+			if err != nil {
+				t.Fatalf("Preserve: %v", err)
+			}
+			embedded, err := Embed(preserved, testMetadata)
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			if packet := xmpOf(t, embedded); !strings.Contains(packet, "Acme Studio") || !strings.Contains(packet, testMetadata.Prompt) {
+				t.Errorf("XMP = %s", packet)
+			}
+		})
+	}
+}
+
+func TestPreserveAdobeSegment(t *testing.T) {
+	segments, scan, err := readJPEGSegments(testImages(t)["jpeg"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An Adobe segment declaring untransformed (RGB) components
+	adobe := jpegSegment{marker: markerAPP14, data: []byte("Adobe\x00\x64\x00\x00\x00\x00\x00")}
+	source := writeJPEGSegments(append([]jpegSegment{adobe}, segments...), scan)
+
+	preserved, err := Preserve(source, testImages(t)["jpeg"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, _, err = readJPEGSegments(preserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, segment := range segments {
+		if isAdobeSegment(segment) {
+			count++
+			if segment.data[11] != 1 {
+				t.Errorf("transform = %d, want 1 (YCbCr) for Go's encoder", segment.data[11])
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("%d Adobe segments, want 1", count)
+	}
+}
+
+func TestPreserveC2PA(t *testing.T) {
+	// A manifest store too large for one JPEG segment
+	store := make([]byte, 150000)
+	binary.BigEndian.PutUint32(store, uint32(len(store)))
+	copy(store[4:], "jumb")
+	for i := 8; i < len(store); i++ {
+		store[i] = byte(i * 7)
+	}
+
+	images := testImages(t)
+	sources := map[string][]byte{}
+	chunks, err := readPNGChunks(images["png"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources["png"] = writePNGChunks(append([]pngChunk{chunks[0], {typ: pngC2PAChunk, data: store}}, chunks[1:]...))
+	segments, scan, err := readJPEGSegments(images["jpeg"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := splitJUMBFSegments(store)
+	if len(parts) < 3 {
+		t.Fatalf("store split into %d segments, want at least 3", len(parts))
+	}
+	sources["jpeg"] = writeJPEGSegments(append(segments, parts...), scan)
+	webpChunks, err := readWebPChunks(images["webp"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources["webp"] = writeWebPChunks(append(webpChunks, webpChunk{fourCC: webpC2PAChunk, data: store}))
+
+	for from, source := range sources {
+		for to, dst := range images {
+			preserved, err := Preserve(source, dst)
+			if err != nil {
+				t.Fatalf("%s to %s: %v", from, to, err)
+			}
+			carried, err := readAncillary(preserved)
+			if err != nil {
+				t.Fatalf("%s to %s: %v", from, to, err)
+			}
+			if !bytes.Equal(carried.c2pa, store) {
+				t.Errorf("%s to %s: manifest store not carried over (%d bytes)", from, to, len(carried.c2pa))
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PNG text keywords written by Embed. The standard keywords are understood
+// by most viewers; recordKeyword holds the complete metadata as JSON.
+const (
+	keywordDescription  = "Description"
+	keywordSoftware     = "Software"
+	keywordCreationTime = "Creation Time"
+	keywordSource       = "Source"
+	recordKeyword       = "img-gen"
+)
+
+// pngChunk is a single PNG chunk
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunks splits a PNG file into chunks, stopping at IEND
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	rest := data[len(pngSignature):]
+
+	for len(rest) >= 12 {
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length)+12 > uint64(len(rest)) {
+			return nil, fmt.Errorf("%w: truncated PNG chunk", ErrMalformedImage)
+		}
+		chunk := pngChunk{typ: string(rest[4:8]), data: rest[8 : 8+length]}
+		chunks = append(chunks, chunk)
+		rest = rest[12+length:]
+
+		if chunk.typ == "IEND" {
+			return chunks, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: missing PNG IEND chunk", ErrMalformedImage)
+}
+
+// writePNGChunks joins chunks into a PNG file
+func writePNGChunks(chunks []pngChunk) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	for _, chunk := range chunks {
+		binary.Write(&buf, binary.BigEndian, uint32(len(chunk.data)))
+		crc := crc32.NewIEEE()
+		io.WriteString(crc, chunk.typ)
+		crc.Write(chunk.data)
+
+		buf.WriteString(chunk.typ)
+		buf.Write(chunk.data)
+		binary.Write(&buf, binary.BigEndian, crc.Sum32())
+	}
+
+	return buf.Bytes()
+}
+
+// embedPNG replaces the text chunks written by Embed, merges the metadata
+// into the XMP chunk and inserts them after IHDR
+func embedPNG(data []byte, md Metadata) ([]byte, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return nil, fmt.Errorf("%w: PNG does not start with IHDR", ErrMalformedImage)
+	}
+
+	rec, err := record(md)
+	if err != nil {
+		return nil, err
+	}
+	packet, err := buildXMP(md)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks[1:] {
+		if keyword, value, ok := parseTextChunk(chunk); ok && keyword == xmpKeyword {
+			packet = mergeXMP([]byte(value), packet)
+			break
+		}
+	}
+
+	text := []pngChunk{
+		textChunk(keywordDescription, md.Prompt),
+		textChunk(keywordSoftware, md.Software),
+		textChunk(keywordCreationTime, md.CreatedAt.Format(time.RFC1123Z)),
+	}
+	if source := md.source(); source != "" {
+		text = append(text, textChunk(keywordSource, source))
+	}
+	text = append(text, textChunk(recordKeyword, string(rec)), textChunk(xmpKeyword, string(packet)))
+
+	result := []pngChunk{chunks[0]}
+	result = append(result, text...)
+	for _, chunk := range chunks[1:] {
+		if keyword, _, ok := parseTextChunk(chunk); ok && isOwnKeyword(keyword) {
+			continue // Replaced above
+		}
+		result = append(result, chunk)
+	}
+
+	return writePNGChunks(result), nil
+}
+
+// readPNG reads the img-gen record, falling back to the standard text keywords
+func readPNG(data []byte) (*Metadata, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	text := map[string]string{}
+	for _, chunk := range chunks {
+		if keyword, value, ok := parseTextChunk(chunk); ok {
+			text[keyword] = value
+		}
+	}
+
+	if rec, ok := text[recordKeyword]; ok {
+		return parseRecord([]byte(rec))
+	}
+	if text[keywordDescription] == "" && text[keywordSoftware] == "" {
+		return nil, nil
+	}
+
+	md := &Metadata{
+		Prompt:   text[keywordDescription],
+		Software: text[keywordSoftware],
+	}
+	md.setSource(text[keywordSource])
+	if created, err := time.Parse(time.RFC1123Z, text[keywordCreationTime]); err == nil {
+		md.CreatedAt = created
+	}
+	return md, nil
+}
+
+// isOwnKeyword reports whether Embed writes the keyword
+func isOwnKeyword(keyword string) bool {
+	switch keyword {
+	case keywordDescription, keywordSoftware, keywordCreationTime, keywordSource, recordKeyword, xmpKeyword:
+		return true
+	}
+	return false
+}
+
+// textChunk returns a tEXt chunk for ASCII values and an iTXt (UTF-8) chunk otherwise
+func textChunk(keyword, value string) pngChunk {
+	if isASCII(value) {
+		return pngChunk{typ: "tEXt", data: []byte(keyword + "\x00" + value)}
+	}
+
+	// keyword, compression flag and method, empty language tag and translated keyword
+	return pngChunk{typ: "iTXt", data: []byte(keyword + "\x00\x00\x00\x00\x00" + value)}
+}
+
+// parseTextChunk returns the keyword and value of a tEXt, zTXt or iTXt chunk
+func parseTextChunk(chunk pngChunk) (keyword, value string, ok bool) {
+	keywordBytes, rest, found := bytes.Cut(chunk.data, []byte{0})
+	if !found {
+		return "", "", false
+	}
+	keyword = string(keywordBytes)
+
+	switch chunk.typ {
+	case "tEXt":
+		return keyword, latin1ToUTF8(rest), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflate(rest[1:])
+		if err != nil {
+			return "", "", false
+		}
+		return keyword, latin1ToUTF8(text), true
+	case "iTXt":
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		// Skip the language tag and translated keyword
+		_, rest, found = bytes.Cut(rest[2:], []byte{0})
+		if !found {
+			return "", "", false
+		}
+		_, text, found := bytes.Cut(rest, []byte{0})
+		if !found {
+			return "", "", false
+		}
+		if compressed {
+			var err error
+			if text, err = inflate(text); err != nil {
+				return "", "", false
+			}
+		}
+		return keyword, string(text), true
+	}
+
+	return "", "", false
+}
+
+// inflate decompresses zlib data
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// isASCII reports whether s only contains 7-bit characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// latin1ToUTF8 converts ISO 8859-1 bytes, used by tEXt and zTXt, to a string
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,585 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Identifiers of metadata stored in other formats' containers
+var (
+	iccHeader         = []byte("ICC_PROFILE\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	adobeHeader       = []byte("Adobe")
+
+	// jumbfHeader is the common identifier of JPEG APP11 segments carrying
+	// JUMBF boxes, such as a C2PA manifest store
+	jumbfHeader = []byte("JP")
+)
+
+const (
+	// xmpKeyword is the PNG iTXt keyword holding an XMP packet
+	xmpKeyword = "XML:com.adobe.xmp"
+
+	markerAPP2  = 0xE2
+	markerAPP11 = 0xEB
+	markerAPP14 = 0xEE
+	markerCOM   = 0xFE
+
+	// pngC2PAChunk and webpC2PAChunk hold a C2PA manifest store
+	pngC2PAChunk  = "caBX"
+	webpC2PAChunk = "C2PA"
+
+	// jumbfSegmentHeader is the size of the header of an APP11 JUMBF
+	// segment: the "JP" identifier, box instance and sequence numbers
+	jumbfSegmentHeader = 8
+
+	// vp8xFlagICC marks a WebP file with an ICCP chunk
+	vp8xFlagICC = 0x20
+
+	// iccSegmentData is the profile data that fits in one APP2 segment
+	iccSegmentData = maxSegmentData - 14
+)
+
+// carriedPNGChunks are PNG chunks describing color or metadata that stay
+// valid when the pixels are re-encoded
+var carriedPNGChunks = map[string]bool{
+	"gAMA": true, "cHRM": true, "sRGB": true, "cICP": true, "pHYs": true, "tIME": true,
+	"tEXt": true, "zTXt": true, "iTXt": true,
+}
+
+// ancillary is the color profile and metadata of an encoded image
+type ancillary struct {
+	icc  []byte // ICC profile
+	exif []byte // EXIF TIFF structure, without the JPEG header
+	xmp  []byte // XMP packet
+	c2pa []byte // C2PA manifest store (a JUMBF box), e.g. from the provider
+
+	// Other chunks and segments, only carried between images of the same format
+	pngChunks    []pngChunk
+	jpegSegments []jpegSegment
+}
+
+// Preserve copies the ICC profile, EXIF and XMP metadata of src into dst, a
+// re-encoding of the same image, replacing dst's own. A C2PA manifest store,
+// such as the provider's, is copied too: validators then report the edit as
+// not covered by it, but its claims stay readable. When both are the same
+// format, other color and metadata chunks (PNG) or segments (JPEG) are copied
+// too. Manifests signed by img-gen are never copied, since they are signed
+// again for the new image.
+//
+// Parameters:
+//   - src: the original encoded image
+//   - dst: the re-encoded image (PNG, JPEG or WebP)
+//
+// Returns:
+//   - dst with src's color profile and metadata
+//   - error if either image is malformed or dst's format is unsupported
+func Preserve(src, dst []byte) ([]byte, error) {
+	carried, err := readAncillary(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// A profile for another color space would misdescribe the new pixels,
+	// e.g. a CMYK profile once the encoder has written RGB
+	if carried.icc != nil && iccColorSpace(carried.icc) != colorSpace(dst) {
+		carried.icc = nil
+	}
+
+	switch sniff(dst) {
+	case formatPNG:
+		return writePNGAncillary(dst, carried)
+	case formatJPEG:
+		return writeJPEGAncillary(dst, carried)
+	case formatWebP:
+		return writeWebPAncillary(dst, carried)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// Orientation returns the EXIF orientation (1-8) of an encoded image
+// It returns 1, the normal orientation, when the image has none.
+func Orientation(data []byte) int {
+	carried, err := readAncillary(data)
+	if err != nil || carried.exif == nil {
+		return 1
+	}
+
+	ifd := readIFD0(carried.exif)
+	if ifd == nil {
+		return 1
+	}
+	orientation, ok := ifd.short(tagOrientation)
+	if !ok || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return int(orientation)
+}
+
+// readAncillary extracts the color profile and metadata of an encoded image
+func readAncillary(data []byte) (*ancillary, error) {
+	carried := &ancillary{}
+
+	switch sniff(data) {
+	case formatPNG:
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			switch chunk.typ {
+			case "iCCP":
+				carried.icc = parseICCPChunk(chunk.data)
+			case "eXIf":
+				carried.exif = chunk.data
+			case pngC2PAChunk:
+				carried.c2pa = chunk.data
+			default:
+				if keyword, value, ok := parseTextChunk(chunk); ok && keyword == xmpKeyword {
+					carried.xmp = []byte(value)
+				} else if carriedPNGChunks[chunk.typ] {
+					carried.pngChunks = append(carried.pngChunks, chunk)
+				}
+			}
+		}
+
+	case formatJPEG:
+		segments, _, err := readJPEGSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		var iccParts, jumbfParts []jpegSegment
+		for _, segment := range segments {
+			switch {
+			case isExifSegment(segment):
+				carried.exif = segment.data[len(exifHeader):]
+			case isXMPSegment(segment):
+				if carried.xmp == nil {
+					carried.xmp = segment.data[len(xmpHeader):]
+				}
+			case segment.marker == markerAPP2 && bytes.HasPrefix(segment.data, iccHeader):
+				iccParts = append(iccParts, segment)
+			case isJUMBFSegment(segment):
+				jumbfParts = append(jumbfParts, segment)
+			case isManifestSegment(segment):
+				// img-gen's own manifest is signed again for the new image
+			case segment.marker >= markerAPP0 && segment.marker <= 0xEF, segment.marker == markerCOM:
+				carried.jpegSegments = append(carried.jpegSegments, segment)
+			}
+		}
+		carried.icc = joinICCSegments(iccParts)
+		carried.c2pa = joinJUMBFSegments(jumbfParts)
+
+	case formatWebP:
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			switch chunk.fourCC {
+			case "ICCP":
+				carried.icc = chunk.data
+			case "EXIF":
+				carried.exif = bytes.TrimPrefix(chunk.data, exifHeader)
+			case "XMP ":
+				carried.xmp = chunk.data
+			case webpC2PAChunk:
+				carried.c2pa = chunk.data
+			}
+		}
+
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return carried, nil
+}
+
+// writePNGAncillary inserts the carried chunks after IHDR
+func writePNGAncillary(dst []byte, carried *ancillary) ([]byte, error) {
+	chunks, err := readPNGChunks(dst)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return nil, fmt.Errorf("%w: PNG does not start with IHDR", ErrMalformedImage)
+	}
+
+	var inserted []pngChunk
+	if carried.icc != nil {
+		data, err := iccpChunkData(carried.icc)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, pngChunk{typ: "iCCP", data: data})
+	}
+	if carried.exif != nil {
+		inserted = append(inserted, pngChunk{typ: "eXIf", data: carried.exif})
+	}
+	if carried.xmp != nil {
+		inserted = append(inserted, pngChunk{typ: "iTXt", data: []byte(xmpKeyword + "\x00\x00\x00\x00\x00" + string(carried.xmp))})
+	}
+	if carried.c2pa != nil {
+		inserted = append(inserted, pngChunk{typ: pngC2PAChunk, data: carried.c2pa})
+	}
+	for _, chunk := range carried.pngChunks {
+		if chunk.typ == "sRGB" && carried.icc != nil {
+			continue // iCCP and sRGB are mutually exclusive
+		}
+		inserted = append(inserted, chunk)
+	}
+
+	// Drop dst's chunks that the carried ones replace
+	replaced := map[string]bool{}
+	for _, chunk := range inserted {
+		if chunk.typ != "tEXt" && chunk.typ != "zTXt" && chunk.typ != "iTXt" {
+			replaced[chunk.typ] = true
+		}
+	}
+	if replaced["iCCP"] {
+		replaced["sRGB"] = true
+	}
+
+	result := append([]pngChunk{chunks[0]}, inserted...)
+	for _, chunk := range chunks[1:] {
+		if !replaced[chunk.typ] {
+			result = append(result, chunk)
+		}
+	}
+	return writePNGChunks(result), nil
+}
+
+// writeJPEGAncillary inserts the carried segments after SOI
+func writeJPEGAncillary(dst []byte, carried *ancillary) ([]byte, error) {
+	segments, scan, err := readJPEGSegments(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// JFIF must come first, then EXIF
+	var inserted []jpegSegment
+	var others []jpegSegment
+	for _, segment := range carried.jpegSegments {
+		switch {
+		case segment.marker == markerAPP0:
+			inserted = append(inserted, segment)
+		case isAdobeSegment(segment):
+			if adobe, ok := adobeSegment(segment, segments); ok {
+				others = append(others, adobe)
+			}
+		default:
+			others = append(others, segment)
+		}
+	}
+	if carried.exif != nil && len(exifHeader)+len(carried.exif) <= maxSegmentData {
+		inserted = append(inserted, jpegSegment{marker: markerAPP1, data: append(append([]byte{}, exifHeader...), carried.exif...)})
+	}
+	if carried.xmp != nil && len(xmpHeader)+len(carried.xmp) <= maxSegmentData {
+		inserted = append(inserted, jpegSegment{marker: markerAPP1, data: append(append([]byte{}, xmpHeader...), carried.xmp...)})
+	}
+	inserted = append(inserted, splitICCSegments(carried.icc)...)
+	inserted = append(inserted, others...)
+	inserted = append(inserted, splitJUMBFSegments(carried.c2pa)...)
+
+	var result []jpegSegment
+	result = append(result, inserted...)
+	for _, segment := range segments {
+		switch {
+		case segment.marker == markerAPP0 && len(carried.jpegSegments) > 0 && carried.jpegSegments[0].marker == markerAPP0,
+			isExifSegment(segment) && carried.exif != nil,
+			isXMPSegment(segment) && carried.xmp != nil,
+			segment.marker == markerAPP2 && bytes.HasPrefix(segment.data, iccHeader) && carried.icc != nil,
+			isJUMBFSegment(segment) && carried.c2pa != nil:
+			continue // Replaced by the carried segment
+		}
+		result = append(result, segment)
+	}
+
+	return writeJPEGSegments(result, scan), nil
+}
+
+// writeWebPAncillary adds the carried chunks, converting dst to the extended format
+func writeWebPAncillary(dst []byte, carried *ancillary) ([]byte, error) {
+	chunks, err := readWebPChunks(dst)
+	if err != nil {
+		return nil, err
+	}
+	if carried.icc == nil && carried.exif == nil && carried.xmp == nil && carried.c2pa == nil {
+		return dst, nil
+	}
+
+	if chunks[0].fourCC != "VP8X" {
+		header, err := extendedHeader(chunks[0])
+		if err != nil {
+			return nil, err
+		}
+		chunks = append([]webpChunk{header}, chunks...)
+	}
+
+	header := append([]byte{}, chunks[0].data...)
+	result := []webpChunk{{fourCC: "VP8X", data: header}}
+
+	// The ICC profile comes straight after VP8X, metadata after the image data
+	if carried.icc != nil {
+		header[0] |= vp8xFlagICC
+		result = append(result, webpChunk{fourCC: "ICCP", data: carried.icc})
+	}
+	for _, chunk := range chunks[1:] {
+		switch {
+		case chunk.fourCC == "ICCP" && carried.icc != nil,
+			chunk.fourCC == "EXIF" && carried.exif != nil,
+			chunk.fourCC == "XMP " && carried.xmp != nil,
+			chunk.fourCC == webpC2PAChunk && carried.c2pa != nil:
+			continue // Replaced by the carried chunk
+		}
+		result = append(result, chunk)
+	}
+	if carried.exif != nil {
+		header[0] |= vp8xFlagEXIF
+		result = append(result, webpChunk{fourCC: "EXIF", data: carried.exif})
+	}
+	if carried.xmp != nil {
+		header[0] |= vp8xFlagXMP
+		result = append(result, webpChunk{fourCC: "XMP ", data: carried.xmp})
+	}
+	if carried.c2pa != nil {
+		result = append(result, webpChunk{fourCC: webpC2PAChunk, data: carried.c2pa})
+	}
+
+	return writeWebPChunks(result), nil
+}
+
+// iccColorSpace returns the data color space in an ICC profile header,
+// e.g. "RGB ", "GRAY" or "CMYK"
+func iccColorSpace(profile []byte) string {
+	if len(profile) < 20 {
+		return ""
+	}
+	return string(profile[16:20])
+}
+
+// colorSpace returns the ICC name of the color space an encoded image's
+// pixels are stored in
+func colorSpace(data []byte) string {
+	switch sniff(data) {
+	case formatPNG:
+		chunks, err := readPNGChunks(data)
+		if err != nil || len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) < 10 {
+			return ""
+		}
+		// Color types 0 and 4 are grayscale, without and with alpha
+		if colorType := chunks[0].data[9]; colorType == 0 || colorType == 4 {
+			return "GRAY"
+		}
+	case formatJPEG:
+		segments, _, err := readJPEGSegments(data)
+		if err != nil {
+			return ""
+		}
+		for _, segment := range segments {
+			if !isFrameSegment(segment) {
+				continue
+			}
+			if len(segment.data) < 6 {
+				return ""
+			}
+			switch segment.data[5] {
+			case 1:
+				return "GRAY"
+			case 4:
+				return "CMYK"
+			}
+		}
+	}
+	return "RGB "
+}
+
+// parseICCPChunk returns the profile in an iCCP chunk: a name, a compression
+// method byte and the zlib-compressed profile
+func parseICCPChunk(data []byte) []byte {
+	_, rest, found := bytes.Cut(data, []byte{0})
+	if !found || len(rest) < 1 {
+		return nil
+	}
+	profile, err := inflate(rest[1:])
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// iccpChunkData builds the data of an iCCP chunk
+func iccpChunkData(profile []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("ICC Profile\x00\x00")
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// joinICCSegments reassembles a profile split over APP2 segments, each
+// prefixed with its 1-based sequence number and the segment count
+func joinICCSegments(segments []jpegSegment) []byte {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	header := len(iccHeader) + 2
+	sort.SliceStable(segments, func(i, j int) bool {
+		return len(segments[i].data) > len(iccHeader) && len(segments[j].data) > len(iccHeader) &&
+			segments[i].data[len(iccHeader)] < segments[j].data[len(iccHeader)]
+	})
+
+	var profile []byte
+	for _, segment := range segments {
+		if len(segment.data) < header {
+			return nil
+		}
+		profile = append(profile, segment.data[header:]...)
+	}
+	return profile
+}
+
+// splitICCSegments splits a profile over as many APP2 segments as needed
+func splitICCSegments(profile []byte) []jpegSegment {
+	if profile == nil {
+		return nil
+	}
+
+	count := (len(profile) + iccSegmentData - 1) / iccSegmentData
+	if count > 255 {
+		return nil // Too large to store in a JPEG
+	}
+
+	segments := make([]jpegSegment, 0, count)
+	for i := 0; i < count; i++ {
+		part := profile[i*iccSegmentData : min((i+1)*iccSegmentData, len(profile))]
+		data := append(append([]byte{}, iccHeader...), byte(i+1), byte(count))
+		segments = append(segments, jpegSegment{marker: markerAPP2, data: append(data, part...)})
+	}
+	return segments
+}
+
+// isAdobeSegment reports whether a segment is Adobe's APP14 segment
+func isAdobeSegment(segment jpegSegment) bool {
+	return segment.marker == markerAPP14 && bytes.HasPrefix(segment.data, adobeHeader)
+}
+
+// adobeSegment returns the Adobe segment of another encoding for the image
+// described by segments. Its transform flag, which tells decoders whether
+// the components are YCbCr, is updated to match; it reports false if the
+// image has its own Adobe segment.
+func adobeSegment(adobe jpegSegment, segments []jpegSegment) (jpegSegment, bool) {
+	// "Adobe", version, two flag words, then the transform
+	if len(adobe.data) < 12 {
+		return jpegSegment{}, false
+	}
+	components := 0
+	for _, segment := range segments {
+		if isAdobeSegment(segment) {
+			return jpegSegment{}, false
+		}
+		if isFrameSegment(segment) && len(segment.data) >= 6 {
+			components = int(segment.data[5])
+		}
+	}
+
+	data := append([]byte{}, adobe.data...)
+	switch components {
+	case 3:
+		data[11] = 1 // YCbCr
+	case 1:
+		data[11] = 0
+	default:
+		return jpegSegment{}, false // CMYK transforms are not written by Go's encoder
+	}
+	return jpegSegment{marker: markerAPP14, data: data}, true
+}
+
+// isFrameSegment reports whether a segment is a start of frame, which holds
+// the image size and components
+func isFrameSegment(segment jpegSegment) bool {
+	// Start of frame markers, excluding DHT, JPG and DAC
+	return segment.marker >= 0xC0 && segment.marker <= 0xCF &&
+		segment.marker != 0xC4 && segment.marker != 0xC8 && segment.marker != 0xCC
+}
+
+// isJUMBFSegment reports whether a segment holds part of a JUMBF box
+func isJUMBFSegment(segment jpegSegment) bool {
+	return segment.marker == markerAPP11 && len(segment.data) > jumbfSegmentHeader+8 && bytes.HasPrefix(segment.data, jumbfHeader)
+}
+
+// joinJUMBFSegments reassembles the first JUMBF box split over APP11
+// segments. Each segment holds the box's instance and sequence numbers and
+// repeats its header before the next part of its contents.
+func joinJUMBFSegments(segments []jpegSegment) []byte {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	instance := segments[0].data[2:4]
+	var parts []jpegSegment
+	for _, segment := range segments {
+		if bytes.Equal(segment.data[2:4], instance) {
+			parts = append(parts, segment)
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return binary.BigEndian.Uint32(parts[i].data[4:8]) < binary.BigEndian.Uint32(parts[j].data[4:8])
+	})
+
+	box := append([]byte{}, parts[0].data[jumbfSegmentHeader:]...)
+	header := jumbfBoxHeader(box)
+	for _, part := range parts[1:] {
+		if len(part.data) < jumbfSegmentHeader+header {
+			return nil
+		}
+		box = append(box, part.data[jumbfSegmentHeader+header:]...)
+	}
+	return box
+}
+
+// splitJUMBFSegments splits a JUMBF box over as many APP11 segments as needed
+func splitJUMBFSegments(box []byte) []jpegSegment {
+	if len(box) < 8 {
+		return nil
+	}
+
+	header := jumbfBoxHeader(box)
+	contents := box[header:]
+	partSize := maxSegmentData - jumbfSegmentHeader - header
+
+	var segments []jpegSegment
+	for sequence := uint32(1); ; sequence++ {
+		part := contents[:min(partSize, len(contents))]
+		contents = contents[len(part):]
+
+		data := append([]byte{}, jumbfHeader...)
+		data = binary.BigEndian.AppendUint16(data, 1) // Box instance
+		data = binary.BigEndian.AppendUint32(data, sequence)
+		data = append(data, box[:header]...)
+		segments = append(segments, jpegSegment{marker: markerAPP11, data: append(data, part...)})
+
+		if len(contents) == 0 {
+			return segments
+		}
+	}
+}
+
+// jumbfBoxHeader returns the size of a box's header: its length and type,
+// followed by a 64-bit length when the 32-bit one is 1
+func jumbfBoxHeader(box []byte) int {
+	if len(box) >= 16 && binary.BigEndian.Uint32(box) == 1 {
+		return 16
+	}
+	return 8
+}
@@ -0,0 +1,183 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// VP8X feature flags
+const (
+	vp8xFlagEXIF = 0x08
+	vp8xFlagXMP  = 0x04
+)
+
+// webpChunk is a single RIFF chunk
+type webpChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// readWebPChunks splits a WebP file into RIFF chunks
+func readWebPChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	rest := data[12:]
+
+	for len(rest) >= 8 {
+		size := binary.LittleEndian.Uint32(rest[4:])
+		if uint64(size)+8 > uint64(len(rest)) {
+			return nil, fmt.Errorf("%w: truncated WebP chunk", ErrMalformedImage)
+		}
+		chunks = append(chunks, webpChunk{fourCC: string(rest[:4]), data: rest[8 : 8+size]})
+
+		// Chunks are padded to an even size
+		next := 8 + int(size) + int(size%2)
+		if next > len(rest) {
+			break
+		}
+		rest = rest[next:]
+	}
+
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: empty WebP file", ErrMalformedImage)
+	}
+	return chunks, nil
+}
+
+// writeWebPChunks joins chunks into a WebP file
+func writeWebPChunks(chunks []webpChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		body.WriteString(chunk.fourCC)
+		binary.Write(&body, binary.LittleEndian, uint32(len(chunk.data)))
+		body.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(body.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+// embedWebP converts a simple WebP file to the extended format if needed and
+// merges the metadata into the XMP chunk. As for JPEG, EXIF from another
+// source is kept.
+func embedWebP(data []byte, md Metadata) ([]byte, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunks[0].fourCC != "VP8X" {
+		header, err := extendedHeader(chunks[0])
+		if err != nil {
+			return nil, err
+		}
+		chunks = append([]webpChunk{header}, chunks...)
+	}
+
+	header := append([]byte{}, chunks[0].data...)
+	header[0] |= vp8xFlagEXIF | vp8xFlagXMP
+
+	packet, err := buildXMP(md)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks[1:] {
+		if chunk.fourCC == "XMP " {
+			packet = mergeXMP(chunk.data, packet)
+			break
+		}
+	}
+
+	exif := buildExif(md)
+	result := []webpChunk{{fourCC: "VP8X", data: header}}
+	for _, chunk := range chunks[1:] {
+		if chunk.fourCC == "EXIF" && !isOwnExif(chunk.data) {
+			exif = chunk.data
+			continue // Moved below
+		}
+		if chunk.fourCC == "EXIF" || chunk.fourCC == "XMP " {
+			continue // Replaced below
+		}
+		result = append(result, chunk)
+	}
+	// Metadata chunks follow the image data
+	result = append(result,
+		webpChunk{fourCC: "EXIF", data: exif},
+		webpChunk{fourCC: "XMP ", data: packet},
+	)
+
+	return writeWebPChunks(result), nil
+}
+
+// extendedHeader builds the VP8X chunk for a simple (VP8 or VP8L) WebP image
+func extendedHeader(image webpChunk) (webpChunk, error) {
+	var width, height int
+
+	switch image.fourCC {
+	case "VP8L":
+		// Signature byte, then 14-bit width-1 and height-1. VP8L carries its
+		// own alpha, and Go's decoder rejects the VP8X alpha flag without an
+		// ALPH chunk, so the flag is left unset.
+		if len(image.data) < 5 || image.data[0] != 0x2F {
+			return webpChunk{}, fmt.Errorf("%w: invalid VP8L header", ErrMalformedImage)
+		}
+		bits := binary.LittleEndian.Uint32(image.data[1:])
+		width = int(bits&0x3FFF) + 1
+		height = int(bits>>14&0x3FFF) + 1
+	case "VP8 ":
+		// Frame tag, start code, then 14-bit width and height
+		if len(image.data) < 10 || !bytes.Equal(image.data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return webpChunk{}, fmt.Errorf("%w: invalid VP8 header", ErrMalformedImage)
+		}
+		width = int(binary.LittleEndian.Uint16(image.data[6:]) & 0x3FFF)
+		height = int(binary.LittleEndian.Uint16(image.data[8:]) & 0x3FFF)
+	default:
+		return webpChunk{}, fmt.Errorf("%w: unexpected WebP chunk %q", ErrMalformedImage, image.fourCC)
+	}
+
+	// Flags (set by the caller), three reserved bytes, then the 24-bit canvas width-1 and height-1
+	data := make([]byte, 10)
+	putUint24(data[4:], width-1)
+	putUint24(data[7:], height-1)
+	return webpChunk{fourCC: "VP8X", data: data}, nil
+}
+
+// putUint24 writes a little-endian 24-bit value
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// readWebP reads the XMP chunk, falling back to EXIF
+func readWebP(data []byte) (*Metadata, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.fourCC == "XMP " {
+			md, err := parseXMP(chunk.data)
+			if md != nil || err != nil {
+				return md, err
+			}
+		}
+	}
+	for _, chunk := range chunks {
+		if chunk.fourCC == "EXIF" {
+			if md := parseExif(chunk.data); md != nil {
+				return md, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
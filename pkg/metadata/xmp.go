@@ -0,0 +1,298 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// XMP namespaces
+const (
+	nsRDF     = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC      = "http://purl.org/dc/elements/1.1/"
+	nsXMP     = "http://ns.adobe.com/xap/1.0/"
+	nsIPTCExt = "http://iptc.org/std/Iptc4xmpExt/2008-02-29/"
+	nsImgGen  = "https://github.com/Parthipan-Natkunam/generate_image/ns/1.0/"
+)
+
+// buildXMP returns an XMP packet describing the metadata
+// Standard Dublin Core, XMP and IPTC properties are written for indexers and
+// AI disclosure, and the imggen:record property holds the complete metadata
+// as JSON.
+func buildXMP(md Metadata) ([]byte, error) {
+	rec, err := record(md)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:dc=\"" + nsDC + "\"\n")
+	b.WriteString("    xmlns:xmp=\"" + nsXMP + "\"\n")
+	b.WriteString("    xmlns:Iptc4xmpExt=\"" + nsIPTCExt + "\"\n")
+	b.WriteString("    xmlns:imggen=\"" + nsImgGen + "\">\n")
+
+	b.WriteString("   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+	xml.EscapeText(&b, []byte(md.Prompt))
+	b.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+
+	writeProperty := func(name, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteString("   <" + name + ">")
+		xml.EscapeText(&b, []byte(value))
+		b.WriteString("</" + name + ">\n")
+	}
+	writeProperty("xmp:CreatorTool", md.Software)
+	writeProperty("xmp:CreateDate", md.CreatedAt.Format(time.RFC3339))
+	writeProperty("Iptc4xmpExt:DigitalSourceType", DigitalSourceTrainedAlgorithmicMedia)
+	writeProperty("imggen:provider", md.Provider)
+	writeProperty("imggen:model", md.Model)
+	writeProperty("imggen:aspectRatio", md.AspectRatio)
+	writeProperty("imggen:imageSize", md.ImageSize)
+	writeProperty("imggen:generationId", md.GenerationID)
+	writeProperty("imggen:record", string(rec))
+
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+
+	return []byte(b.String()), nil
+}
+
+// parseXMP reads the imggen:record property, falling back to the standard
+// properties. It returns nil if the packet carries none of them.
+func parseXMP(data []byte) (*Metadata, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []xml.Name
+	properties := map[xml.Name]string{}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil // Not XMP this package can read
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			// Attribute text to the property it belongs to, e.g. the rdf:li
+			// inside dc:description belongs to dc:description
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space == nsDC || stack[i].Space == nsXMP || stack[i].Space == nsImgGen {
+					properties[stack[i]] += string(t)
+					break
+				}
+			}
+		}
+	}
+
+	if rec, ok := properties[xml.Name{Space: nsImgGen, Local: "record"}]; ok {
+		return parseRecord([]byte(rec))
+	}
+
+	prompt := strings.TrimSpace(properties[xml.Name{Space: nsDC, Local: "description"}])
+	software := strings.TrimSpace(properties[xml.Name{Space: nsXMP, Local: "CreatorTool"}])
+	if prompt == "" && software == "" {
+		return nil, nil
+	}
+
+	md := &Metadata{Prompt: prompt, Software: software}
+	created := strings.TrimSpace(properties[xml.Name{Space: nsXMP, Local: "CreateDate"}])
+	if t, err := time.Parse(time.RFC3339, created); err == nil {
+		md.CreatedAt = t
+	}
+	return md, nil
+}
+
+// ownProperties are the properties buildXMP writes besides the imggen ones
+var ownProperties = map[xml.Name]bool{
+	{Space: nsDC, Local: "description"}:            true,
+	{Space: nsXMP, Local: "CreatorTool"}:           true,
+	{Space: nsXMP, Local: "CreateDate"}:            true,
+	{Space: nsIPTCExt, Local: "DigitalSourceType"}: true,
+}
+
+// isOwnProperty reports whether buildXMP writes a property
+func isOwnProperty(name xml.Name) bool {
+	return name.Space == nsImgGen || ownProperties[name]
+}
+
+// xmpAttribute matches an attribute in a start tag, with the space before it
+var xmpAttribute = regexp.MustCompile(`\s+[^\s=/>]+\s*=\s*("[^"]*"|'[^']*')`)
+
+// span is a byte range of an XMP packet
+type span struct {
+	start, end int
+}
+
+// mergeXMP adds the properties of packet, built by buildXMP, to an existing
+// packet, replacing the properties of the same name. Everything else in the
+// existing packet, such as a camera's or an editor's properties, is kept.
+// packet is returned as is if existing cannot be parsed.
+func mergeXMP(existing, packet []byte) []byte {
+	start := bytes.Index(packet, []byte("<rdf:Description"))
+	end := bytes.LastIndex(packet, []byte("</rdf:Description>"))
+	if len(bytes.TrimSpace(existing)) == 0 || start < 0 || end < 0 {
+		return packet
+	}
+	own := packet[start : end+len("</rdf:Description>")]
+
+	removed, rdfEnd, ok := ownSpans(existing)
+	if !ok {
+		return packet
+	}
+
+	// The new description goes last, on its own line as buildXMP writes it
+	insertAt := lineStart(existing, rdfEnd)
+	var b bytes.Buffer
+	pos := 0
+	for _, s := range removed {
+		b.Write(existing[pos:s.start])
+		pos = s.end
+	}
+	b.Write(existing[pos:insertAt])
+	if insertAt < rdfEnd {
+		b.WriteString("  ")
+		b.Write(own)
+		b.WriteString("\n")
+	} else {
+		b.Write(own)
+	}
+	b.Write(existing[insertAt:])
+	return b.Bytes()
+}
+
+// ownSpans finds the properties of an XMP packet that buildXMP writes, as
+// elements or attributes of a top-level rdf:Description, and where the
+// rdf:RDF element ends. Descriptions left empty are removed whole.
+func ownSpans(data []byte) (removed []span, rdfEnd int, ok bool) {
+	rdfDescription := xml.Name{Space: nsRDF, Local: "Description"}
+	rdfRDF := xml.Name{Space: nsRDF, Local: "RDF"}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []xml.Name
+	rdfEnd = -1
+
+	// The top-level description being read
+	descDepth := -1
+	var descStart int
+	var descSpans []span
+	descKept := false
+	var propStart int
+
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			stack = append(stack, t.Name)
+
+			switch {
+			case t.Name == rdfDescription && parent == rdfRDF:
+				descDepth = len(stack)
+				descStart, descSpans, descKept = offset, nil, false
+
+				// Attributes are properties too, except for namespace
+				// declarations and the rdf ones
+				tag := data[offset:decoder.InputOffset()]
+				matches := xmpAttribute.FindAllIndex(tag, -1)
+				for i, attr := range t.Attr {
+					switch {
+					case attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" && attr.Name.Space == "",
+						attr.Name.Space == nsRDF:
+					case isOwnProperty(attr.Name) && len(matches) == len(t.Attr):
+						descSpans = append(descSpans, span{offset + matches[i][0], offset + matches[i][1]})
+					default:
+						descKept = true
+					}
+				}
+			case descDepth >= 0 && len(stack) == descDepth+1:
+				propStart = offset
+			}
+
+		case xml.EndElement:
+			switch {
+			case descDepth >= 0 && len(stack) == descDepth+1:
+				if isOwnProperty(t.Name) {
+					descSpans = append(descSpans, lineSpan(data, span{propStart, int(decoder.InputOffset())}))
+				} else {
+					descKept = true
+				}
+			case len(stack) == descDepth:
+				if descKept {
+					removed = append(removed, descSpans...)
+				} else {
+					removed = append(removed, lineSpan(data, span{descStart, int(decoder.InputOffset())}))
+				}
+				descDepth = -1
+			case t.Name == rdfRDF && rdfEnd < 0:
+				rdfEnd = offset
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if rdfEnd < 0 {
+		return nil, 0, false
+	}
+	return removed, rdfEnd, true
+}
+
+// lineSpan widens a span to whole lines when nothing else shares them, so
+// removing it leaves no blank line behind
+func lineSpan(data []byte, s span) span {
+	start := s.start
+	for start > 0 && (data[start-1] == ' ' || data[start-1] == '\t') {
+		start--
+	}
+	end := s.end
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	if (start > 0 && data[start-1] != '\n') || (end < len(data) && data[end] != '\n') {
+		return s
+	}
+	if end < len(data) {
+		end++
+	}
+	return span{start, end}
+}
+
+// lineStart returns the start of the line holding pos if only spaces or
+// tabs precede it there, and pos otherwise
+func lineStart(data []byte, pos int) int {
+	start := pos
+	for start > 0 && (data[start-1] == ' ' || data[start-1] == '\t') {
+		start--
+	}
+	if start > 0 && data[start-1] != '\n' {
+		return pos
+	}
+	return start
+}
@@ -0,0 +1,176 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultTemplate names files after the generation time, as img_<unix>
+const DefaultTemplate = "img_{unix}"
+
+// maxSlugLength caps the length of the {slug} token
+const maxSlugLength = 48
+
+// Template errors
+var (
+	ErrEmptyTemplate   = errors.New("filename template is empty")
+	ErrUnknownToken    = errors.New("unknown filename template token")
+	ErrInvalidTemplate = errors.New("invalid filename template")
+)
+
+// Tokens lists the tokens a template may contain
+var Tokens = []string{"date", "time", "unix", "id", "slug", "provider", "model", "ratio", "size", "hash", "seq"}
+
+var tokenPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// unsafeChars are replaced in token values so they cannot add directories
+// or characters that are invalid in Windows file names
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Fields are the values substituted for template tokens
+type Fields struct {
+	Time        time.Time // {date}, {time} and {unix}
+	ID          string    // {id}, the generation ID
+	Prompt      string    // {slug}
+	Provider    string    // {provider}
+	Model       string    // {model}
+	AspectRatio string    // {ratio}, e.g. 16:9 becomes 16x9
+	ImageSize   string    // {size}
+	Data        []byte    // {hash}, the first 8 hex digits of the image's SHA-256
+}
+
+// Template is a parsed filename template such as "{date}/{slug}-{seq}"
+type Template struct {
+	raw string
+}
+
+// ParseTemplate checks a filename template
+//
+// Parameters:
+//   - value: the template, without an extension; "/" separates directories
+//
+// Returns:
+//   - the parsed template
+//   - error if it is empty, contains an unknown token, or could escape the
+//     output directory
+func ParseTemplate(value string) (*Template, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, ErrEmptyTemplate
+	}
+
+	for _, match := range tokenPattern.FindAllStringSubmatch(value, -1) {
+		if !isToken(match[1]) {
+			return nil, fmt.Errorf("%w: %s (supported: {%s})", ErrUnknownToken, match[0], strings.Join(Tokens, "}, {"))
+		}
+	}
+	if rest := tokenPattern.ReplaceAllString(value, ""); strings.ContainsAny(rest, "{}") {
+		return nil, fmt.Errorf("%w: unbalanced braces in %q", ErrInvalidTemplate, value)
+	}
+
+	if filepath.IsAbs(value) || strings.HasPrefix(value, "/") {
+		return nil, fmt.Errorf("%w: %q must be relative to the output directory", ErrInvalidTemplate, value)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(value), "/") {
+		if element == "" || element == "." || element == ".." {
+			return nil, fmt.Errorf("%w: %q has an empty, '.' or '..' path element", ErrInvalidTemplate, value)
+		}
+	}
+
+	return &Template{raw: value}, nil
+}
+
+// HasSeq reports whether the template numbers files with {seq}
+func (t *Template) HasSeq() bool {
+	return strings.Contains(t.raw, "{seq}")
+}
+
+// String returns the template as given
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Expand substitutes the fields into the template
+// {seq} becomes seq, zero-padded to three digits.
+func (t *Template) Expand(fields Fields, seq int) string {
+	expanded := tokenPattern.ReplaceAllStringFunc(t.raw, func(token string) string {
+		var value string
+		switch token[1 : len(token)-1] {
+		case "date":
+			value = fields.Time.Format("2006-01-02")
+		case "time":
+			value = fields.Time.Format("150405")
+		case "unix":
+			value = strconv.FormatInt(fields.Time.Unix(), 10)
+		case "id":
+			value = fields.ID
+		case "slug":
+			value = Slug(fields.Prompt)
+		case "provider":
+			value = fields.Provider
+		case "model":
+			value = fields.Model
+		case "ratio":
+			value = strings.ReplaceAll(fields.AspectRatio, ":", "x")
+		case "size":
+			value = fields.ImageSize
+		case "hash":
+			sum := sha256.Sum256(fields.Data)
+			value = hex.EncodeToString(sum[:4])
+		case "seq":
+			value = fmt.Sprintf("%03d", seq)
+		}
+		value = unsafeChars.ReplaceAllString(value, "-")
+		if value != "" && strings.Trim(value, ".") == "" {
+			value = "-" // Never a "." or ".." path element
+		}
+		return value
+	})
+	return filepath.FromSlash(expanded)
+}
+
+// Slug turns a prompt into a short, lowercase, hyphen-separated file name
+// part, e.g. "A red fox, in snow!" becomes "a-red-fox-in-snow"
+func Slug(prompt string) string {
+	words := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	// Stop at a word boundary once the slug is long enough
+	var slug string
+	for _, word := range words {
+		next := word
+		if slug != "" {
+			next = slug + "-" + word
+		}
+		if len(next) > maxSlugLength {
+			if slug == "" {
+				slug = word[:maxSlugLength]
+			}
+			break
+		}
+		slug = next
+	}
+
+	if slug == "" {
+		return "image"
+	}
+	return slug
+}
+
+// isToken reports whether name is a supported token
+func isToken(name string) bool {
+	for _, token := range Tokens {
+		if token == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxAttempts bounds the search for a free file name
+const maxAttempts = 10000
+
+// Write errors
+var (
+	ErrExists      = errors.New("output file already exists")
+	ErrNoFreeName  = errors.New("no free file name")
+	ErrOutsideRoot = errors.New("path is outside the allowed output root")
+	ErrTraversal   = errors.New("path may not contain '..'")
+)
+
+// RenderFunc returns the bytes to save at path
+// It is called again if the path turns out to be taken, so that contents
+// naming the file, such as a signed manifest, stay correct.
+type RenderFunc func(path string) ([]byte, error)
+
+// Writer saves files atomically and without replacing existing files,
+// optionally only inside a root directory
+type Writer struct {
+	root string // Resolved root, or "" for no restriction
+}
+
+// NewWriter returns a Writer that only writes inside root
+//
+// Parameters:
+//   - root: the directory files must stay inside after resolving symlinks;
+//     "" allows any path
+//
+// Returns:
+//   - the writer
+//   - error if root does not exist
+func NewWriter(root string) (*Writer, error) {
+	if root == "" {
+		return &Writer{}, nil
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output root: %w", err)
+	}
+	return &Writer{root: resolved}, nil
+}
+
+// Root returns the directory writes are restricted to, or "" if unrestricted
+func (w *Writer) Root() string {
+	return w.root
+}
+
+// Check verifies that path stays inside the root once symlinks in its
+// existing part are resolved. Paths containing ".." are rejected outright,
+// since the OS resolves ".." after following symlinks.
+func (w *Writer) Check(path string) error {
+	if w.root == "" {
+		return nil
+	}
+
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == ".." {
+			return fmt.Errorf("%w: %s", ErrTraversal, path)
+		}
+	}
+
+	resolved, err := resolve(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(w.root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is not inside %s", ErrOutsideRoot, path, w.root)
+	}
+	return nil
+}
+
+// Save writes a file under the first free name the template gives
+// If the name is taken, {seq} is incremented; a template without {seq} gets
+// a _2, _3, ... suffix instead. Concurrent runs never pick the same name.
+//
+// Parameters:
+//   - dir: the output directory; it and any directories in the template are created
+//   - tmpl: the filename template
+//   - fields: the values of the template's tokens
+//   - ext: the file extension, including the dot
+//   - companions: suffixes of files saved next to this one (e.g. "_thumb.png");
+//     names whose companions already exist are skipped too
+//   - render: returns the contents for the chosen path
+//
+// Returns:
+//   - the path the file was saved to
+//   - error if no free name is found, rendering fails or the file cannot be written
+func (w *Writer) Save(dir string, tmpl *Template, fields Fields, ext string, companions []string, render RenderFunc) (string, error) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		base := tmpl.Expand(fields, attempt)
+		if attempt > 1 && !tmpl.HasSeq() {
+			base += "_" + strconv.Itoa(attempt)
+		}
+		base = filepath.Join(dir, base)
+
+		err := w.save(base+ext, base, companions, render)
+		if errors.Is(err, ErrExists) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return base + ext, nil
+	}
+	return "", fmt.Errorf("%w for %q in %s", ErrNoFreeName, tmpl, dir)
+}
+
+// SaveExact writes a file at exactly path, which must not exist
+//
+// Parameters:
+//   - path: the output path
+//   - companions: suffixes of files saved next to this one, appended to
+//     path without its extension; they must not exist either
+//   - render: returns the contents for path
+//
+// Returns:
+//   - ErrExists if the file or a companion exists, or another error if
+//     rendering or writing fails
+func (w *Writer) SaveExact(path string, companions []string, render RenderFunc) error {
+	return w.save(path, strings.TrimSuffix(path, filepath.Ext(path)), companions, render)
+}
+
+// WriteNew writes data to a new file at path, failing with ErrExists
+// rather than replacing an existing file
+func (w *Writer) WriteNew(path string, data []byte) error {
+	return w.save(path, "", nil, func(string) ([]byte, error) { return data, nil })
+}
+
+// save renders and writes path, after checking that no companion of base exists
+func (w *Writer) save(path, base string, companions []string, render RenderFunc) error {
+	for _, suffix := range companions {
+		if _, err := os.Lstat(base + suffix); err == nil {
+			return fmt.Errorf("%w: %s", ErrExists, base+suffix)
+		}
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	}
+
+	// Create the directory, then check it did not lead outside the root
+	dir := filepath.Dir(path)
+	if err := w.Check(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := w.Check(path); err != nil {
+		return err
+	}
+
+	data, err := render(path)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data)
+}
+
+// writeAtomic writes data to a temporary file next to path and then links it
+// into place, so path never holds a partial file and an existing file is
+// never replaced
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	// A hard link fails if path exists, unlike a rename
+	err = os.Link(tmp.Name(), path)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	}
+	if err != nil {
+		// Some file systems do not support hard links
+		return writeExclusive(path, data)
+	}
+	return nil
+}
+
+// writeExclusive creates path and writes data to it, failing with ErrExists
+// if path exists. Unlike writeAtomic, a partial file is visible while
+// writing; it is removed if writing fails.
+func writeExclusive(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// maxLinks bounds the symlinks resolve follows, as the OS does
+const maxLinks = 255
+
+// resolve returns the absolute path with symlinks resolved in the part of
+// it that exists. A dangling symlink is followed to where it points, since
+// writing through it would create its target.
+func resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	existing := abs
+	var missing []string
+	for links := 0; ; {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return abs, nil
+		}
+
+		if info, err := os.Lstat(existing); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			if links++; links > maxLinks {
+				return "", fmt.Errorf("too many symlinks in %s", path)
+			}
+			target, err := os.Readlink(existing)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(parent, target)
+			}
+			existing = target
+			continue
+		}
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
+}
@@ -0,0 +1,254 @@
+package output
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newRootWriter returns a writer restricted to a new directory, and the
+// directory with symlinks resolved
+func newRootWriter(t *testing.T) (*Writer, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(root)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	return w, root
+}
+
+func static(data string) RenderFunc {
+	return func(string) ([]byte, error) { return []byte(data), nil }
+}
+
+func TestCheckTraversal(t *testing.T) {
+	w, root := newRootWriter(t)
+	if err := os.Mkdir(filepath.Join(root, "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// ".." is rejected even when the path would end up inside the root
+	for _, path := range []string{
+		root + "/../elsewhere",
+		filepath.Join(root, "images") + "/../images/a.png",
+		"../a.png",
+	} {
+		if err := w.Check(path); !errors.Is(err, ErrTraversal) {
+			t.Errorf("Check(%s) = %v, want ErrTraversal", path, err)
+		}
+	}
+
+	for _, path := range []string{root, filepath.Join(root, "images", "a.png"), filepath.Join(root, "new", "dir", "a.png")} {
+		if err := w.Check(path); err != nil {
+			t.Errorf("Check(%s) = %v", path, err)
+		}
+	}
+	if err := w.Check(filepath.Join(filepath.Dir(root), "a.png")); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("Check of a path outside the root = %v, want ErrOutsideRoot", err)
+	}
+	// A sibling sharing the root's name as a prefix is outside it
+	if err := w.Check(root + "-other/a.png"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("Check of a sibling directory = %v, want ErrOutsideRoot", err)
+	}
+}
+
+func TestCheckSymlinkEscape(t *testing.T) {
+	w, root := newRootWriter(t)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "a.png"), filepath.Join(root, "file.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "images"), filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "link"),
+		filepath.Join(root, "link", "a.png"),
+		filepath.Join(root, "link", "new", "a.png"),
+		filepath.Join(root, "file.png"), // Dangling, so writing it would create a file outside
+	} {
+		if err := w.Check(path); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Check(%s) = %v, want ErrOutsideRoot", path, err)
+		}
+	}
+	if err := w.Check(filepath.Join(root, "inside", "a.png")); err != nil {
+		t.Errorf("Check of a symlink inside the root = %v", err)
+	}
+
+	// Saving through the symlink fails before anything is written
+	tmpl, err := ParseTemplate("link/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Save(root, tmpl, Fields{}, ".png", nil, static("image")); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("Save through symlink = %v, want ErrOutsideRoot", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Save wrote %d files outside the root", len(entries))
+	}
+}
+
+func TestCheckUnrestricted(t *testing.T) {
+	w, err := NewWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Check("../a.png"); err != nil {
+		t.Errorf("Check without a root = %v", err)
+	}
+}
+
+func TestSaveSuffixCollision(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("lake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file the suffix would produce already exists, from another template
+	// or a user, so it is skipped rather than replaced
+	if err := os.WriteFile(filepath.Join(dir, "lake_2.png"), []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, err := w.Save(dir, tmpl, Fields{}, ".png", nil, static("image"))
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		paths = append(paths, filepath.Base(path))
+	}
+	want := []string{"lake.png", "lake_3.png", "lake_4.png"}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("saved %v, want %v", paths, want)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "lake_2.png")); string(data) != "existing" {
+		t.Errorf("lake_2.png was replaced")
+	}
+}
+
+func TestSaveCompanionCollision(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("lake-{seq}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A thumbnail left behind by an earlier run takes its name too
+	if err := os.WriteFile(filepath.Join(dir, "lake-001_thumb.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := w.Save(dir, tmpl, Fields{}, ".png", []string{"_thumb.png"}, static("image"))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if filepath.Base(path) != "lake-002.png" {
+		t.Errorf("Save = %s, want lake-002.png", filepath.Base(path))
+	}
+
+	if err := w.SaveExact(filepath.Join(dir, "lake-001.png"), []string{"_thumb.png"}, static("image")); !errors.Is(err, ErrExists) {
+		t.Errorf("SaveExact with an existing companion = %v, want ErrExists", err)
+	}
+}
+
+func TestSaveRendersChosenPath(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("{date}/lake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := Fields{Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}
+	if err := os.MkdirAll(filepath.Join(dir, "2026-01-02"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2026-01-02", "lake.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := w.Save(dir, tmpl, fields, ".png", nil, func(path string) ([]byte, error) {
+		return []byte(filepath.Base(path)), nil
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "lake_2.png" {
+		t.Errorf("%s holds %q, rendered for another path", path, data)
+	}
+}
+
+func TestSaveConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("lake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const runs = 20
+	paths := make([]string, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, err := w.Save(dir, tmpl, Fields{}, ".png", nil, static("image"))
+			if err != nil {
+				t.Errorf("Save: %v", err)
+			}
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			t.Errorf("%s saved twice", path)
+		}
+		seen[path] = true
+	}
+}
+
+func TestWriteExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.png")
+	if err := writeExclusive(path, []byte("first")); err != nil {
+		t.Fatalf("writeExclusive: %v", err)
+	}
+	if err := writeExclusive(path, []byte("second")); !errors.Is(err, ErrExists) {
+		t.Errorf("writeExclusive of an existing file = %v, want ErrExists", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("file holds %q, want first", data)
+	}
+}
@@ -0,0 +1,102 @@
+package nanobanana
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// ErrUnsupportedOption is returned when a model cannot honour an option
+var ErrUnsupportedOption = errors.New("unsupported option")
+
+// Capabilities describes what a Gemini image model accepts
+type Capabilities struct {
+	Name         string // Product name, reported as the provider's name
+	AspectRatios []string
+	ImageSizes   []string // Empty if the model has one size and takes no imageSize
+	DefaultSize  string   // Used when no size is requested
+}
+
+// geminiAspectRatios are the aspect ratios the Gemini image models accept
+var geminiAspectRatios = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// models lists the capabilities of known models
+// Models missing from the table are sent every option unchecked.
+var models = map[string]Capabilities{
+	"gemini-3-pro-image-preview": {
+		Name:         "nano-banana-pro",
+		AspectRatios: geminiAspectRatios,
+		ImageSizes:   []string{"1K", "2K", "4K"},
+		DefaultSize:  "2K",
+	},
+	"gemini-2.5-flash-image": {
+		Name:         "nano-banana",
+		AspectRatios: geminiAspectRatios,
+		DefaultSize:  "1K",
+	},
+}
+
+// Models returns the names of the models with known capabilities, sorted
+func Models() []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModelCapabilities returns the capabilities of a model
+//
+// Parameters:
+//   - model: the model name, e.g. "gemini-2.5-flash-image"
+//
+// Returns:
+//   - the model's capabilities
+//   - false if the model is not in the table
+func ModelCapabilities(model string) (Capabilities, bool) {
+	caps, ok := models[model]
+	return caps, ok
+}
+
+// Validate checks that the provider's model supports the options
+// Unknown models are not checked, so new models work before they are added
+// to the table.
+func (p *Provider) Validate(opts ...generator.Option) error {
+	caps, ok := models[p.model]
+	if !ok {
+		return nil
+	}
+
+	genOpts := &generator.GenerateOptions{}
+	for _, opt := range opts {
+		opt(genOpts)
+	}
+
+	if genOpts.AspectRatio != "" && !contains(caps.AspectRatios, genOpts.AspectRatio) {
+		return fmt.Errorf("%w: %s does not support aspect ratio %s (supported: %s)",
+			ErrUnsupportedOption, p.model, genOpts.AspectRatio, strings.Join(caps.AspectRatios, ", "))
+	}
+	if genOpts.ImageSize != "" && genOpts.ImageSize != caps.DefaultSize && !contains(caps.ImageSizes, genOpts.ImageSize) {
+		supported := caps.ImageSizes
+		if len(supported) == 0 {
+			supported = []string{caps.DefaultSize}
+		}
+		return fmt.Errorf("%w: %s does not support image size %s (supported: %s)",
+			ErrUnsupportedOption, p.model, genOpts.ImageSize, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -8,50 +8,181 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
 )
 
 const (
-	defaultEndpoint = "https://generativelanguage.googleapis.com/v1beta/models/gemini-3-pro-image-preview:generateContent"
-	providerName    = "nano-banana-pro"
+	DefaultModel            = "gemini-3-pro-image-preview"
+	DefaultAPIVersion       = "v1beta"
+	DefaultVertexAPIVersion = "v1"
+	DefaultVertexLocation   = "global"
+	defaultBaseURL          = "https://generativelanguage.googleapis.com"
+
+	// genericName is the provider's name for models missing from the
+	// capabilities table
+	genericName = "gemini"
+
+	// redacted replaces credentials in requests built for display
+	redacted = "REDACTED"
 )
 
+// TokenSource supplies OAuth2 access tokens, e.g. for a service account
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
 type Provider struct {
-	apiKey   string
-	client   *http.Client
-	endpoint string
+	apiKey     string
+	client     *http.Client
+	model      string
+	apiVersion string
+	endpoint   string // Overrides the endpoint built from the model and API version
+
+	// Deadlines of streamed requests, which replace the client's timeout
+	streamTimeout     time.Duration // For the whole response
+	streamIdleTimeout time.Duration // For the first chunk, and between chunks
+
+	// Vertex AI, used instead of the Gemini API when a project is set
+	vertexProject  string
+	vertexLocation string
+	tokenSource    TokenSource // Authenticates with a bearer token instead of the API key
 }
 
 func New(apiKey string, opts ...ProviderOption) *Provider {
 	p := &Provider{
-		apiKey:   apiKey,
-		client:   &http.Client{Timeout: 60 * time.Second},
-		endpoint: defaultEndpoint,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 60 * time.Second},
+		model:  DefaultModel,
+
+		streamTimeout:     DefaultStreamTimeout,
+		streamIdleTimeout: DefaultStreamIdleTimeout,
 	}
 	for _, opt := range opts {
 		opt(p)
 	}
+
+	if p.endpoint == "" {
+		p.endpoint = p.defaultEndpoint()
+	}
 	return p
 }
 
+// defaultEndpoint builds the generateContent URL of the model on the Gemini
+// API or, for a Vertex AI project, on Vertex AI
+func (p *Provider) defaultEndpoint() string {
+	if p.vertexProject == "" {
+		version := p.apiVersion
+		if version == "" {
+			version = DefaultAPIVersion
+		}
+		return fmt.Sprintf("%s/%s/models/%s:generateContent", defaultBaseURL, version, p.model)
+	}
+
+	version := p.apiVersion
+	if version == "" {
+		version = DefaultVertexAPIVersion
+	}
+	location := p.vertexLocation
+	if location == "" {
+		location = DefaultVertexLocation
+	}
+	host := "https://aiplatform.googleapis.com"
+	if location != "global" {
+		host = fmt.Sprintf("https://%s-aiplatform.googleapis.com", location)
+	}
+	return fmt.Sprintf("%s/%s/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
+		host, version, url.PathEscape(p.vertexProject), url.PathEscape(location), p.model)
+}
+
 type ProviderOption func(*Provider)
 
+// WithModel selects the Gemini model, e.g. "gemini-2.5-flash-image"
+func WithModel(model string) ProviderOption {
+	return func(p *Provider) {
+		p.model = model
+	}
+}
+
+// WithAPIVersion selects the API version in the endpoint, e.g. "v1beta"
+// It defaults to DefaultAPIVersion, or DefaultVertexAPIVersion on Vertex AI.
+func WithAPIVersion(version string) ProviderOption {
+	return func(p *Provider) {
+		p.apiVersion = version
+	}
+}
+
+// WithVertex calls the model through Vertex AI in a Google Cloud project
+// An empty location uses DefaultVertexLocation. Vertex AI needs a token
+// source, as it does not accept API keys.
+func WithVertex(project, location string) ProviderOption {
+	return func(p *Provider) {
+		p.vertexProject = project
+		p.vertexLocation = location
+	}
+}
+
+// WithTokenSource authenticates requests with OAuth2 bearer tokens instead of
+// the API key
+func WithTokenSource(ts TokenSource) ProviderOption {
+	return func(p *Provider) {
+		p.tokenSource = ts
+	}
+}
+
+// WithEndpoint sends requests to url instead of the endpoint built from the
+// model and API version
 func WithEndpoint(url string) ProviderOption {
 	return func(p *Provider) {
 		p.endpoint = url
 	}
 }
 
+// WithStreamTimeouts sets the deadlines of streamed requests, which ignore
+// the client's timeout: total for the whole response, and idle for the first
+// chunk and each gap between chunks. A zero duration removes that limit.
+func WithStreamTimeouts(total, idle time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.streamTimeout = total
+		p.streamIdleTimeout = idle
+	}
+}
+
 func WithClient(client *http.Client) ProviderOption {
 	return func(p *Provider) {
 		p.client = client
 	}
 }
 
+// Name returns the product name of the model, such as nano-banana-pro for
+// gemini-3-pro-image-preview, or "gemini" for models not in the table
 func (p *Provider) Name() string {
-	return providerName
+	if caps, ok := models[p.model]; ok {
+		return caps.Name
+	}
+	return genericName
+}
+
+// Model returns the model used to generate images
+func (p *Provider) Model() string {
+	return p.model
+}
+
+// Endpoint returns the generateContent URL requests are sent to, which names
+// the API version and, on Vertex AI, the project and location
+func (p *Provider) Endpoint() string {
+	return p.endpoint
+}
+
+// Backend returns "vertex-ai" when requests authenticate with bearer tokens,
+// and "gemini-api" when they use the API key
+func (p *Provider) Backend() string {
+	if p.tokenSource != nil {
+		return "vertex-ai"
+	}
+	return "gemini-api"
 }
 
 // Gemini Request Structure
@@ -81,7 +212,16 @@ type GenerationConfig struct {
 
 // Gemini Response Structure
 type GenerateResponse struct {
-	Candidates []Candidate `json:"candidates"`
+	Candidates    []Candidate    `json:"candidates"`
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+// UsageMetadata reports the tokens billed for a request
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
 }
 
 type Candidate struct {
@@ -93,6 +233,8 @@ type CandidateContent struct {
 }
 
 type ResponsePart struct {
+	Text       string      `json:"text,omitempty"`
+	Thought    bool        `json:"thought,omitempty"` // Text is a summary of the model's thinking
 	InlineData *InlineData `json:"inlineData,omitempty"`
 }
 
@@ -101,48 +243,66 @@ type InlineData struct {
 	Data     string `json:"data"`
 }
 
+// BuildRequest returns the request Generate would send, with the API key
+// redacted, without sending it
+func (p *Provider) BuildRequest(prompt string, opts ...generator.Option) (*generator.Request, error) {
+	req, body, err := p.newRequest(context.Background(), prompt, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		headers[name] = req.Header.Get(name)
+	}
+	if p.tokenSource != nil {
+		headers["Authorization"] = "Bearer " + redacted
+	} else {
+		headers["X-Goog-Api-Key"] = redacted
+	}
+
+	return &generator.Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: headers,
+		Body:    body,
+	}, nil
+}
+
 // Generate sends a request to the Nano Banana (Gemini) API.
+// With a progress function the response is streamed, to report progress as
+// it arrives.
 func (p *Provider) Generate(ctx context.Context, prompt string, opts ...generator.Option) ([]byte, string, error) {
 	genOpts := &generator.GenerateOptions{}
 	for _, opt := range opts {
 		opt(genOpts)
 	}
 
-	reqPayload := GenerateRequest{
-		Contents: []Content{
-			{
-				Role: "user",
-				Parts: []Part{
-					{Text: prompt},
-				},
-			},
-		},
-		GenerationConfig: &GenerationConfig{
-			ResponseModalities: []string{"TEXT", "IMAGE"},
-			ImageConfig: ImageConfig{
-				AspectRatio: genOpts.AspectRatio,
-				ImageSize:   genOpts.ImageSize,
-			},
-		},
-	}
-
-	jsonBody, err := json.Marshal(reqPayload)
+	req, _, err := p.newRequest(ctx, prompt, opts)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, "", err
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	if err := p.authorize(ctx, req); err != nil {
+		return nil, "", err
 	}
 
-	req.Header.Set("x-goog-api-key", p.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "img-gen-cli/1.0")
+	// A streamed response can take minutes, longer than the client timeout
+	// allows, so it is limited by deadlines on the whole stream and on the
+	// gaps between its chunks instead
+	client := p.client
+	var watchdog *idleWatchdog
+	if genOpts.Progress != nil {
+		var stop context.CancelFunc
+		ctx, watchdog, stop = p.streamContext(ctx)
+		defer stop()
+		req = req.WithContext(ctx)
+		client = withoutTimeout(p.client)
 
-	resp, err := p.client.Do(req)
+		genOpts.Progress(generator.ProgressEvent{Stage: generator.StageRequestSent})
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("api request failed: %w", err)
+		return nil, "", fmt.Errorf("api request failed: %w", streamError(ctx, err))
 	}
 	defer resp.Body.Close()
 
@@ -152,10 +312,26 @@ func (p *Provider) Generate(ctx context.Context, prompt string, opts ...generato
 	}
 
 	var genResp GenerateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&genResp); err != nil {
+	if genOpts.Progress != nil {
+		streamed, err := readStream(watchdog.reader(resp.Body), genOpts.Progress)
+		if err != nil {
+			return nil, "", streamError(ctx, err)
+		}
+		genResp = *streamed
+	} else if err := json.NewDecoder(resp.Body).Decode(&genResp); err != nil {
 		return nil, "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	// Thinking tokens are billed as output
+	if genResp.UsageMetadata != nil && genOpts.Result != nil {
+		usage := genResp.UsageMetadata
+		genOpts.Result.Usage = &generator.Usage{
+			PromptTokens: usage.PromptTokenCount,
+			OutputTokens: usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+			TotalTokens:  usage.TotalTokenCount,
+		}
+	}
+
 	if len(genResp.Candidates) == 0 || len(genResp.Candidates[0].Content.Parts) == 0 {
 		return nil, "", fmt.Errorf("no candidates returned")
 	}
@@ -173,3 +349,71 @@ func (p *Provider) Generate(ctx context.Context, prompt string, opts ...generato
 
 	return nil, "", fmt.Errorf("no image data found in response")
 }
+
+// newRequest builds the API request for a prompt, returning it with its JSON body
+func (p *Provider) newRequest(ctx context.Context, prompt string, opts []generator.Option) (*http.Request, []byte, error) {
+	genOpts := &generator.GenerateOptions{}
+	for _, opt := range opts {
+		opt(genOpts)
+	}
+
+	reqPayload := GenerateRequest{
+		Contents: []Content{
+			{
+				Role: "user",
+				Parts: []Part{
+					{Text: prompt},
+				},
+			},
+		},
+		GenerationConfig: &GenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+			ImageConfig: ImageConfig{
+				AspectRatio: genOpts.AspectRatio,
+				ImageSize:   genOpts.ImageSize,
+			},
+		},
+	}
+
+	// Models with a single size reject the imageSize field
+	if caps, ok := models[p.model]; ok && len(caps.ImageSizes) == 0 {
+		reqPayload.GenerationConfig.ImageConfig.ImageSize = ""
+	}
+
+	jsonBody, err := json.Marshal(reqPayload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := p.endpoint
+	if genOpts.Progress != nil {
+		if endpoint, err = streamEndpoint(endpoint); err != nil {
+			return nil, nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "img-gen-cli/1.0")
+	return req, jsonBody, nil
+}
+
+// authorize adds credentials to a request: a bearer token if the provider
+// has a token source, and the API key otherwise
+func (p *Provider) authorize(ctx context.Context, req *http.Request) error {
+	if p.tokenSource == nil {
+		req.Header.Set("x-goog-api-key", p.apiKey)
+		return nil
+	}
+
+	token, err := p.tokenSource.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
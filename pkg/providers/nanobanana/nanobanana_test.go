@@ -0,0 +1,23 @@
+package nanobanana
+
+import "testing"
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		model, want string
+	}{
+		{"", "nano-banana-pro"}, // The default model
+		{"gemini-3-pro-image-preview", "nano-banana-pro"},
+		{"gemini-2.5-flash-image", "nano-banana"},
+		{"gemini-4-image", "gemini"},
+	}
+	for _, tt := range tests {
+		var opts []ProviderOption
+		if tt.model != "" {
+			opts = append(opts, WithModel(tt.model))
+		}
+		if got := New("key", opts...).Name(); got != tt.want {
+			t.Errorf("Name() with model %q = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package nanobanana
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/generator"
+)
+
+// Deadlines of streamed requests
+// High-resolution images can take over a minute, and the model may send
+// nothing while it draws, so the gaps allowed between chunks are generous.
+const (
+	DefaultStreamTimeout     = 10 * time.Minute
+	DefaultStreamIdleTimeout = 3 * time.Minute
+)
+
+// ErrStreamTimeout is returned when a streamed response misses a deadline
+var ErrStreamTimeout = errors.New("response stream timed out")
+
+// streamContext returns a context for a streamed request that ends after the
+// provider's stream timeout, or when its watchdog is not kicked within the
+// idle timeout. stop releases both timers.
+func (p *Provider) streamContext(ctx context.Context) (context.Context, *idleWatchdog, context.CancelFunc) {
+	cancelTotal := context.CancelFunc(func() {})
+	if p.streamTimeout > 0 {
+		ctx, cancelTotal = context.WithTimeoutCause(ctx, p.streamTimeout,
+			fmt.Errorf("%w: the response was not complete after %s", ErrStreamTimeout, p.streamTimeout))
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	watchdog := &idleWatchdog{timeout: p.streamIdleTimeout}
+	if watchdog.timeout > 0 {
+		watchdog.timer = time.AfterFunc(watchdog.timeout, func() {
+			cancel(fmt.Errorf("%w: no data received for %s", ErrStreamTimeout, watchdog.timeout))
+		})
+	}
+
+	return ctx, watchdog, func() {
+		if watchdog.timer != nil {
+			watchdog.timer.Stop()
+		}
+		cancel(context.Canceled)
+		cancelTotal()
+	}
+}
+
+// idleWatchdog cancels a streamed request when data stops arriving
+type idleWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer // Nil without an idle timeout
+}
+
+// reader returns body, restarting the idle timeout whenever data is read
+// A nil watchdog returns body unchanged.
+func (w *idleWatchdog) reader(body io.Reader) io.Reader {
+	if w == nil || w.timer == nil {
+		return body
+	}
+	return &idleReader{body: body, watchdog: w}
+}
+
+// idleReader restarts its watchdog's timer on every read that returns data
+type idleReader struct {
+	body     io.Reader
+	watchdog *idleWatchdog
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.watchdog.timer.Reset(r.watchdog.timeout)
+	}
+	return n, err
+}
+
+// withoutTimeout returns a copy of client without its overall timeout, which
+// would cut off a response still streaming
+func withoutTimeout(client *http.Client) *http.Client {
+	copied := *client
+	copied.Timeout = 0
+	return &copied
+}
+
+// streamError explains an error caused by a missed stream deadline
+func streamError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil && errors.Is(cause, ErrStreamTimeout) {
+		return cause
+	}
+	return err
+}
+
+// streamChunk is one server-sent event of a streamed response
+type streamChunk struct {
+	GenerateResponse
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// streamEndpoint returns the streamGenerateContent URL matching a
+// generateContent URL, asking for server-sent events
+func streamEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(strings.Replace(endpoint, ":generateContent", ":streamGenerateContent", 1))
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("alt", "sse")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// readStream reads a streamed response, reporting progress as chunks arrive,
+// and merges the chunks into one response
+func readStream(body io.Reader, progress generator.ProgressFunc) (*GenerateResponse, error) {
+	merged := &GenerateResponse{Candidates: []Candidate{{}}}
+	reader := bufio.NewReader(body)
+
+	var data strings.Builder
+	started := false
+	for {
+		// Image data arrives as a single line of several megabytes, so lines
+		// are read whole rather than with a size-limited scanner
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read response stream: %w", err)
+		}
+		if !started && line != "" {
+			started = true
+			progress(generator.ProgressEvent{Stage: generator.StageFirstByte})
+		}
+
+		// A blank line ends an event, and so does the end of the stream
+		line = strings.TrimRight(line, "\r\n")
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+		if (line == "" || errors.Is(err, io.EOF)) && data.Len() > 0 {
+			if err := mergeChunk(merged, data.String(), progress); err != nil {
+				return nil, err
+			}
+			data.Reset()
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if !started {
+		return nil, fmt.Errorf("empty response stream")
+	}
+	return merged, nil
+}
+
+// mergeChunk adds the parts and usage of one event to the merged response
+func mergeChunk(merged *GenerateResponse, data string, progress generator.ProgressFunc) error {
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return fmt.Errorf("failed to decode response chunk: %w", err)
+	}
+	if chunk.Error != nil {
+		return fmt.Errorf("api returned error %d: %s", chunk.Error.Code, chunk.Error.Message)
+	}
+
+	// Usage is cumulative, so the last report counts
+	if chunk.UsageMetadata != nil {
+		merged.UsageMetadata = chunk.UsageMetadata
+	}
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+
+	parts := &merged.Candidates[0].Content.Parts
+	for _, part := range chunk.Candidates[0].Content.Parts {
+		*parts = append(*parts, part)
+
+		switch {
+		case part.InlineData != nil:
+			// Base64 holds three bytes in every four characters
+			progress(generator.ProgressEvent{
+				Stage: generator.StageImageReceived,
+				Bytes: len(part.InlineData.Data) / 4 * 3,
+			})
+		case strings.TrimSpace(part.Text) != "":
+			progress(generator.ProgressEvent{Stage: generator.StageText, Text: part.Text})
+		}
+	}
+	return nil
+}
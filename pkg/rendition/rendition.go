@@ -0,0 +1,110 @@
+package rendition
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Dimension is the side of the image a rendition size applies to
+type Dimension string
+
+// Dimension constants
+const (
+	DimensionWidth  Dimension = "w"
+	DimensionHeight Dimension = "h"
+)
+
+// Spec describes a single named rendition, e.g. "thumb=256w"
+type Spec struct {
+	Name      string    // Name appended to the output filename
+	Size      int       // Target size in pixels
+	Dimension Dimension // Whether Size is a width or a height
+}
+
+// Validation errors
+var (
+	ErrInvalidSpec   = errors.New("invalid rendition spec")
+	ErrDuplicateName = errors.New("duplicate rendition name")
+	ErrInvalidName   = errors.New("rendition name may only contain letters, digits, '-' and '_'")
+	ErrInvalidSize   = errors.New("rendition size must be positive")
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseSpecs parses a comma-separated list of renditions such as
+// "thumb=256w, card=800w, hero=1920w". A size without a suffix is a width.
+func ParseSpecs(value string) ([]Spec, error) {
+	var specs []Spec
+	seen := map[string]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, size, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q (expected name=size, e.g. thumb=256w)", ErrInvalidSpec, item)
+		}
+		name = strings.TrimSpace(name)
+		size = strings.ToLower(strings.TrimSpace(size))
+
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateName, name)
+		}
+		seen[name] = true
+
+		dimension := DimensionWidth
+		if strings.HasSuffix(size, string(DimensionHeight)) {
+			dimension = DimensionHeight
+		}
+		size = strings.TrimSuffix(strings.TrimSuffix(size, string(DimensionWidth)), string(DimensionHeight))
+
+		pixels, err := strconv.Atoi(size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSpec, item)
+		}
+		if pixels <= 0 {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidSize, pixels)
+		}
+
+		specs = append(specs, Spec{Name: name, Size: pixels, Dimension: dimension})
+	}
+
+	return specs, nil
+}
+
+// Dimensions calculates the output size of a rendition for a source image,
+// maintaining aspect ratio. Renditions are never upscaled beyond the source.
+func (s Spec) Dimensions(srcWidth, srcHeight int) (width, height int) {
+	if s.Dimension == DimensionHeight {
+		height = min(s.Size, srcHeight)
+		width = int(float64(srcWidth) * float64(height) / float64(srcHeight))
+	} else {
+		width = min(s.Size, srcWidth)
+		height = int(float64(srcHeight) * float64(width) / float64(srcWidth))
+	}
+
+	return max(width, 1), max(height, 1)
+}
+
+// Render resamples the source image to the rendition size using Catmull-Rom
+func Render(src image.Image, s Spec) image.Image {
+	bounds := src.Bounds()
+	width, height := s.Dimensions(bounds.Dx(), bounds.Dy())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	return dst
+}
@@ -29,16 +29,129 @@ func GetToolDefinition() ToolDefinition {
 				"aspect_ratio": map[string]interface{}{
 					"type":        "string",
 					"description": "The aspect ratio of the image (e.g., '16:9', '1:1').",
-					"enum":        []string{"1:1", "16:9", "4:3", "3:2"},
+					"enum":        []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"},
 				},
 				"image_size": map[string]interface{}{
 					"type":        "string",
-					"description": "The size of the image (e.g., '1K', '2K', '4K').",
+					"description": "The size of the image (e.g., '1K', '2K', '4K'). Defaults to the model's default size: '2K' for gemini-3-pro-image-preview, '1K' (the only size) for gemini-2.5-flash-image.",
 					"enum":        []string{"1K", "2K", "4K"},
 				},
+				"model": map[string]string{
+					"type":        "string",
+					"description": "Optional Gemini image model. Use 'gemini-2.5-flash-image' for cheap, fast drafts and 'gemini-3-pro-image-preview' for final, high-resolution images. Defaults to $IMG_GEN_MODEL or 'gemini-3-pro-image-preview'.",
+				},
+				"api_version": map[string]string{
+					"type":        "string",
+					"description": "Optional API version used in the endpoint. Default: 'v1beta', or 'v1' on Vertex AI.",
+				},
+				"vertex": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Call the model through Vertex AI, authenticating with a service account key file instead of an API key. Defaults to $GOOGLE_GENAI_USE_VERTEXAI.",
+				},
+				"vertex_credentials": map[string]string{
+					"type":        "string",
+					"description": "Optional path to the service account JSON key file used with vertex. Defaults to $GOOGLE_APPLICATION_CREDENTIALS.",
+				},
+				"vertex_project": map[string]string{
+					"type":        "string",
+					"description": "Optional Google Cloud project used with vertex. Defaults to $GOOGLE_CLOUD_PROJECT, then the key file's project.",
+				},
+				"vertex_location": map[string]string{
+					"type":        "string",
+					"description": "Optional Vertex AI location (e.g., 'us-central1'). Defaults to $GOOGLE_CLOUD_LOCATION, then 'global'.",
+				},
+				"format": map[string]interface{}{
+					"type":        "string",
+					"description": "Output image format. Defaults to the format returned by the provider.",
+					"enum":        []string{"png", "jpeg", "webp"},
+				},
+				"quality": map[string]interface{}{
+					"type":        "integer",
+					"description": "JPEG or WebP output quality (1-100). Default: 95 for JPEG, 80 for WebP; 100 makes WebP lossless. Not supported with PNG output. Requires format, or an output path with an extension, so it can be checked before generating.",
+					"minimum":     1,
+					"maximum":     100,
+				},
+				"png_compression": map[string]interface{}{
+					"type":        "string",
+					"description": "PNG compression level. Default: 'default'.",
+					"enum":        []string{"default", "none", "fast", "best"},
+				},
+				"filename_template": map[string]string{
+					"type":        "string",
+					"description": "Optional file name, without extension, relative to the output directory. Tokens: {date}, {time}, {unix}, {id}, {slug} (from the prompt), {provider}, {model}, {ratio}, {size}, {hash} and {seq}; '/' creates subdirectories (e.g., '{date}/{slug}-{seq}'). Existing files are never overwritten. Default: 'img_{unix}'.",
+				},
+				"output": map[string]string{
+					"type":        "string",
+					"description": "Optional exact path to save the image to, instead of a name in the output directory. The extension (.png, .jpg, .webp) selects the format. Fails if the file already exists.",
+				},
+				"restrict_to": map[string]string{
+					"type":        "string",
+					"description": "Optional directory that all output must stay inside; paths with '..' or symlinks leading out of it are rejected. Agents should pass '.' to keep output inside the working directory.",
+				},
+				"renditions": map[string]string{
+					"type":        "string",
+					"description": "Optional comma-separated list of resized variants saved next to the image, as name=size pairs with a 'w' (width) or 'h' (height) suffix (e.g., 'thumb=256w,card=800w,hero=1920w'). Renditions are never upscaled.",
+				},
+				"no_metadata": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Do not embed generation metadata (prompt, provider, model, aspect ratio, timestamp and watermark settings) in the image. By default it is written to PNG text chunks or JPEG/WebP XMP and EXIF, and can be read with 'img-gen inspect <image>'.",
+				},
+				"no_history": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Do not record this generation in the local history. By default every run is recorded, and 'img-gen history show <image>' reports the prompt and options that made an image.",
+				},
+				"progress": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Stream the response and write progress as NDJSON events ({\"event\":\"progress\",\"stage\":...,\"elapsed_ms\":...}) before the result line: request_sent, first_byte, text, image_received, cached, watermarking, converting, saving, renditions.",
+				},
+				"dry_run": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Validate all options and return the provider request (API key redacted) and the output plan with status 'dry_run', without calling the API or writing files. Needs no API key; missing credentials are listed in 'warnings'.",
+				},
+				"no_cache": map[string]string{
+					"type":        "boolean",
+					"description": "Optional. Always call the provider instead of returning a cached image for an identical earlier request (same provider, backend, endpoint and API version, model, prompt and options). Cached results report \"cached\": true.",
+				},
+				"cache_ttl": map[string]string{
+					"type":        "string",
+					"description": "Optional duration cached images are reused for (e.g., '24h', '30m'); '0' keeps them until evicted for space. Default: '168h'.",
+				},
+				"cache_max_size": map[string]string{
+					"type":        "string",
+					"description": "Optional maximum size of the response cache (e.g., '500MB', '2GB'); least recently used images are evicted first, '0' is unlimited. Default: '500MB'.",
+				},
+				"max_spend": map[string]string{
+					"type":        "string",
+					"description": "Optional spending limits in USD per day and/or month (e.g., '5/day,100/month'). The request is refused if it would exceed a limit. Defaults to $IMG_GEN_MAX_SPEND.",
+				},
+				"price_table": map[string]string{
+					"type":        "string",
+					"description": "Optional path to a JSON or YAML file of model prices used to estimate cost_usd, overriding the built-in table. Defaults to $IMG_GEN_PRICE_TABLE.",
+				},
+				"project": map[string]string{
+					"type":        "string",
+					"description": "Optional project name that spend is recorded under and max_spend applies to. Defaults to $IMG_GEN_PROJECT.",
+				},
+				"sign_cert": map[string]string{
+					"type":        "string",
+					"description": "Optional path to a PEM certificate chain used to sign a provenance manifest (img-gen's own format, not C2PA) declaring the image as AI-generated and listing its edits. Requires sign_key. Defaults to $IMG_GEN_SIGNING_CERT.",
+				},
+				"sign_key": map[string]string{
+					"type":        "string",
+					"description": "Optional path to the PEM private key (ECDSA, RSA or Ed25519) matching sign_cert. Defaults to $IMG_GEN_SIGNING_KEY.",
+				},
+				"watermark_layers": map[string]string{
+					"type":        "string",
+					"description": "Optional path to a JSON or YAML file listing watermark layers (e.g., a logo and a copyright line) applied in order. Each layer uses the watermark option names without the 'watermark_' prefix.",
+				},
+				"watermark_layer": map[string]interface{}{
+					"type":        "array",
+					"description": "Optional watermark layers as JSON objects, applied in order after watermark_layers (e.g., '{\"text\":\"© Acme\",\"position\":\"bottom-left\"}'). Pass one --watermark-layer flag per item.",
+					"items":       map[string]string{"type": "string"},
+				},
 				"watermark_text": map[string]string{
 					"type":        "string",
-					"description": "Optional text to use as watermark on the generated image. Cannot be used with watermark_image.",
+					"description": "Optional text to use as watermark on the generated image. Use '\\n' for line breaks. Cannot be used with watermark_image.",
 				},
 				"watermark_image": map[string]string{
 					"type":        "string",
@@ -46,8 +159,34 @@ func GetToolDefinition() ToolDefinition {
 				},
 				"watermark_position": map[string]interface{}{
 					"type":        "string",
-					"description": "Position of the watermark on the image. Default: 'bottom-right'.",
-					"enum":        []string{"top-left", "top-center", "top-right", "left-center", "center", "right-center", "bottom-left", "bottom-center", "bottom-right"},
+					"description": "Position of the watermark on the image: one of the nine anchors, 'tile' to repeat it across the whole image, 'auto' to pick the least busy corner, or normalized coordinates of the watermark centre such as 'x=0.9,y=0.1'. Default: 'bottom-right'.",
+					"pattern":     "^(top-left|top-center|top-right|left-center|center|right-center|bottom-left|bottom-center|bottom-right|tile|auto|x=[0-9.]+,\\s*y=[0-9.]+)$",
+				},
+				"watermark_auto_positions": map[string]string{
+					"type":        "string",
+					"description": "Comma-separated candidate positions considered when watermark_position is 'auto'. Default: the four corners.",
+				},
+				"watermark_auto_contrast": map[string]string{
+					"type":        "boolean",
+					"description": "Pick black or white text, or invert a monochrome logo, to contrast with the image under the watermark. Default: true when watermark_position is 'auto' and watermark_text_color is not set, otherwise false.",
+				},
+				"watermark_blend_mode": map[string]interface{}{
+					"type":        "string",
+					"description": "How the watermark is blended with the image, e.g. 'multiply' for embossed logos or 'soft-light' for subtle marks. Default: 'normal'.",
+					"enum":        []string{"normal", "multiply", "screen", "overlay", "soft-light"},
+				},
+				"watermark_rotation": map[string]interface{}{
+					"type":        "number",
+					"description": "Counter-clockwise rotation of the watermark in degrees (e.g., 90 for a vertical side credit, 45 for a stamp). Default: 0.",
+				},
+				"watermark_tile_spacing": map[string]interface{}{
+					"type":        "integer",
+					"description": "Gap between repeated watermarks in pixels when watermark_position is 'tile'. Default: 80.",
+					"minimum":     0,
+				},
+				"watermark_tile_angle": map[string]interface{}{
+					"type":        "number",
+					"description": "Additional counter-clockwise rotation of each repeated watermark in degrees when watermark_position is 'tile'. Default: 30.",
 				},
 				"watermark_opacity": map[string]interface{}{
 					"type":        "number",
@@ -60,6 +199,18 @@ func GetToolDefinition() ToolDefinition {
 					"description": "Margin from edge in pixels. Default: 20.",
 					"minimum":     0,
 				},
+				"watermark_margin_percent": map[string]interface{}{
+					"type":        "number",
+					"description": "Margin as a percentage of the image's shorter side, so one preset works across image sizes. Overrides watermark_margin.",
+					"minimum":     0,
+					"maximum":     100,
+				},
+				"watermark_text_size_percent": map[string]interface{}{
+					"type":        "number",
+					"description": "Font size as a percentage of the image's shorter side, so one preset works across image sizes. Overrides watermark_text_size.",
+					"minimum":     0,
+					"maximum":     100,
+				},
 				"watermark_text_size": map[string]interface{}{
 					"type":        "integer",
 					"description": "Font size for text watermark in pixels. Default: 24.",
@@ -69,12 +220,81 @@ func GetToolDefinition() ToolDefinition {
 					"type":        "string",
 					"description": "Hex color code for text watermark (e.g., '#FFFFFF'). Default: '#FFFFFF'.",
 				},
+				"watermark_text_align": map[string]interface{}{
+					"type":        "string",
+					"description": "Alignment of lines in a multi-line text watermark. Default: 'left'.",
+					"enum":        []string{"left", "center", "right"},
+				},
+				"watermark_line_spacing": map[string]interface{}{
+					"type":        "number",
+					"description": "Line height multiplier for multi-line text watermarks. Default: 1.0.",
+					"minimum":     0.0,
+				},
+				"watermark_max_width": map[string]interface{}{
+					"type":        "number",
+					"description": "Wrap text watermark lines wider than this fraction of the image width (0.0-1.0). Default: 0 (no wrapping).",
+					"minimum":     0.0,
+					"maximum":     1.0,
+				},
+				"watermark_stroke_width": map[string]interface{}{
+					"type":        "integer",
+					"description": "Outline width in pixels around text watermark glyphs. Default: 0 (no outline).",
+					"minimum":     0,
+				},
+				"watermark_stroke_color": map[string]string{
+					"type":        "string",
+					"description": "Hex color code for the text outline. Default: '#000000'.",
+				},
+				"watermark_shadow_color": map[string]string{
+					"type":        "string",
+					"description": "Hex color code for a drop shadow behind text, optionally with alpha (e.g., '#00000080'). Omit to disable.",
+				},
+				"watermark_shadow_x": map[string]interface{}{
+					"type":        "integer",
+					"description": "Drop shadow horizontal offset in pixels. Default: 2.",
+				},
+				"watermark_shadow_y": map[string]interface{}{
+					"type":        "integer",
+					"description": "Drop shadow vertical offset in pixels. Default: 2.",
+				},
+				"watermark_shadow_blur": map[string]interface{}{
+					"type":        "integer",
+					"description": "Drop shadow blur radius in pixels. Default: 4.",
+					"minimum":     0,
+				},
+				"watermark_background": map[string]string{
+					"type":        "string",
+					"description": "Hex color code for a rounded background plate behind text, optionally with alpha (e.g., '#00000099'). Omit to disable.",
+				},
+				"watermark_background_padding": map[string]interface{}{
+					"type":        "integer",
+					"description": "Background plate padding in pixels. Default: 12.",
+					"minimum":     0,
+				},
+				"watermark_background_radius": map[string]interface{}{
+					"type":        "integer",
+					"description": "Background plate corner radius in pixels. Default: 8.",
+					"minimum":     0,
+				},
+				"watermark_font": map[string]string{
+					"type":        "string",
+					"description": "Optional path to a TrueType/OpenType font file (.ttf, .otf) for text watermarks. Defaults to the bundled Go Regular font.",
+				},
 				"watermark_scale": map[string]interface{}{
 					"type":        "number",
 					"description": "Scale factor for image watermark as a percentage of base image width (0.1-1.0). Default: 0.2.",
 					"minimum":     0.1,
 					"maximum":     1.0,
 				},
+				"watermark_resample": map[string]interface{}{
+					"type":        "string",
+					"description": "Resampling kernel used to scale image watermarks and to rotate text or image watermarks. Default: 'catmull-rom'.",
+					"enum":        []string{"nearest", "bilinear", "catmull-rom", "lanczos"},
+				},
+				"invisible_watermark": map[string]string{
+					"type":        "string",
+					"description": "Optional payload (up to 32 bytes, e.g. a team ID and generation ID) embedded as an invisible watermark that survives JPEG recompression, mild resizing and cropping. '{id}' is replaced with the generation ID. Read it back with 'img-gen detect <image>'.",
+				},
 			},
 			Required: []string{"prompt"},
 		},
@@ -0,0 +1,166 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// DefaultAutoPositions are the candidates considered by PositionAuto
+// when Config.AutoPositions is empty
+var DefaultAutoPositions = []Position{
+	PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight,
+}
+
+// sampleStep is the pixel stride used when sampling image regions
+const sampleStep = 2
+
+// luminance returns the relative luminance (0.0-1.0) of a color
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+}
+
+// regionStats returns the mean and standard deviation of luminance in a region
+// The standard deviation is used as a measure of how busy the region is
+func regionStats(img image.Image, region image.Rectangle) (mean, stdDev float64) {
+	region = region.Intersect(img.Bounds())
+	if region.Empty() {
+		return 0, 0
+	}
+
+	var sum, sumSquares float64
+	count := 0
+	for y := region.Min.Y; y < region.Max.Y; y += sampleStep {
+		for x := region.Min.X; x < region.Max.X; x += sampleStep {
+			l := luminance(img.At(x, y))
+			sum += l
+			sumSquares += l * l
+			count++
+		}
+	}
+
+	mean = sum / float64(count)
+	variance := sumSquares/float64(count) - mean*mean
+	return mean, math.Sqrt(math.Max(variance, 0))
+}
+
+// chooseAutoPosition picks the candidate position whose region under the
+// watermark is the least busy
+func chooseAutoPosition(img image.Image, wmWidth, wmHeight, margin int, candidates []Position) Position {
+	if len(candidates) == 0 {
+		candidates = DefaultAutoPositions
+	}
+
+	bounds := img.Bounds()
+	best := candidates[0]
+	bestBusyness := math.Inf(1)
+	for _, pos := range candidates {
+		x, y := CalculatePosition(bounds.Dx(), bounds.Dy(), wmWidth, wmHeight, pos, margin)
+		_, busyness := regionStats(img, image.Rect(x, y, x+wmWidth, y+wmHeight))
+		if busyness < bestBusyness {
+			best = pos
+			bestBusyness = busyness
+		}
+	}
+
+	return best
+}
+
+// contrastTextColor returns black or white, whichever contrasts with the background luminance
+func contrastTextColor(backgroundLuminance float64) string {
+	if backgroundLuminance > 0.5 {
+		return "#000000"
+	}
+	return "#FFFFFF"
+}
+
+// isMonochrome returns true if the visible pixels of an image share a single
+// neutral tone, like a black or white logo
+func isMonochrome(img image.Image) bool {
+	bounds := img.Bounds()
+	var sum, sumSquares float64
+	count := 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += sampleStep {
+		for x := bounds.Min.X; x < bounds.Max.X; x += sampleStep {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue // Ignore (mostly) transparent pixels
+			}
+
+			// Reject saturated colors
+			high := max(c.R, c.G, c.B)
+			low := min(c.R, c.G, c.B)
+			if high-low > 40 {
+				return false
+			}
+
+			l := luminance(color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255})
+			sum += l
+			sumSquares += l * l
+			count++
+		}
+	}
+
+	if count == 0 {
+		return false
+	}
+
+	mean := sum / float64(count)
+	variance := sumSquares/float64(count) - mean*mean
+	return math.Sqrt(math.Max(variance, 0)) < 0.15
+}
+
+// adjustLogoContrast inverts a monochrome logo when it would blend into the
+// background (light on light or dark on dark). Other logos are returned as is.
+func adjustLogoContrast(img image.Image, backgroundLuminance float64) image.Image {
+	if !isMonochrome(img) {
+		return img
+	}
+
+	logoLuminance := opaqueLuminance(img)
+	if (logoLuminance > 0.5) != (backgroundLuminance > 0.5) {
+		return img // Already contrasts
+	}
+
+	bounds := img.Bounds()
+	inverted := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Colors are alpha-premultiplied, so invert against alpha
+			r, g, b, a := img.At(x, y).RGBA()
+			inverted.Set(x, y, color.RGBA64{
+				R: uint16(a - r),
+				G: uint16(a - g),
+				B: uint16(a - b),
+				A: uint16(a),
+			})
+		}
+	}
+
+	return inverted
+}
+
+// opaqueLuminance returns the mean luminance of the visible pixels of an image
+func opaqueLuminance(img image.Image) float64 {
+	bounds := img.Bounds()
+	var sum float64
+	count := 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += sampleStep {
+		for x := bounds.Min.X; x < bounds.Max.X; x += sampleStep {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			sum += luminance(color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255})
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
@@ -0,0 +1,102 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// BlendMode represents how watermark colors are combined with the base image
+type BlendMode string
+
+// BlendMode constants for compositing watermarks
+const (
+	BlendNormal    BlendMode = "normal"
+	BlendMultiply  BlendMode = "multiply"
+	BlendScreen    BlendMode = "screen"
+	BlendOverlay   BlendMode = "overlay"
+	BlendSoftLight BlendMode = "soft-light"
+)
+
+// IsValid returns true if the blend mode is known (empty selects normal)
+func (m BlendMode) IsValid() bool {
+	switch m {
+	case "", BlendNormal, BlendMultiply, BlendScreen, BlendOverlay, BlendSoftLight:
+		return true
+	default:
+		return false
+	}
+}
+
+// blendChannel combines a backdrop channel cb with a source channel cs,
+// both non-premultiplied in the range 0.0-1.0
+func (m BlendMode) blendChannel(cb, cs float64) float64 {
+	switch m {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		// Hard light with the layers swapped
+		if cb <= 0.5 {
+			return 2 * cs * cb
+		}
+		return 1 - 2*(1-cs)*(1-cb)
+	case BlendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		d := math.Sqrt(cb)
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		}
+		return cb + (2*cs-1)*(d-cb)
+	default:
+		return cs
+	}
+}
+
+// composite draws src onto dst at rect using the blend mode
+// Normal mode is a plain source-over; the others follow the W3C compositing
+// model, mixing the blended color with the source by the backdrop's alpha.
+func composite(dst draw.Image, rect image.Rectangle, src image.Image, mode BlendMode) {
+	if mode == "" || mode == BlendNormal {
+		draw.Draw(dst, rect, src, src.Bounds().Min, draw.Over)
+		return
+	}
+
+	clipped := rect.Intersect(dst.Bounds())
+	offset := src.Bounds().Min.Sub(rect.Min)
+
+	for y := clipped.Min.Y; y < clipped.Max.Y; y++ {
+		for x := clipped.Min.X; x < clipped.Max.X; x++ {
+			sr, sg, sb, sa := src.At(x+offset.X, y+offset.Y).RGBA()
+			if sa == 0 {
+				continue
+			}
+			as := float64(sa) / 0xffff
+
+			// Premultiplied backdrop, at the destination's full precision
+			br, bg, bb, ba := dst.At(x, y).RGBA()
+			backdrop := [3]float64{float64(br) / 0xffff, float64(bg) / 0xffff, float64(bb) / 0xffff}
+			ab := float64(ba) / 0xffff
+
+			// Non-premultiplied source color
+			cs := [3]float64{float64(sr) / float64(sa), float64(sg) / float64(sa), float64(sb) / float64(sa)}
+			var out [3]uint16
+			for c := 0; c < 3; c++ {
+				// Non-premultiplied backdrop color
+				pb := backdrop[c]
+				cb := 0.0
+				if ab > 0 {
+					cb = pb / ab
+				}
+
+				mixed := (1-ab)*cs[c] + ab*mode.blendChannel(cb, cs[c])
+				out[c] = uint16(math.Round(math.Min(math.Max(as*mixed+(1-as)*pb, 0), 1) * 0xffff))
+			}
+			dst.Set(x, y, color.RGBA64{R: out[0], G: out[1], B: out[2], A: uint16(math.Round((as + ab*(1-as)) * 0xffff))})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package watermark
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// LoadFont loads a TrueType or OpenType font from a file path
+// An empty path returns the bundled Go Regular font
+func LoadFont(path string) (*opentype.Font, error) {
+	if path == "" {
+		f, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse default font: %w", err)
+		}
+		return f, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font file: %w", err)
+	}
+
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font file: %w", err)
+	}
+
+	return f, nil
+}
+
+// ValidateFont validates that a font file exists and can be parsed
+// This should be called before image generation to fail fast
+func ValidateFont(path string) error {
+	if path == "" {
+		return nil // Bundled default font, nothing to validate
+	}
+
+	// Check if file exists
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("font file not found: %s", path)
+		}
+		return fmt.Errorf("failed to access font file: %w", err)
+	}
+
+	// Check if it's a file (not a directory)
+	if fileInfo.IsDir() {
+		return fmt.Errorf("font path is a directory, not a file: %s", path)
+	}
+
+	// Check file extension
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".ttf" && ext != ".otf" {
+		return fmt.Errorf("%w: %s (supported font formats: TTF, OTF)", ErrUnsupportedFont, ext)
+	}
+
+	// Make sure the font parses
+	_, err = LoadFont(path)
+	return err
+}
+
+// newFace creates a font face rendering at the given pixel size
+func newFace(f *opentype.Font, size int) (font.Face, error) {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     72, // 1 point == 1 pixel
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	return face, nil
+}
@@ -165,8 +165,14 @@ func LoadWatermarkImage(path string) (image.Image, error) {
 }
 
 // ScaleImage scales an image to a specific width while maintaining aspect ratio
-// The scale parameter is a factor (0.1-1.0) of the base image width
+// The scale parameter is a factor (0.1-1.0) of the base image width. The
+// image is resampled with DefaultResample.
 func ScaleImage(img image.Image, scale float64, baseWidth int) image.Image {
+	return ScaleImageWith(img, scale, baseWidth, DefaultResample)
+}
+
+// ScaleImageWith scales an image like ScaleImage, with the given kernel
+func ScaleImageWith(img image.Image, scale float64, baseWidth int, resample Resample) image.Image {
 	bounds := img.Bounds()
 	originalWidth := bounds.Dx()
 	originalHeight := bounds.Dy()
@@ -184,23 +190,7 @@ func ScaleImage(img image.Image, scale float64, baseWidth int) image.Image {
 		newHeight = 1
 	}
 
-	// Create a new image with the target dimensions
-	scaled := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-
-	// Scale using nearest neighbor (simple but fast)
-	for y := 0; y < newHeight; y++ {
-		for x := 0; x < newWidth; x++ {
-			// Map scaled coordinates back to original coordinates
-			srcX := (x * originalWidth) / newWidth
-			srcY := (y * originalHeight) / newHeight
-
-			// Get the color from the original image
-			c := img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY)
-			scaled.Set(x, y, c)
-		}
-	}
-
-	return scaled
+	return resize(img, newWidth, newHeight, resample)
 }
 
 // ApplyOpacity applies an opacity/alpha level to an image
@@ -215,16 +205,14 @@ func ApplyOpacity(img image.Image, opacity float64) image.Image {
 			originalColor := img.At(x, y)
 			r, g, b, a := originalColor.RGBA()
 
-			// Apply opacity to the alpha channel
-			// RGBA() returns values in range [0, 65535], so we need to scale
-			newAlpha := uint16(float64(a) * opacity)
-
-			// Create new color with modified alpha
+			// Apply opacity to every channel
+			// RGBA() returns alpha-premultiplied values in range [0, 65535],
+			// so the color channels must be scaled along with alpha
 			newColor := color.RGBA64{
-				R: uint16(r),
-				G: uint16(g),
-				B: uint16(b),
-				A: newAlpha,
+				R: uint16(float64(r) * opacity),
+				G: uint16(float64(g) * opacity),
+				B: uint16(float64(b) * opacity),
+				A: uint16(float64(a) * opacity),
 			}
 
 			result.Set(x, y, newColor)
@@ -0,0 +1,23 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestApplyOpacityGolden(t *testing.T) {
+	// Composite over a grey base the way Apply does, since premultiplied
+	// colour channels that are not scaled with alpha only show up once blended
+	base := image.NewRGBA(image.Rect(0, 0, 24, 16))
+	draw.Draw(base, base.Bounds(), &image.Uniform{color.RGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+	draw.Draw(base, base.Bounds(), ApplyOpacity(testLogo(), 0.5), image.Point{}, draw.Over)
+	checkGolden(t, "opacity", base)
+
+	// A white pixel at half opacity over grey lands halfway between them
+	// rather than saturating
+	if got := base.RGBAAt(2, 0); got.R < 190 || got.R > 192 {
+		t.Errorf("white at 50%% over grey = %v, want about 191", got)
+	}
+}
@@ -0,0 +1,146 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfig returns a configuration with the default value for every option
+// Layers loaded from files start from these defaults
+func DefaultConfig() Config {
+	return Config{
+		Position:              PositionBottomRight,
+		Margin:                20,
+		TileSpacing:           80,
+		TileAngle:             30,
+		Opacity:               0.7,
+		TextSize:              24,
+		TextColor:             "#FFFFFF",
+		TextAlign:             TextAlignLeft,
+		TextLineSpacing:       1.0,
+		TextStrokeColor:       "#000000",
+		TextShadowOffsetX:     2,
+		TextShadowOffsetY:     2,
+		TextShadowBlur:        4,
+		TextBackgroundPadding: 12,
+		TextBackgroundRadius:  8,
+		Scale:                 0.2,
+		Resample:              DefaultResample,
+		BlendMode:             BlendNormal,
+	}
+}
+
+// ParsePlacement parses a position flag value, which is either one of the
+// Position constants or normalized coordinates such as "x=0.9,y=0.1"
+func ParsePlacement(value string) (Position, *Point, error) {
+	if !strings.Contains(value, "=") {
+		return Position(value), nil, nil
+	}
+
+	point, err := ParsePoint(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", point, nil
+}
+
+// ParseLayer parses a single JSON layer object on top of DefaultConfig
+func ParseLayer(data []byte) (Config, error) {
+	cfg := DefaultConfig()
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse watermark layer: %w", err)
+	}
+
+	if err := cfg.resolvePlacement(); err != nil {
+		return Config{}, err
+	}
+
+	// Auto placement picks a contrasting color too, unless one was given
+	if cfg.Position == PositionAuto {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return Config{}, fmt.Errorf("failed to parse watermark layer: %w", err)
+		}
+		_, colorSet := fields["text_color"]
+		_, contrastSet := fields["auto_contrast"]
+		if !colorSet && !contrastSet {
+			cfg.AutoContrast = true
+		}
+	}
+	return cfg, nil
+}
+
+// LoadLayers reads a list of watermark layers from a JSON or YAML file
+// Each layer starts from DefaultConfig, so only overrides need to be listed
+func LoadLayers(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watermark layer file: %w", err)
+	}
+
+	// Decode the file into one raw JSON object per layer
+	var raw []json.RawMessage
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse watermark layer file: %w", err)
+		}
+
+	case ".yaml", ".yml":
+		var items []map[string]interface{}
+		if err := yaml.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse watermark layer file: %w", err)
+		}
+		for _, item := range items {
+			encoded, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse watermark layer file: %w", err)
+			}
+			raw = append(raw, encoded)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported watermark layer file: %s (expected .json, .yaml or .yml)", path)
+	}
+
+	var layers []Config
+	for i, item := range raw {
+		cfg, err := ParseLayer(item)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", i+1, err)
+		}
+		layers = append(layers, cfg)
+	}
+
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("watermark layer file contains no layers: %s", path)
+	}
+
+	return layers, nil
+}
+
+// resolvePlacement converts a coordinate string in Position into a Point
+func (c *Config) resolvePlacement() error {
+	if c.Point != nil {
+		return nil
+	}
+
+	position, point, err := ParsePlacement(string(c.Position))
+	if err != nil {
+		return err
+	}
+	if point != nil {
+		c.Position = position
+		c.Point = point
+	}
+	return nil
+}
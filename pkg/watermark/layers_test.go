@@ -0,0 +1,25 @@
+package watermark
+
+import "testing"
+
+func TestParseLayerAutoContrast(t *testing.T) {
+	tests := []struct {
+		layer string
+		want  bool
+	}{
+		{`{"text": "©", "position": "auto"}`, true},
+		{`{"text": "©", "position": "auto", "text_color": "#FFFFFF"}`, false},
+		{`{"text": "©", "position": "auto", "auto_contrast": false}`, false},
+		{`{"text": "©", "position": "bottom-left"}`, false},
+		{`{"text": "©", "position": "bottom-left", "auto_contrast": true}`, true},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseLayer([]byte(tt.layer))
+		if err != nil {
+			t.Fatalf("ParseLayer(%s): %v", tt.layer, err)
+		}
+		if cfg.AutoContrast != tt.want {
+			t.Errorf("ParseLayer(%s).AutoContrast = %v, want %v", tt.layer, cfg.AutoContrast, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package watermark
+
+import (
+	"image"
+	"image/draw"
+)
+
+// newCanvas copies an image onto a drawable canvas in its display
+// orientation. Sources with 16 bits per channel get a 16-bit canvas so that
+// watermarking does not reduce their precision.
+func newCanvas(img image.Image, orientation int) draw.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if swapsAxes(orientation) {
+		width, height = height, width
+	}
+
+	var canvas draw.Image
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		canvas = image.NewRGBA64(image.Rect(0, 0, width, height))
+	default:
+		canvas = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	if orientation <= 1 || orientation > 8 {
+		draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+		return canvas
+	}
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			dx, dy := orientPoint(orientation, x, y, bounds.Dx(), bounds.Dy())
+			canvas.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return canvas
+}
+
+// restoreOrientation turns a canvas made by newCanvas back into the stored
+// orientation, so the original EXIF orientation still applies to it
+func restoreOrientation(canvas draw.Image, orientation int) draw.Image {
+	if orientation <= 1 || orientation > 8 {
+		return canvas
+	}
+
+	width, height := canvas.Bounds().Dx(), canvas.Bounds().Dy()
+	if swapsAxes(orientation) {
+		width, height = height, width
+	}
+
+	var stored draw.Image
+	if _, ok := canvas.(*image.RGBA64); ok {
+		stored = image.NewRGBA64(image.Rect(0, 0, width, height))
+	} else {
+		stored = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := orientPoint(orientation, x, y, width, height)
+			stored.Set(x, y, canvas.At(dx, dy))
+		}
+	}
+	return stored
+}
+
+// orientPoint maps a pixel of a stored image of the given size to its
+// position once the EXIF orientation is applied
+func orientPoint(orientation, x, y, width, height int) (int, int) {
+	switch orientation {
+	case 2: // Mirrored horizontally
+		return width - 1 - x, y
+	case 3: // Rotated 180°
+		return width - 1 - x, height - 1 - y
+	case 4: // Mirrored vertically
+		return x, height - 1 - y
+	case 5: // Transposed
+		return y, x
+	case 6: // Rotated 90° clockwise
+		return height - 1 - y, x
+	case 7: // Transversed
+		return height - 1 - y, width - 1 - x
+	case 8: // Rotated 90° counter-clockwise
+		return y, width - 1 - x
+	default:
+		return x, y
+	}
+}
+
+// swapsAxes reports whether an EXIF orientation swaps width and height
+func swapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
@@ -1,5 +1,12 @@
 package watermark
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
 // CalculatePosition calculates the x,y coordinates for placing a watermark
 // on a base image based on the desired position and margin.
 //
@@ -45,3 +52,50 @@ func CalculatePosition(baseWidth, baseHeight, wmWidth, wmHeight int, pos Positio
 		return baseWidth - wmWidth - margin, baseHeight - wmHeight - margin
 	}
 }
+
+// CalculatePointPosition calculates the x,y coordinates for centring a
+// watermark on a normalized point of the base image. The watermark is
+// clamped so it stays inside the image where possible.
+func CalculatePointPosition(baseWidth, baseHeight, wmWidth, wmHeight int, p Point) (x, y int) {
+	x = int(math.Round(p.X*float64(baseWidth))) - wmWidth/2
+	y = int(math.Round(p.Y*float64(baseHeight))) - wmHeight/2
+
+	x = max(min(x, baseWidth-wmWidth), 0)
+	y = max(min(y, baseHeight-wmHeight), 0)
+	return x, y
+}
+
+// ParsePoint parses normalized coordinates in the form "x=0.9,y=0.1"
+func ParsePoint(value string) (*Point, error) {
+	point := &Point{}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(value, ",") {
+		key, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q (expected x=0.9,y=0.1)", ErrInvalidPoint, value)
+		}
+
+		coord, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPoint, value)
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch key {
+		case "x":
+			point.X = coord
+		case "y":
+			point.Y = coord
+		default:
+			return nil, fmt.Errorf("%w: unknown coordinate %q", ErrInvalidPoint, key)
+		}
+		seen[key] = true
+	}
+
+	if !seen["x"] || !seen["y"] {
+		return nil, fmt.Errorf("%w: %q (both x and y are required)", ErrInvalidPoint, value)
+	}
+
+	return point, nil
+}
@@ -0,0 +1,71 @@
+package watermark
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Resample represents the interpolation kernel used when scaling watermarks
+type Resample string
+
+// Resample constants for watermark scaling
+const (
+	ResampleNearest    Resample = "nearest"
+	ResampleBilinear   Resample = "bilinear"
+	ResampleCatmullRom Resample = "catmull-rom"
+	ResampleLanczos    Resample = "lanczos"
+)
+
+// DefaultResample is the kernel used when none is configured
+const DefaultResample = ResampleCatmullRom
+
+// lanczos3 is a Lanczos kernel with a support radius of 3
+var lanczos3 = &draw.Kernel{
+	Support: 3,
+	At: func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		if t < 0 {
+			t = -t
+		}
+		if t >= 3 {
+			return 0
+		}
+		piT := math.Pi * t
+		return 3 * math.Sin(piT) * math.Sin(piT/3) / (piT * piT)
+	},
+}
+
+// IsValid returns true if the resample kernel is known (empty selects the default)
+func (r Resample) IsValid() bool {
+	switch r {
+	case "", ResampleNearest, ResampleBilinear, ResampleCatmullRom, ResampleLanczos:
+		return true
+	default:
+		return false
+	}
+}
+
+// interpolator returns the draw.Interpolator implementing the kernel
+func (r Resample) interpolator() draw.Interpolator {
+	switch r {
+	case ResampleNearest:
+		return draw.NearestNeighbor
+	case ResampleBilinear:
+		return draw.BiLinear
+	case ResampleLanczos:
+		return lanczos3
+	default:
+		return draw.CatmullRom
+	}
+}
+
+// resize scales an image to exactly width x height using the given kernel
+func resize(img image.Image, width, height int, resample Resample) *image.RGBA {
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	resample.interpolator().Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return scaled
+}
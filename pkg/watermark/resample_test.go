@@ -0,0 +1,158 @@
+package watermark
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// update rewrites the golden files: go test ./pkg/watermark -update
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// goldenTolerance allows for floating point differences between platforms,
+// such as fused multiply-adds on arm64
+const goldenTolerance = 2
+
+// kernels are the resampling kernels with golden images
+var kernels = []Resample{ResampleNearest, ResampleBilinear, ResampleCatmullRom, ResampleLanczos}
+
+// testLogo returns a small logo-like image with hard edges, a gradient and
+// transparency, where the kernels give visibly different results
+func testLogo() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 24, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 24; x++ {
+			switch {
+			case x < 8 && (x/2+y/2)%2 == 0:
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+			case x < 8:
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			case x < 16:
+				img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 128, 255})
+			case (x-20)*(x-20)+(y-8)*(y-8) <= 12:
+				img.Set(x, y, color.RGBA{200, 30, 30, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestScaleImageGolden(t *testing.T) {
+	tests := []struct {
+		name      string
+		scale     float64
+		baseWidth int
+	}{
+		{"up", 0.5, 200},    // 24px to 100px wide
+		{"down", 0.25, 40},  // 24px to 10px wide
+		{"fraction", 1, 37}, // 24px to 37px wide, a non-integer factor
+	}
+
+	for _, kernel := range kernels {
+		for _, tt := range tests {
+			name := fmt.Sprintf("scale_%s_%s", kernel, tt.name)
+			t.Run(name, func(t *testing.T) {
+				got := ScaleImageWith(testLogo(), tt.scale, tt.baseWidth, kernel)
+				checkGolden(t, name, got)
+			})
+		}
+	}
+}
+
+func TestScaleImageDefault(t *testing.T) {
+	got := toRGBA(ScaleImage(testLogo(), 0.5, 200))
+	want := toRGBA(ScaleImageWith(testLogo(), 0.5, 200, DefaultResample))
+	if string(got.Pix) != string(want.Pix) {
+		t.Errorf("ScaleImage differs from ScaleImageWith(%s)", DefaultResample)
+	}
+}
+
+func TestRenderTextGolden(t *testing.T) {
+	// Text is rasterized at its final size, so the kernel only resamples it
+	// when the watermark is rotated
+	text, err := RenderText("Sample", TextStyle{Size: 20, Color: "#1E40AF"})
+	if err != nil {
+		t.Fatalf("RenderText: %v", err)
+	}
+	checkGolden(t, "text", text)
+
+	for _, kernel := range kernels {
+		name := fmt.Sprintf("text_%s_rotated", kernel)
+		t.Run(name, func(t *testing.T) {
+			checkGolden(t, name, RotateImage(text, 30, kernel))
+		})
+	}
+}
+
+func TestKernelsDiffer(t *testing.T) {
+	// A kernel that silently fell back to the default would still match a
+	// golden file written after the regression, so check they differ
+	seen := map[string]Resample{}
+	for _, kernel := range kernels {
+		got := toRGBA(ScaleImageWith(testLogo(), 0.5, 200, kernel))
+		key := string(got.Pix)
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s produce identical images", other, kernel)
+		}
+		seen[key] = kernel
+	}
+}
+
+// checkGolden compares an image with testdata/<name>.png, within
+// goldenTolerance per channel, or rewrites the file with -update
+func checkGolden(t *testing.T, name string, got image.Image) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".png")
+
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("missing golden file (run go test -update): %v", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", path, err)
+	}
+
+	want, have := toRGBA(decoded), toRGBA(got)
+	if want.Bounds().Size() != have.Bounds().Size() {
+		t.Fatalf("size = %v, golden %s is %v", have.Bounds().Size(), path, want.Bounds().Size())
+	}
+	for i := range want.Pix {
+		if diff := int(want.Pix[i]) - int(have.Pix[i]); diff > goldenTolerance || diff < -goldenTolerance {
+			pixel := i / 4
+			x, y := pixel%want.Rect.Dx(), pixel/want.Rect.Dx()
+			t.Fatalf("pixel (%d, %d) channel %d = %d, golden %s has %d",
+				x, y, i%4, have.Pix[i], path, want.Pix[i])
+		}
+	}
+}
+
+// toRGBA copies an image into an RGBA image whose bounds start at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,45 @@
+package watermark
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// RotateImage rotates an image counter-clockwise by the given angle in degrees
+// The result is sized to the rotated bounding box, with transparent corners
+func RotateImage(img image.Image, degrees float64, resample Resample) image.Image {
+	if math.Mod(degrees, 360) == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+
+	radians := degrees * math.Pi / 180
+	sin, cos := math.Sincos(radians)
+
+	// Size of the rotated bounding box
+	rotatedWidth := int(math.Ceil(math.Abs(width*cos) + math.Abs(height*sin)))
+	rotatedHeight := int(math.Ceil(math.Abs(width*sin) + math.Abs(height*cos)))
+	rotated := image.NewRGBA(image.Rect(0, 0, max(rotatedWidth, 1), max(rotatedHeight, 1)))
+
+	// Map source to destination: move the source centre to the origin,
+	// rotate (y points down, so counter-clockwise flips the sine terms),
+	// then move the origin to the destination centre
+	srcCX := float64(bounds.Min.X) + width/2
+	srcCY := float64(bounds.Min.Y) + height/2
+	dstCX := float64(rotated.Bounds().Dx()) / 2
+	dstCY := float64(rotated.Bounds().Dy()) / 2
+	srcToDst := f64.Aff3{
+		cos, sin, dstCX - (cos*srcCX + sin*srcCY),
+		-sin, cos, dstCY - (-sin*srcCX + cos*srcCY),
+	}
+
+	resample.interpolator().Transform(rotated, srcToDst, img, bounds, draw.Over, nil)
+
+	return rotated
+}
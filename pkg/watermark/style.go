@@ -0,0 +1,172 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// hasEffects returns true if the style requests a stroke, shadow or background plate
+func (s TextStyle) hasEffects() bool {
+	return s.StrokeWidth > 0 || s.ShadowColor != "" || s.BackgroundColor != ""
+}
+
+// applyTextEffects composites the stroke, drop shadow and background plate
+// around rendered text. The canvas grows to fit every effect.
+func applyTextEffects(textImg *image.RGBA, style TextStyle) (image.Image, error) {
+	// Content is the text plus its stroke, with the stroke's top-left at (0,0)
+	stroke := max(style.StrokeWidth, 0)
+	content := image.Rect(0, 0, textImg.Bounds().Dx()+2*stroke, textImg.Bounds().Dy()+2*stroke)
+	textRect := textImg.Bounds().Add(image.Pt(stroke, stroke))
+
+	// Alpha mask of the glyphs (dilated by the stroke width)
+	glyphMask := image.NewAlpha(content)
+	draw.Draw(glyphMask, textRect, textImg, image.Point{}, draw.Src)
+	if stroke > 0 {
+		glyphMask = dilate(glyphMask, stroke)
+	}
+
+	// Work out the full canvas covering every effect
+	canvasRect := content
+	var plateRect, shadowRect image.Rectangle
+	if style.BackgroundColor != "" {
+		plateRect = content.Inset(-max(style.BackgroundPadding, 0))
+		canvasRect = canvasRect.Union(plateRect)
+	}
+	if style.ShadowColor != "" {
+		blur := max(style.ShadowBlur, 0)
+		shadowRect = content.Add(image.Pt(style.ShadowOffsetX, style.ShadowOffsetY)).Inset(-blur)
+		canvasRect = canvasRect.Union(shadowRect)
+	}
+
+	// Shift everything so the canvas starts at (0,0)
+	shift := image.Point{}.Sub(canvasRect.Min)
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasRect.Dx(), canvasRect.Dy()))
+
+	// Background plate
+	if style.BackgroundColor != "" {
+		plateColor, err := ParseHexColor(style.BackgroundColor)
+		if err != nil {
+			return nil, err
+		}
+		plate := roundedRectMask(plateRect.Dx(), plateRect.Dy(), style.BackgroundRadius)
+		draw.DrawMask(canvas, plateRect.Add(shift), &image.Uniform{plateColor}, image.Point{}, plate, image.Point{}, draw.Over)
+	}
+
+	// Drop shadow of the glyphs and stroke
+	if style.ShadowColor != "" {
+		shadowColor, err := ParseHexColor(style.ShadowColor)
+		if err != nil {
+			return nil, err
+		}
+		blur := max(style.ShadowBlur, 0)
+		shadowMask := image.NewAlpha(image.Rect(0, 0, shadowRect.Dx(), shadowRect.Dy()))
+		draw.Draw(shadowMask, content.Add(image.Pt(blur, blur)), glyphMask, image.Point{}, draw.Src)
+		if blur > 0 {
+			shadowMask = boxBlur(shadowMask, blur)
+		}
+		draw.DrawMask(canvas, shadowRect.Add(shift), &image.Uniform{shadowColor}, image.Point{}, shadowMask, image.Point{}, draw.Over)
+	}
+
+	// Stroke outline
+	if stroke > 0 {
+		strokeColor, err := ParseHexColor(style.StrokeColor)
+		if err != nil {
+			return nil, err
+		}
+		draw.DrawMask(canvas, content.Add(shift), &image.Uniform{strokeColor}, image.Point{}, glyphMask, image.Point{}, draw.Over)
+	}
+
+	// Text on top
+	draw.Draw(canvas, textRect.Add(shift), textImg, image.Point{}, draw.Over)
+
+	return canvas, nil
+}
+
+// dilate grows an alpha mask by radius pixels using an anti-aliased disc
+func dilate(mask *image.Alpha, radius int) *image.Alpha {
+	bounds := mask.Bounds()
+	result := image.NewAlpha(bounds)
+	r := float64(radius)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var best float64
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					// Coverage falls off over the last pixel of the disc
+					coverage := math.Min(r+0.5-math.Hypot(float64(dx), float64(dy)), 1)
+					if coverage <= 0 {
+						continue
+					}
+					a := float64(mask.AlphaAt(x+dx, y+dy).A) * coverage
+					if a > best {
+						best = a
+					}
+				}
+			}
+			result.SetAlpha(x, y, color.Alpha{A: uint8(best)})
+		}
+	}
+
+	return result
+}
+
+// boxBlur approximates a Gaussian blur with three separable box blur passes
+func boxBlur(mask *image.Alpha, radius int) *image.Alpha {
+	passRadius := max(radius/3, 1)
+	result := mask
+	for i := 0; i < 3; i++ {
+		result = boxBlurPass(result, passRadius, true)
+		result = boxBlurPass(result, passRadius, false)
+	}
+	return result
+}
+
+// boxBlurPass blurs an alpha mask along one axis
+func boxBlurPass(mask *image.Alpha, radius int, horizontal bool) *image.Alpha {
+	bounds := mask.Bounds()
+	result := image.NewAlpha(bounds)
+	window := 2*radius + 1
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			sum := 0
+			for d := -radius; d <= radius; d++ {
+				if horizontal {
+					sum += int(mask.AlphaAt(x+d, y).A)
+				} else {
+					sum += int(mask.AlphaAt(x, y+d).A)
+				}
+			}
+			result.SetAlpha(x, y, color.Alpha{A: uint8(sum / window)})
+		}
+	}
+
+	return result
+}
+
+// roundedRectMask creates an anti-aliased rounded rectangle alpha mask
+func roundedRectMask(width, height, radius int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	r := float64(min(max(radius, 0), width/2, height/2))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Distance from the pixel centre to the nearest corner circle centre
+			px, py := float64(x)+0.5, float64(y)+0.5
+			cx := math.Max(r, math.Min(px, float64(width)-r))
+			cy := math.Max(r, math.Min(py, float64(height)-r))
+			dist := math.Hypot(px-cx, py-cy)
+
+			coverage := math.Max(0, math.Min(1, r-dist+0.5))
+			if r == 0 {
+				coverage = 1
+			}
+			mask.SetAlpha(x, y, color.Alpha{A: uint8(coverage * 255)})
+		}
+	}
+
+	return mask
+}
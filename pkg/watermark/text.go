@@ -9,25 +9,84 @@ import (
 	"strings"
 
 	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/math/fixed"
 )
 
-// RenderText renders text as an image with the specified size and color
-func RenderText(text string, size int, colorHex string) (image.Image, error) {
+// TextStyle contains the parameters for rendering a text watermark
+type TextStyle struct {
+	Size        int       // Font size in pixels
+	Color       string    // Hex color string (e.g., "#FFFFFF")
+	Font        string    // Path to a TTF/OTF font file (empty uses the bundled Go Regular font)
+	Align       TextAlign // Horizontal alignment of lines within the text block
+	LineSpacing float64   // Line height multiplier (0 uses the font's natural line height)
+	MaxWidth    int       // Maximum line width in pixels before wrapping (0 disables wrapping)
+
+	// Outline around the glyphs
+	StrokeWidth int    // Stroke width in pixels (0 disables the stroke)
+	StrokeColor string // Hex color string for the stroke
+
+	// Drop shadow behind the glyphs
+	ShadowColor   string // Hex color string, optionally with alpha (empty disables the shadow)
+	ShadowOffsetX int    // Horizontal shadow offset in pixels
+	ShadowOffsetY int    // Vertical shadow offset in pixels
+	ShadowBlur    int    // Shadow blur radius in pixels
+
+	// Background plate behind the text
+	BackgroundColor   string // Hex color string, optionally with alpha (empty disables the plate)
+	BackgroundPadding int    // Padding between the text and the plate edge in pixels
+	BackgroundRadius  int    // Corner radius of the plate in pixels
+}
+
+// textLine is a single line of laid-out text
+type textLine struct {
+	text  string
+	left  fixed.Int26_6 // Left glyph overhang (<= 0)
+	right fixed.Int26_6 // Right edge of the line
+}
+
+// RenderText renders text as an image with the specified style
+// Lines are split on "\n" and wrapped at word boundaries to style.MaxWidth
+func RenderText(text string, style TextStyle) (image.Image, error) {
 	// Parse the color
-	textColor, err := ParseHexColor(colorHex)
+	textColor, err := ParseHexColor(style.Color)
 	if err != nil {
 		return nil, fmt.Errorf("invalid text color: %w", err)
 	}
 
-	// Use basicfont for MVP (simple built-in font)
-	// Note: basicfont is fixed-size, so we'll scale the result if needed
-	face := basicfont.Face7x13
+	// Load the font and create a face at the requested pixel size
+	f, err := LoadFont(style.Font)
+	if err != nil {
+		return nil, err
+	}
+	face, err := newFace(f, style.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	// Lay out the lines and measure the text block
+	lines := layoutLines(face, text, fixed.I(style.MaxWidth))
+	blockLeft, blockRight := fixed.Int26_6(0), fixed.Int26_6(0)
+	for _, line := range lines {
+		blockLeft = min(blockLeft, line.left)
+		blockRight = max(blockRight, line.right)
+	}
 
-	// Calculate text dimensions
-	textWidth := font.MeasureString(face, text).Ceil()
-	textHeight := face.Metrics().Height.Ceil()
+	metrics := face.Metrics()
+	lineSpacing := style.LineSpacing
+	if lineSpacing <= 0 {
+		lineSpacing = 1.0
+	}
+	lineAdvance := fixed.Int26_6(float64(metrics.Height) * lineSpacing)
+
+	textWidth := (blockRight - blockLeft).Ceil()
+	textHeight := (metrics.Ascent + metrics.Descent + lineAdvance*fixed.Int26_6(len(lines)-1)).Ceil()
+	if textWidth <= 0 {
+		textWidth = 1
+	}
+	if textHeight <= 0 {
+		textHeight = 1
+	}
 
 	// Create an image for the text
 	textImg := image.NewRGBA(image.Rect(0, 0, textWidth, textHeight))
@@ -40,62 +99,83 @@ func RenderText(text string, size int, colorHex string) (image.Image, error) {
 		Dst:  textImg,
 		Src:  &image.Uniform{textColor},
 		Face: face,
-		Dot:  fixed.Point26_6{X: 0, Y: face.Metrics().Ascent},
 	}
 
-	// Draw the text
-	drawer.DrawString(text)
+	// Draw each line at its aligned offset
+	blockWidth := blockRight - blockLeft
+	for i, line := range lines {
+		lineWidth := line.right - line.left
+		x := -line.left
+		switch style.Align {
+		case TextAlignCenter:
+			x += (blockWidth - lineWidth) / 2
+		case TextAlignRight:
+			x += blockWidth - lineWidth
+		}
 
-	// Scale the text to the desired size if needed
-	// basicfont is roughly 13 pixels tall, so we scale proportionally
-	baseFontHeight := 13.0
-	scaleFactor := float64(size) / baseFontHeight
+		drawer.Dot = fixed.Point26_6{
+			X: x,
+			Y: metrics.Ascent + lineAdvance*fixed.Int26_6(i),
+		}
+		drawer.DrawString(line.text)
+	}
 
-	if scaleFactor != 1.0 {
-		scaledWidth := int(float64(textWidth) * scaleFactor)
-		scaledHeight := int(float64(textHeight) * scaleFactor)
+	// Add stroke, shadow and background plate if requested
+	if style.hasEffects() {
+		return applyTextEffects(textImg, style)
+	}
 
-		if scaledWidth <= 0 {
-			scaledWidth = 1
-		}
-		if scaledHeight <= 0 {
-			scaledHeight = 1
+	return textImg, nil
+}
+
+// layoutLines splits text on newlines and greedily wraps each paragraph
+// at word boundaries so no line exceeds maxWidth (0 disables wrapping).
+// Words wider than maxWidth are kept on a line of their own.
+func layoutLines(face font.Face, text string, maxWidth fixed.Int26_6) []textLine {
+	var lines []textLine
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if maxWidth <= 0 || len(words) == 0 {
+			lines = append(lines, measureLine(face, paragraph))
+			continue
 		}
 
-		// Create scaled image
-		scaled := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
-
-		// Scale using nearest neighbor
-		for y := 0; y < scaledHeight; y++ {
-			for x := 0; x < scaledWidth; x++ {
-				srcX := int(float64(x) / scaleFactor)
-				srcY := int(float64(y) / scaleFactor)
-				if srcX >= textWidth {
-					srcX = textWidth - 1
-				}
-				if srcY >= textHeight {
-					srcY = textHeight - 1
-				}
-				c := textImg.At(srcX, srcY)
-				scaled.Set(x, y, c)
+		current := words[0]
+		for _, word := range words[1:] {
+			candidate := current + " " + word
+			if measured := measureLine(face, candidate); measured.right-measured.left <= maxWidth {
+				current = candidate
+				continue
 			}
+			lines = append(lines, measureLine(face, current))
+			current = word
 		}
-
-		return scaled, nil
+		lines = append(lines, measureLine(face, current))
 	}
 
-	return textImg, nil
+	return lines
+}
+
+// measureLine measures a single line, including any glyph overhang on the left
+func measureLine(face font.Face, text string) textLine {
+	bounds, advance := font.BoundString(face, text)
+	return textLine{
+		text:  text,
+		left:  min(bounds.Min.X, 0),
+		right: max(bounds.Max.X, advance),
+	}
 }
 
 // ParseHexColor parses a hex color string (e.g., "#FFFFFF" or "FFFFFF")
-// and returns a color.Color
+// with an optional alpha component (e.g., "#00000080") and returns a color.Color
 func ParseHexColor(hex string) (color.Color, error) {
 	// Remove the "#" prefix if present
 	hex = strings.TrimPrefix(hex, "#")
 
 	// Validate length
-	if len(hex) != 6 {
-		return nil, fmt.Errorf("invalid hex color format: %s (expected format: #RRGGBB)", hex)
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid hex color format: %s (expected format: #RRGGBB or #RRGGBBAA)", hex)
 	}
 
 	// Parse red component
@@ -116,6 +196,15 @@ func ParseHexColor(hex string) (color.Color, error) {
 		return nil, fmt.Errorf("invalid blue component in hex color: %w", err)
 	}
 
+	// Parse optional alpha component
+	if len(hex) == 8 {
+		a, err := strconv.ParseUint(hex[6:8], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alpha component in hex color: %w", err)
+		}
+		return color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: uint8(a)}, nil
+	}
+
 	return color.RGBA{
 		R: uint8(r),
 		G: uint8(g),
@@ -0,0 +1,35 @@
+package watermark
+
+import (
+	"image"
+	"image/draw"
+)
+
+// drawTiled repeats a watermark across the whole destination image
+// Tiles are laid out on a grid with the given gap between them, and every
+// other row is shifted by half a tile to produce a staggered pattern.
+func drawTiled(dst draw.Image, wm image.Image, spacing int, mode BlendMode) {
+	bounds := dst.Bounds()
+	wmWidth := wm.Bounds().Dx()
+	wmHeight := wm.Bounds().Dy()
+
+	stepX := wmWidth + spacing
+	stepY := wmHeight + spacing
+	if stepX <= 0 || stepY <= 0 {
+		return
+	}
+
+	// Start one step before the edges so partially visible tiles are drawn
+	row := 0
+	for y := bounds.Min.Y - stepY/2; y < bounds.Max.Y; y += stepY {
+		offset := 0
+		if row%2 == 1 {
+			offset = stepX / 2
+		}
+		for x := bounds.Min.X - stepX + offset; x < bounds.Max.X; x += stepX {
+			tileRect := image.Rect(x, y, x+wmWidth, y+wmHeight)
+			composite(dst, tileRect, wm, mode)
+		}
+		row++
+	}
+}
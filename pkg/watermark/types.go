@@ -3,6 +3,7 @@ package watermark
 import (
 	"errors"
 	"fmt"
+	"math"
 )
 
 // Position represents the placement position of a watermark on the base image
@@ -19,27 +20,90 @@ const (
 	PositionBottomLeft   Position = "bottom-left"
 	PositionBottomCenter Position = "bottom-center"
 	PositionBottomRight  Position = "bottom-right"
+
+	// PositionTile repeats the watermark across the whole image
+	PositionTile Position = "tile"
+
+	// PositionAuto picks the least busy of the candidate anchor positions
+	PositionAuto Position = "auto"
+)
+
+// Point is a normalized location on the base image, where (0,0) is the
+// top-left corner and (1,1) is the bottom-right corner
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// TextAlign represents the horizontal alignment of lines in a text watermark
+type TextAlign string
+
+// TextAlign constants for multi-line text watermarks
+const (
+	TextAlignLeft   TextAlign = "left"
+	TextAlignCenter TextAlign = "center"
+	TextAlignRight  TextAlign = "right"
 )
 
 // Config contains all configuration parameters for watermarking
 type Config struct {
 	// Type selection (one must be set)
-	Text  string // Text to use as watermark
-	Image string // Path to image file to use as watermark
+	Text  string `json:"text"`  // Text to use as watermark
+	Image string `json:"image"` // Path to image file to use as watermark
 
 	// Position and spacing
-	Position Position // Position of watermark on image
-	Margin   int      // Margin from edge in pixels
+	Position Position `json:"position"` // Position of watermark on image
+	Point    *Point   `json:"point"`    // Normalized centre of the watermark (overrides Position when set)
+	Margin   int      `json:"margin"`   // Margin from edge in pixels
+
+	// Contrast-aware options
+	AutoPositions []Position `json:"auto_positions"` // Candidates for PositionAuto (empty uses DefaultAutoPositions)
+	AutoContrast  bool       `json:"auto_contrast"`  // Use black or white text, or invert a monochrome logo, to contrast with the background
+
+	// Relative sizing, as a percentage (0-100) of the base image's shorter side
+	MarginPercent   float64 `json:"margin_percent"`    // Overrides Margin when positive
+	TextSizePercent float64 `json:"text_size_percent"` // Overrides TextSize when positive
+
+	// Tile mode options (used when Position is PositionTile)
+	TileSpacing int     `json:"tile_spacing"` // Gap between repeated watermarks in pixels
+	TileAngle   float64 `json:"tile_angle"`   // Counter-clockwise rotation of each tile in degrees, added to Rotation
 
 	// Opacity (0.0 = fully transparent, 1.0 = fully opaque)
-	Opacity float64
+	Opacity float64 `json:"opacity"`
+
+	// How the watermark is combined with the base image (empty is normal)
+	BlendMode BlendMode `json:"blend_mode"`
+
+	// Counter-clockwise rotation in degrees, applied before positioning
+	Rotation float64 `json:"rotation"`
+
+	// Resampling kernel used when scaling image watermarks and rotating any
+	// watermark (empty uses DefaultResample)
+	Resample Resample `json:"resample"`
 
 	// Text-specific options
-	TextSize  int    // Font size in pixels
-	TextColor string // Hex color string (e.g., "#FFFFFF")
+	TextSize  int    `json:"text_size"`  // Font size in pixels
+	TextColor string `json:"text_color"` // Hex color string (e.g., "#FFFFFF")
+	Font      string `json:"font"`       // Path to a TTF/OTF font file (empty uses the bundled Go Regular font)
+
+	// Multi-line text options ("\n" starts a new line)
+	TextAlign       TextAlign `json:"text_align"`   // Alignment of lines within the text block (empty is left)
+	TextLineSpacing float64   `json:"line_spacing"` // Line height multiplier (0 uses the font's natural line height)
+	TextMaxWidth    float64   `json:"max_width"`    // Wrap lines wider than this fraction of the base image width (0 disables wrapping)
+
+	// Text styling options
+	TextStrokeWidth       int    `json:"stroke_width"`       // Outline width in pixels (0 disables the outline)
+	TextStrokeColor       string `json:"stroke_color"`       // Outline hex color
+	TextShadowColor       string `json:"shadow_color"`       // Drop shadow hex color, optionally with alpha (empty disables the shadow)
+	TextShadowOffsetX     int    `json:"shadow_x"`           // Drop shadow horizontal offset in pixels
+	TextShadowOffsetY     int    `json:"shadow_y"`           // Drop shadow vertical offset in pixels
+	TextShadowBlur        int    `json:"shadow_blur"`        // Drop shadow blur radius in pixels
+	TextBackgroundColor   string `json:"background"`         // Background plate hex color, optionally with alpha (empty disables the plate)
+	TextBackgroundPadding int    `json:"background_padding"` // Background plate padding in pixels
+	TextBackgroundRadius  int    `json:"background_radius"`  // Background plate corner radius in pixels
 
 	// Image-specific options
-	Scale float64 // Scale factor (0.1-1.0, as percentage of base image width)
+	Scale float64 `json:"scale"` // Scale factor (0.1-1.0, as percentage of base image width)
 }
 
 // Validation errors
@@ -51,8 +115,19 @@ var (
 	ErrInvalidScale      = errors.New("scale must be between 0.1 and 1.0")
 	ErrInvalidTextSize   = errors.New("text size must be positive")
 	ErrInvalidMargin     = errors.New("margin must be non-negative")
+	ErrInvalidSpacing    = errors.New("tile spacing must be non-negative")
+	ErrInvalidRotation   = errors.New("rotation must be a finite number of degrees")
+	ErrInvalidPoint      = errors.New("invalid watermark point")
+	ErrInvalidPercent    = errors.New("percentage must be between 0 and 100")
+	ErrInvalidResample   = errors.New("invalid resample kernel")
+	ErrInvalidBlendMode  = errors.New("invalid blend mode")
+	ErrInvalidTextAlign  = errors.New("invalid text alignment")
+	ErrInvalidLineSpace  = errors.New("line spacing must be non-negative")
+	ErrInvalidMaxWidth   = errors.New("text max width must be between 0.0 and 1.0")
+	ErrInvalidTextStyle  = errors.New("invalid text style")
 	ErrEmptyImage        = errors.New("base image is empty")
 	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrUnsupportedFont   = errors.New("unsupported font format")
 )
 
 // Validate checks if the configuration is valid
@@ -66,22 +141,23 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate position
-	validPositions := []Position{
-		PositionTopLeft, PositionTopCenter, PositionTopRight,
-		PositionLeftCenter, PositionCenter, PositionRightCenter,
-		PositionBottomLeft, PositionBottomCenter, PositionBottomRight,
-	}
-	positionValid := false
-	for _, validPos := range validPositions {
-		if c.Position == validPos {
-			positionValid = true
-			break
+	positionValid := c.Position == PositionTile || c.Position == PositionAuto || isAnchor(c.Position)
+	if c.Point != nil {
+		// Normalized coordinates replace the anchor position
+		if c.Point.X < 0.0 || c.Point.X > 1.0 || c.Point.Y < 0.0 || c.Point.Y > 1.0 {
+			return fmt.Errorf("%w: x=%f, y=%f (coordinates must be between 0.0 and 1.0)", ErrInvalidPoint, c.Point.X, c.Point.Y)
 		}
-	}
-	if !positionValid {
+	} else if !positionValid {
 		return fmt.Errorf("%w: %s", ErrInvalidPosition, c.Position)
 	}
 
+	// Validate auto position candidates
+	for _, pos := range c.AutoPositions {
+		if !isAnchor(pos) {
+			return fmt.Errorf("%w: %s (auto positions must be anchors)", ErrInvalidPosition, pos)
+		}
+	}
+
 	// Validate opacity
 	if c.Opacity < 0.0 || c.Opacity > 1.0 {
 		return fmt.Errorf("%w: %f", ErrInvalidOpacity, c.Opacity)
@@ -102,9 +178,133 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("%w: %d", ErrInvalidMargin, c.Margin)
 	}
 
+	// Validate relative sizes
+	if c.MarginPercent < 0 || c.MarginPercent > 100 {
+		return fmt.Errorf("%w: margin %f", ErrInvalidPercent, c.MarginPercent)
+	}
+	if c.TextSizePercent < 0 || c.TextSizePercent > 100 {
+		return fmt.Errorf("%w: text size %f", ErrInvalidPercent, c.TextSizePercent)
+	}
+
+	// Validate rotation angles
+	for _, angle := range []float64{c.Rotation, c.TileAngle} {
+		if math.IsNaN(angle) || math.IsInf(angle, 0) {
+			return fmt.Errorf("%w: %f", ErrInvalidRotation, angle)
+		}
+	}
+
+	// Validate tile spacing
+	if c.TileSpacing < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidSpacing, c.TileSpacing)
+	}
+
+	// Validate multi-line text options
+	switch c.TextAlign {
+	case "", TextAlignLeft, TextAlignCenter, TextAlignRight:
+	default:
+		return fmt.Errorf("%w: %s (expected left, center or right)", ErrInvalidTextAlign, c.TextAlign)
+	}
+	if c.TextLineSpacing < 0 {
+		return fmt.Errorf("%w: %f", ErrInvalidLineSpace, c.TextLineSpacing)
+	}
+	if c.TextMaxWidth < 0.0 || c.TextMaxWidth > 1.0 {
+		return fmt.Errorf("%w: %f", ErrInvalidMaxWidth, c.TextMaxWidth)
+	}
+
+	// Validate text styling options
+	if err := c.validateTextStyle(); err != nil {
+		return err
+	}
+
+	// Validate blend mode
+	if !c.BlendMode.IsValid() {
+		return fmt.Errorf("%w: %s (expected normal, multiply, screen, overlay or soft-light)", ErrInvalidBlendMode, c.BlendMode)
+	}
+
+	// Validate resample kernel
+	if !c.Resample.IsValid() {
+		return fmt.Errorf("%w: %s (expected nearest, bilinear, catmull-rom or lanczos)", ErrInvalidResample, c.Resample)
+	}
+
 	return nil
 }
 
+// isAnchor returns true if the position is one of the nine single-placement anchors
+func isAnchor(pos Position) bool {
+	anchors := []Position{
+		PositionTopLeft, PositionTopCenter, PositionTopRight,
+		PositionLeftCenter, PositionCenter, PositionRightCenter,
+		PositionBottomLeft, PositionBottomCenter, PositionBottomRight,
+	}
+	for _, anchor := range anchors {
+		if pos == anchor {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTextStyle checks the stroke, shadow and background plate options
+func (c *Config) validateTextStyle() error {
+	if c.TextStrokeWidth < 0 {
+		return fmt.Errorf("%w: stroke width must be non-negative: %d", ErrInvalidTextStyle, c.TextStrokeWidth)
+	}
+	if c.TextShadowBlur < 0 {
+		return fmt.Errorf("%w: shadow blur must be non-negative: %d", ErrInvalidTextStyle, c.TextShadowBlur)
+	}
+	if c.TextBackgroundPadding < 0 {
+		return fmt.Errorf("%w: background padding must be non-negative: %d", ErrInvalidTextStyle, c.TextBackgroundPadding)
+	}
+	if c.TextBackgroundRadius < 0 {
+		return fmt.Errorf("%w: background radius must be non-negative: %d", ErrInvalidTextStyle, c.TextBackgroundRadius)
+	}
+
+	// Validate colors of enabled effects
+	if c.TextStrokeWidth > 0 {
+		if _, err := ParseHexColor(c.TextStrokeColor); err != nil {
+			return fmt.Errorf("%w: stroke color: %v", ErrInvalidTextStyle, err)
+		}
+	}
+	if c.TextShadowColor != "" {
+		if _, err := ParseHexColor(c.TextShadowColor); err != nil {
+			return fmt.Errorf("%w: shadow color: %v", ErrInvalidTextStyle, err)
+		}
+	}
+	if c.TextBackgroundColor != "" {
+		if _, err := ParseHexColor(c.TextBackgroundColor); err != nil {
+			return fmt.Errorf("%w: background color: %v", ErrInvalidTextStyle, err)
+		}
+	}
+
+	return nil
+}
+
+// IsTiled returns true if the watermark repeats across the whole image
+func (c *Config) IsTiled() bool {
+	return c.Point == nil && c.Position == PositionTile
+}
+
+// ResolveMargin returns the margin in pixels for a base image of the given size
+func (c *Config) ResolveMargin(baseWidth, baseHeight int) int {
+	if c.MarginPercent > 0 {
+		return percentOfShorterSide(c.MarginPercent, baseWidth, baseHeight)
+	}
+	return c.Margin
+}
+
+// ResolveTextSize returns the font size in pixels for a base image of the given size
+func (c *Config) ResolveTextSize(baseWidth, baseHeight int) int {
+	if c.TextSizePercent > 0 {
+		return max(percentOfShorterSide(c.TextSizePercent, baseWidth, baseHeight), 1)
+	}
+	return c.TextSize
+}
+
+// percentOfShorterSide converts a percentage of the shorter image side to pixels
+func percentOfShorterSide(percent float64, width, height int) int {
+	return int(math.Round(float64(min(width, height)) * percent / 100))
+}
+
 // IsTextWatermark returns true if this is a text watermark configuration
 func (c *Config) IsTextWatermark() bool {
 	return c.Text != ""
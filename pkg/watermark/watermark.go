@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
+
+	"github.com/Parthipan-Natkunam/generate_image/pkg/metadata"
 )
 
 // Apply applies a watermark to a base image and returns the watermarked image bytes
@@ -16,66 +18,210 @@ import (
 //   - watermarked image bytes in the same format as input
 //   - error if watermarking fails
 func Apply(baseImageData []byte, cfg Config) ([]byte, error) {
-	// Validate configuration
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid watermark configuration: %w", err)
+	return ApplyLayers(baseImageData, []Config{cfg})
+}
+
+// ApplyLayers applies several watermarks to a base image in order, so later
+// layers are drawn on top of earlier ones
+//
+// Parameters:
+//   - baseImageData: the original image bytes (PNG or JPEG)
+//   - layers: watermark configurations, applied first to last
+//
+// Returns:
+//   - watermarked image bytes in the same format as input, with the input's
+//     ICC profile, EXIF and other metadata chunks carried over
+//   - error if watermarking fails
+func ApplyLayers(baseImageData []byte, layers []Config) ([]byte, error) {
+	resultImg, format, err := applyLayers(baseImageData, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the result back to the original format
+	resultData, err := encodeImage(resultImg, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode watermarked image: %w", err)
+	}
+
+	// Carry over the color profile and metadata the encoder dropped
+	resultData, err = metadata.Preserve(baseImageData, resultData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preserve image metadata: %w", err)
+	}
+
+	return resultData, nil
+}
+
+// ApplyLayersImage applies several watermarks like ApplyLayers, but returns
+// the watermarked pixels without encoding them, so the caller encodes the
+// image once in its output format and quality
+//
+// Parameters:
+//   - baseImageData: the original image bytes (PNG or JPEG)
+//   - layers: watermark configurations, applied first to last
+//
+// Returns:
+//   - the watermarked image, in the stored orientation of the input
+//   - error if watermarking fails
+func ApplyLayersImage(baseImageData []byte, layers []Config) (image.Image, error) {
+	resultImg, _, err := applyLayers(baseImageData, layers)
+	return resultImg, err
+}
+
+// applyLayers decodes the base image and draws every layer onto it
+func applyLayers(baseImageData []byte, layers []Config) (image.Image, string, error) {
+	if len(layers) == 0 {
+		return nil, "", ErrNoWatermark
+	}
+
+	// Validate every layer before doing any work
+	for i := range layers {
+		if err := layers[i].Validate(); err != nil {
+			return nil, "", layerError(i, len(layers), fmt.Errorf("invalid watermark configuration: %w", err))
+		}
 	}
 
 	// Validate base image is not empty
 	if len(baseImageData) == 0 {
-		return nil, ErrEmptyImage
+		return nil, "", ErrEmptyImage
 	}
 
 	// Decode the base image
 	baseImg, format, err := decodeImage(baseImageData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode base image: %w", err)
+		return nil, "", fmt.Errorf("failed to decode base image: %w", err)
 	}
 
-	// Create or load the watermark image
-	var watermarkImg image.Image
-	if cfg.IsTextWatermark() {
-		// Render text watermark
-		watermarkImg, err = RenderText(cfg.Text, cfg.TextSize, cfg.TextColor)
-		if err != nil {
-			return nil, fmt.Errorf("failed to render text watermark: %w", err)
-		}
-	} else if cfg.IsImageWatermark() {
-		// Load image watermark
-		watermarkImg, err = LoadWatermarkImage(cfg.Image)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load image watermark: %w", err)
+	// Draw in display orientation, so positions match what viewers show
+	orientation := metadata.Orientation(baseImageData)
+	resultImg := newCanvas(baseImg, orientation)
+
+	for i, cfg := range layers {
+		if err := applyLayer(resultImg, cfg); err != nil {
+			return nil, "", layerError(i, len(layers), err)
 		}
+	}
 
-		// Scale the watermark
-		baseWidth := baseImg.Bounds().Dx()
-		watermarkImg = ScaleImage(watermarkImg, cfg.Scale, baseWidth)
+	return restoreOrientation(resultImg, orientation), format, nil
+}
+
+// layerError prefixes an error with the layer number when there are several layers
+func layerError(index, count int, err error) error {
+	if count == 1 {
+		return err
 	}
+	return fmt.Errorf("watermark layer %d: %w", index+1, err)
+}
 
-	// Apply opacity to the watermark
-	watermarkImg = ApplyOpacity(watermarkImg, cfg.Opacity)
+// applyLayer renders a single watermark and composites it onto the result image
+func applyLayer(resultImg draw.Image, cfg Config) error {
+	baseWidth := resultImg.Bounds().Dx()
+	baseHeight := resultImg.Bounds().Dy()
 
-	// Calculate watermark position
-	baseWidth := baseImg.Bounds().Dx()
-	baseHeight := baseImg.Bounds().Dy()
-	wmWidth := watermarkImg.Bounds().Dx()
-	wmHeight := watermarkImg.Bounds().Dy()
+	// Create or load the watermark image
+	rawImg, err := renderWatermark(cfg, baseWidth, baseHeight)
+	if err != nil {
+		return err
+	}
+	watermarkImg := prepareWatermark(rawImg, cfg)
+
+	// Work out where the watermark goes
+	var region image.Rectangle
+	if cfg.IsTiled() {
+		region = resultImg.Bounds()
+	} else {
+		wmWidth := watermarkImg.Bounds().Dx()
+		wmHeight := watermarkImg.Bounds().Dy()
+		margin := cfg.ResolveMargin(baseWidth, baseHeight)
 
-	x, y := CalculatePosition(baseWidth, baseHeight, wmWidth, wmHeight, cfg.Position, cfg.Margin)
+		var x, y int
+		switch {
+		case cfg.Point != nil:
+			x, y = CalculatePointPosition(baseWidth, baseHeight, wmWidth, wmHeight, *cfg.Point)
+		case cfg.Position == PositionAuto:
+			pos := chooseAutoPosition(resultImg, wmWidth, wmHeight, margin, cfg.AutoPositions)
+			x, y = CalculatePosition(baseWidth, baseHeight, wmWidth, wmHeight, pos, margin)
+		default:
+			x, y = CalculatePosition(baseWidth, baseHeight, wmWidth, wmHeight, cfg.Position, margin)
+		}
+		region = image.Rect(x, y, x+wmWidth, y+wmHeight)
+	}
 
-	// Create a new image for the result (copy of base)
-	resultImg := image.NewRGBA(baseImg.Bounds())
-	draw.Draw(resultImg, resultImg.Bounds(), baseImg, image.Point{}, draw.Src)
+	// Pick a contrasting text color or invert a monochrome logo
+	if cfg.AutoContrast {
+		backgroundLuminance, _ := regionStats(resultImg, region)
+		if cfg.IsTextWatermark() {
+			cfg.TextColor = contrastTextColor(backgroundLuminance)
+			rawImg, err = renderWatermark(cfg, baseWidth, baseHeight)
+			if err != nil {
+				return err
+			}
+		} else {
+			rawImg = adjustLogoContrast(rawImg, backgroundLuminance)
+		}
+		watermarkImg = prepareWatermark(rawImg, cfg)
+	}
+
+	if cfg.IsTiled() {
+		// Repeat the watermark across the whole image
+		drawTiled(resultImg, watermarkImg, cfg.TileSpacing, cfg.BlendMode)
+		return nil
+	}
 
 	// Composite the watermark onto the base image
-	wmRect := image.Rect(x, y, x+wmWidth, y+wmHeight)
-	draw.Draw(resultImg, wmRect, watermarkImg, image.Point{}, draw.Over)
+	composite(resultImg, region, watermarkImg, cfg.BlendMode)
 
-	// Encode the result back to the original format
-	resultData, err := encodeImage(resultImg, format)
+	return nil
+}
+
+// renderWatermark renders a text watermark or loads and scales an image watermark
+func renderWatermark(cfg Config, baseWidth, baseHeight int) (image.Image, error) {
+	if cfg.IsTextWatermark() {
+		// Render text watermark
+		img, err := RenderText(cfg.Text, TextStyle{
+			Size:        cfg.ResolveTextSize(baseWidth, baseHeight),
+			Color:       cfg.TextColor,
+			Font:        cfg.Font,
+			Align:       cfg.TextAlign,
+			LineSpacing: cfg.TextLineSpacing,
+			MaxWidth:    int(float64(baseWidth) * cfg.TextMaxWidth),
+
+			StrokeWidth:       cfg.TextStrokeWidth,
+			StrokeColor:       cfg.TextStrokeColor,
+			ShadowColor:       cfg.TextShadowColor,
+			ShadowOffsetX:     cfg.TextShadowOffsetX,
+			ShadowOffsetY:     cfg.TextShadowOffsetY,
+			ShadowBlur:        cfg.TextShadowBlur,
+			BackgroundColor:   cfg.TextBackgroundColor,
+			BackgroundPadding: cfg.TextBackgroundPadding,
+			BackgroundRadius:  cfg.TextBackgroundRadius,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render text watermark: %w", err)
+		}
+		return img, nil
+	}
+
+	// Load image watermark
+	img, err := LoadWatermarkImage(cfg.Image)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode watermarked image: %w", err)
+		return nil, fmt.Errorf("failed to load image watermark: %w", err)
 	}
 
-	return resultData, nil
+	// Scale the watermark
+	return ScaleImageWith(img, cfg.Scale, baseWidth, cfg.Resample), nil
+}
+
+// prepareWatermark applies opacity and rotation to a rendered watermark
+func prepareWatermark(img image.Image, cfg Config) image.Image {
+	// Apply opacity to the watermark
+	img = ApplyOpacity(img, cfg.Opacity)
+
+	// Rotate the watermark; its bounds grow to fit the rotated content
+	rotation := cfg.Rotation
+	if cfg.IsTiled() {
+		rotation += cfg.TileAngle
+	}
+	return RotateImage(img, rotation, cfg.Resample)
 }
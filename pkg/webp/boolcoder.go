@@ -0,0 +1,75 @@
+package webp
+
+// boolEncoder is the boolean entropy encoder of RFC 6386 section 7.3, which
+// codes each bit with the probability that it is zero, out of 256
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32 // Range of the coder, between 128 and 255 between bits
+	bottom   uint32 // Low end of the range, with unwritten bits at the top
+	bitCount int    // Bits to shift before the next byte is written
+}
+
+// uniformProb codes a bit with equal probability of zero and one
+const uniformProb = 128
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// putBit codes a bit that is zero with probability prob/256
+func (e *boolEncoder) putBit(bit bool, prob uint8) {
+	split := 1 + ((e.rng-1)*uint32(prob))>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// carry propagates a carry into the bytes already written
+func (e *boolEncoder) carry() {
+	i := len(e.buf) - 1
+	for ; i >= 0 && e.buf[i] == 0xff; i-- {
+		e.buf[i] = 0
+	}
+	if i >= 0 {
+		e.buf[i]++
+	}
+}
+
+// putUint codes an n-bit unsigned value, most significant bit first
+func (e *boolEncoder) putUint(v uint32, n int, prob uint8) {
+	for n > 0 {
+		n--
+		e.putBit(v&(1<<n) != 0, prob)
+	}
+}
+
+// putFlag codes a flag with uniform probability
+func (e *boolEncoder) putFlag(flag bool) {
+	e.putBit(flag, uniformProb)
+}
+
+// finish flushes the coder and returns the coded bytes
+// The padding lets a decoder read ahead past the last bit.
+func (e *boolEncoder) finish() []byte {
+	for i := 0; i < 32; i++ {
+		e.putBit(false, uniformProb)
+	}
+	return e.buf
+}
@@ -0,0 +1,119 @@
+package webp
+
+// The inverse transforms match the decoder's bit for bit, since predictions
+// are made from the reconstructed pixels a decoder sees. The forward
+// transforms only need to invert them closely.
+
+// Inverse DCT multipliers: 65536 * cos(pi/8) * sqrt(2) and sin(pi/8) * sqrt(2)
+const (
+	idctC1 = 85627
+	idctC2 = 35468
+)
+
+// dctBasis holds the 1-D inverse DCT as a matrix: an inverse transform of
+// coefficients c is dctBasis * c * dctBasis^T / 8
+var dctBasis = [4][4]float64{
+	{1, idctC1 / 65536.0, 1, idctC2 / 65536.0},
+	{1, idctC2 / 65536.0, -1, -idctC1 / 65536.0},
+	{1, -idctC2 / 65536.0, -1, idctC1 / 65536.0},
+	{1, -idctC1 / 65536.0, 1, -idctC2 / 65536.0},
+}
+
+// whtBasis holds the 1-D inverse Walsh-Hadamard transform the same way
+var whtBasis = [4][4]float64{
+	{1, 1, 1, 1},
+	{1, 1, -1, -1},
+	{1, -1, -1, 1},
+	{1, -1, 1, -1},
+}
+
+// forward4 inverts a transform whose basis has orthogonal columns of norm 2:
+// for in = basis * out * basis^T / 8, out = basis^T * in * basis / 2
+// Both blocks are in raster order.
+func forward4(basis *[4][4]float64, in *[16]float64, out *[16]float64) {
+	var tmp [16]float64
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += in[r*4+k] * basis[k][c]
+			}
+			tmp[r*4+c] = sum
+		}
+	}
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += basis[k][r] * tmp[k*4+c]
+			}
+			out[r*4+c] = sum / 2
+		}
+	}
+}
+
+// inverseDCT adds the inverse DCT of coeff to the 4x4 block at dst
+func inverseDCT(coeff *[16]int32, dst []uint8, stride int) {
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := coeff[i] + coeff[8+i]
+		b := coeff[i] - coeff[8+i]
+		c := (coeff[4+i]*idctC2)>>16 - (coeff[12+i]*idctC1)>>16
+		d := (coeff[4+i]*idctC1)>>16 + (coeff[12+i]*idctC2)>>16
+		m[i][0] = a + d
+		m[i][1] = b + c
+		m[i][2] = b - c
+		m[i][3] = a - d
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*idctC2)>>16 - (m[3][j]*idctC1)>>16
+		d := (m[1][j]*idctC1)>>16 + (m[3][j]*idctC2)>>16
+		row := dst[j*stride : j*stride+4]
+		row[0] = clip8(int32(row[0]) + (a+d)>>3)
+		row[1] = clip8(int32(row[1]) + (b+c)>>3)
+		row[2] = clip8(int32(row[2]) + (b-c)>>3)
+		row[3] = clip8(int32(row[3]) + (a-d)>>3)
+	}
+}
+
+// inverseWHT returns the DC coefficients of the 16 luma blocks, in raster
+// order, from the coefficients of a macroblock's Y2 block
+func inverseWHT(coeff *[16]int32) [16]int32 {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := coeff[i] + coeff[12+i]
+		a1 := coeff[4+i] + coeff[8+i]
+		a2 := coeff[4+i] - coeff[8+i]
+		a3 := coeff[i] - coeff[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	var out [16]int32
+	for i := 0; i < 4; i++ {
+		dc := m[i*4] + 3
+		a0 := dc + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := dc - m[3+i*4]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+func clip8(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
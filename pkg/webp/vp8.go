@@ -0,0 +1,623 @@
+package webp
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Intra prediction modes of 16x16 luma and 8x8 chroma blocks
+const (
+	predDC = iota
+	predVE // Vertical: each column repeats the pixel above
+	predHE // Horizontal: each row repeats the pixel to the left
+	predTM // TrueMotion: above + left - above-left
+)
+
+// maxLevel is the largest quantized coefficient the token set can code
+const maxLevel = 2048
+
+// quantizer holds the DC and AC step sizes of each plane
+type quantizer struct {
+	y1, y2, uv [2]int32
+}
+
+// newQuantizer returns the step sizes of a quantizer index, as a decoder
+// derives them in RFC 6386 section 9.6
+func newQuantizer(index int) quantizer {
+	var q quantizer
+	q.y1 = [2]int32{int32(dequantTableDC[index]), int32(dequantTableAC[index])}
+	q.y2 = [2]int32{int32(dequantTableDC[index]) * 2, int32(dequantTableAC[index]) * 155 / 100}
+	if q.y2[1] < 8 {
+		q.y2[1] = 8
+	}
+	q.uv = [2]int32{int32(dequantTableDC[min(index, 117)]), int32(dequantTableAC[index])}
+	return q
+}
+
+// nzContext records which 4x4 blocks along a macroblock edge had non-zero
+// coefficients, which selects the token probabilities of their neighbours
+type nzContext struct {
+	y  [4]uint8
+	u  [2]uint8
+	v  [2]uint8
+	y2 uint8
+}
+
+// macroblock is the header of a coded macroblock
+type macroblock struct {
+	yMode, uvMode uint8
+	skip          bool // No non-zero coefficients
+}
+
+// vp8Encoder encodes a key frame
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	quantIndex    int
+	quant         quantizer
+	filterLevel   int
+
+	// Source and reconstructed planes, padded to whole macroblocks
+	y, u, v    []uint8
+	ry, ru, rv []uint8
+	yStride    int
+	cStride    int
+
+	mbs        []macroblock
+	partitions []*boolEncoder
+	upNz       []nzContext
+	leftNz     nzContext
+}
+
+// quantizerIndex maps a quality of 1-99 to a quantizer index, 127 to 0
+func quantizerIndex(quality int) int {
+	q := float64(100-quality) / 100
+	return int(math.Round(127 * math.Pow(q, 1.25)))
+}
+
+// encodeVP8 encodes an image as a VP8 key frame
+func encodeVP8(img image.Image, quality int) []byte {
+	bounds := img.Bounds()
+	e := &vp8Encoder{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		mbw:    (bounds.Dx() + 15) / 16,
+		mbh:    (bounds.Dy() + 15) / 16,
+	}
+	e.quantIndex = quantizerIndex(quality)
+	e.quant = newQuantizer(e.quantIndex)
+	// Smooth block edges in proportion to the quantization step
+	e.filterLevel = min(63, e.quantIndex/2)
+
+	e.importPixels(img)
+	e.mbs = make([]macroblock, e.mbw*e.mbh)
+	e.upNz = make([]nzContext, e.mbw)
+
+	// Large images split their coefficients over several partitions, which
+	// keeps each within the decoder's limits
+	nPartitions := 1
+	for nPartitions < 8 && e.mbw*e.mbh/nPartitions > 16384 {
+		nPartitions *= 2
+	}
+	e.partitions = make([]*boolEncoder, nPartitions)
+	for i := range e.partitions {
+		e.partitions[i] = newBoolEncoder()
+	}
+
+	for mby := 0; mby < e.mbh; mby++ {
+		e.leftNz = nzContext{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	return e.frame()
+}
+
+// importPixels converts the image to BT.601 limited-range YCbCr 4:2:0,
+// as libwebp does, repeating the edge pixels to fill whole macroblocks
+func (e *vp8Encoder) importPixels(img image.Image) {
+	bounds := img.Bounds()
+	e.yStride, e.cStride = e.mbw*16, e.mbw*8
+	e.y = make([]uint8, e.yStride*e.mbh*16)
+	e.u = make([]uint8, e.cStride*e.mbh*8)
+	e.v = make([]uint8, e.cStride*e.mbh*8)
+	e.ry = make([]uint8, len(e.y))
+	e.ru = make([]uint8, len(e.u))
+	e.rv = make([]uint8, len(e.v))
+
+	rgb := make([][3]float64, e.yStride*e.mbh*16)
+	for y := 0; y < e.mbh*16; y++ {
+		sy := bounds.Min.Y + min(y, e.height-1)
+		for x := 0; x < e.yStride; x++ {
+			sx := bounds.Min.X + min(x, e.width-1)
+			c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+			r, g, b := float64(c.R), float64(c.G), float64(c.B)
+			rgb[y*e.yStride+x] = [3]float64{r, g, b}
+			e.y[y*e.yStride+x] = clampRound(16 + 0.256788*r + 0.504129*g + 0.097906*b)
+		}
+	}
+	for y := 0; y < e.mbh*8; y++ {
+		for x := 0; x < e.cStride; x++ {
+			var r, g, b float64
+			for _, i := range [4]int{0, 1, e.yStride, e.yStride + 1} {
+				p := rgb[2*y*e.yStride+2*x+i]
+				r, g, b = r+p[0], g+p[1], b+p[2]
+			}
+			r, g, b = r/4, g/4, b/4
+			e.u[y*e.cStride+x] = clampRound(128 - 0.148223*r - 0.290993*g + 0.439216*b)
+			e.v[y*e.cStride+x] = clampRound(128 + 0.439216*r - 0.367788*g - 0.071427*b)
+		}
+	}
+}
+
+func clampRound(v float64) uint8 {
+	return uint8(max(0, min(255, math.Round(v))))
+}
+
+// encodeMacroblock predicts, transforms and quantizes one macroblock, writes
+// its coefficients and reconstructs it as a decoder will
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	mb := &e.mbs[mby*e.mbw+mbx]
+
+	// Luma
+	yOff := mby*16*e.yStride + mbx*16
+	var yPred [256]uint8
+	mb.yMode = e.bestMode(mbx, mby, 16, [][]uint8{e.y}, [][]uint8{e.ry}, e.yStride, [][]uint8{yPred[:]}, yOff)
+
+	var yLevels [16][16]int32 // Quantized AC coefficients of each 4x4 block
+	var dcs [16]float64
+	var coeffs [16][16]float64
+	for b := 0; b < 16; b++ {
+		bx, by := (b%4)*4, (b/4)*4
+		var residual [16]float64
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				src := e.y[yOff+(by+j)*e.yStride+bx+i]
+				residual[j*4+i] = float64(src) - float64(yPred[(by+j)*16+bx+i])
+			}
+		}
+		forward4(&dctBasis, &residual, &coeffs[b])
+		dcs[b] = coeffs[b][0]
+		for k := 1; k < 16; k++ {
+			yLevels[b][k] = quantize(coeffs[b][k], e.quant.y1[1], acBias)
+		}
+	}
+	var y2Coeffs [16]float64
+	forward4(&whtBasis, &dcs, &y2Coeffs)
+	var y2Levels [16]int32
+	for k := 0; k < 16; k++ {
+		y2Levels[k] = quantize(y2Coeffs[k], e.quant.y2[min(k, 1)], dcBias)
+	}
+
+	// Chroma, with one mode shared by both planes
+	cOff := mby*8*e.cStride + mbx*8
+	var uPred, vPred [64]uint8
+	mb.uvMode = e.bestMode(mbx, mby, 8, [][]uint8{e.u, e.v}, [][]uint8{e.ru, e.rv}, e.cStride, [][]uint8{uPred[:], vPred[:]}, cOff)
+	uLevels := e.quantizeChroma(e.u, uPred[:], cOff)
+	vLevels := e.quantizeChroma(e.v, vPred[:], cOff)
+
+	mb.skip = allZero(y2Levels[:]) && allZero(flatten(yLevels[:])) &&
+		allZero(flatten(uLevels[:])) && allZero(flatten(vLevels[:]))
+
+	// Reconstruct the luma: the DC of each block comes from the Y2 block
+	var y2Deq [16]int32
+	for k := 0; k < 16; k++ {
+		y2Deq[k] = y2Levels[k] * e.quant.y2[min(k, 1)]
+	}
+	yDC := inverseWHT(&y2Deq)
+	for j := 0; j < 16; j++ {
+		copy(e.ry[yOff+j*e.yStride:yOff+j*e.yStride+16], yPred[j*16:j*16+16])
+	}
+	for b := 0; b < 16; b++ {
+		var deq [16]int32
+		deq[0] = yDC[b]
+		for k := 1; k < 16; k++ {
+			deq[k] = yLevels[b][k] * e.quant.y1[1]
+		}
+		inverseDCT(&deq, e.ry[yOff+(b/4)*4*e.yStride+(b%4)*4:], e.yStride)
+	}
+	e.reconstructChroma(e.ru, uPred[:], &uLevels, cOff)
+	e.reconstructChroma(e.rv, vPred[:], &vLevels, cOff)
+
+	// Write the coefficients, unless the macroblock has none
+	up, left := &e.upNz[mbx], &e.leftNz
+	if mb.skip {
+		*up, *left = nzContext{}, nzContext{}
+		return
+	}
+	tokens := e.partitions[mby%len(e.partitions)]
+
+	nz := putCoefficients(tokens, planeY2, up.y2+left.y2, &y2Levels, 0)
+	up.y2, left.y2 = nz, nz
+	for by := 0; by < 4; by++ {
+		nz := left.y[by]
+		for bx := 0; bx < 4; bx++ {
+			nz = putCoefficients(tokens, planeY1WithY2, nz+up.y[bx], &yLevels[by*4+bx], 1)
+			up.y[bx] = nz
+		}
+		left.y[by] = nz
+	}
+	putChroma(tokens, &uLevels, &up.u, &left.u)
+	putChroma(tokens, &vLevels, &up.v, &left.v)
+}
+
+// Quantization rounding: coefficients round to the nearest level, except
+// that AC coefficients round towards zero a little more, which saves bits
+// on detail too faint to matter
+const (
+	dcBias = 0.5
+	acBias = 0.38
+)
+
+// quantize returns the quantized level of a coefficient
+func quantize(coeff float64, step int32, bias float64) int32 {
+	level := int32(math.Abs(coeff)/float64(step) + bias)
+	level = min(level, maxLevel)
+	if coeff < 0 {
+		return -level
+	}
+	return level
+}
+
+// quantizeChroma transforms and quantizes the four 4x4 blocks of an 8x8
+// chroma block
+func (e *vp8Encoder) quantizeChroma(src, pred []uint8, off int) [4][16]int32 {
+	var levels [4][16]int32
+	for b := 0; b < 4; b++ {
+		bx, by := (b%2)*4, (b/2)*4
+		var residual, coeffs [16]float64
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				residual[j*4+i] = float64(src[off+(by+j)*e.cStride+bx+i]) - float64(pred[(by+j)*8+bx+i])
+			}
+		}
+		forward4(&dctBasis, &residual, &coeffs)
+		levels[b][0] = quantize(coeffs[0], e.quant.uv[0], dcBias)
+		for k := 1; k < 16; k++ {
+			levels[b][k] = quantize(coeffs[k], e.quant.uv[1], acBias)
+		}
+	}
+	return levels
+}
+
+// reconstructChroma writes the prediction plus the dequantized residual of
+// an 8x8 chroma block
+func (e *vp8Encoder) reconstructChroma(dst, pred []uint8, levels *[4][16]int32, off int) {
+	for j := 0; j < 8; j++ {
+		copy(dst[off+j*e.cStride:off+j*e.cStride+8], pred[j*8:j*8+8])
+	}
+	for b := 0; b < 4; b++ {
+		var deq [16]int32
+		for k := 0; k < 16; k++ {
+			deq[k] = levels[b][k] * e.quant.uv[min(k, 1)]
+		}
+		inverseDCT(&deq, dst[off+(b/2)*4*e.cStride+(b%2)*4:], e.cStride)
+	}
+}
+
+// putChroma writes the coefficients of an 8x8 chroma block
+func putChroma(tokens *boolEncoder, levels *[4][16]int32, up, left *[2]uint8) {
+	for by := 0; by < 2; by++ {
+		nz := left[by]
+		for bx := 0; bx < 2; bx++ {
+			nz = putCoefficients(tokens, planeUV, nz+up[bx], &levels[by*2+bx], 0)
+			up[bx] = nz
+		}
+		left[by] = nz
+	}
+}
+
+// bestMode predicts a block with each mode its neighbours allow and returns
+// the one closest to the source, leaving its prediction in preds
+// Modes that need the row above or the column to the left are only tried
+// where the macroblock has them.
+func (e *vp8Encoder) bestMode(mbx, mby, size int, srcs, recons [][]uint8, stride int, preds [][]uint8, off int) uint8 {
+	modes := []uint8{predDC}
+	if mby > 0 {
+		modes = append(modes, predVE)
+	}
+	if mbx > 0 {
+		modes = append(modes, predHE)
+	}
+	if mbx > 0 && mby > 0 {
+		modes = append(modes, predTM)
+	}
+
+	best, bestCost := uint8(predDC), -1
+	candidate := make([]uint8, size*size)
+	for _, mode := range modes {
+		cost := 0
+		for p := range srcs {
+			predict(candidate, recons[p], off, stride, size, mode, mbx, mby)
+			for j := 0; j < size; j++ {
+				for i := 0; i < size; i++ {
+					d := int(srcs[p][off+j*stride+i]) - int(candidate[j*size+i])
+					cost += d * d
+				}
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+		}
+	}
+
+	for p := range srcs {
+		predict(preds[p], recons[p], off, stride, size, best, mbx, mby)
+	}
+	return best
+}
+
+// predict fills a size x size prediction from the reconstructed pixels
+// above and to the left of the block at off, as RFC 6386 section 12.2 does
+func predict(dst, recon []uint8, off, stride, size int, mode uint8, mbx, mby int) {
+	above := func(i int) int32 { return int32(recon[off-stride+i]) }
+	left := func(j int) int32 { return int32(recon[off+j*stride-1]) }
+
+	switch mode {
+	case predVE:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				dst[j*size+i] = uint8(above(i))
+			}
+		}
+	case predHE:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				dst[j*size+i] = uint8(left(j))
+			}
+		}
+	case predTM:
+		corner := int32(recon[off-stride-1])
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				dst[j*size+i] = clip8(left(j) + above(i) - corner)
+			}
+		}
+	default:
+		// The DC mode averages the edges the macroblock has, or is mid-grey
+		// in the top-left macroblock
+		var sum, n int32
+		if mby > 0 {
+			for i := 0; i < size; i++ {
+				sum += above(i)
+			}
+			n += int32(size)
+		}
+		if mbx > 0 {
+			for j := 0; j < size; j++ {
+				sum += left(j)
+			}
+			n += int32(size)
+		}
+		avg := uint8(0x80)
+		if n > 0 {
+			avg = uint8((sum + n/2) / n)
+		}
+		for i := range dst[:size*size] {
+			dst[i] = avg
+		}
+	}
+}
+
+// putCoefficients writes the tokens of a 4x4 block's quantized levels,
+// given in raster order, starting at scan position first, and returns 1 if
+// any were non-zero, as RFC 6386 section 13 codes them
+func putCoefficients(e *boolEncoder, plane int, context uint8, levels *[16]int32, first int) uint8 {
+	probs := &defaultTokenProb[plane]
+
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[zigzag[n]] != 0 {
+			last = n
+		}
+	}
+
+	p := &probs[bands[first]][context]
+	if last < 0 {
+		e.putBit(false, p[0]) // End of block
+		return 0
+	}
+	e.putBit(true, p[0])
+
+	for n := first; n < 16; {
+		level := levels[zigzag[n]]
+		n++
+		if level == 0 {
+			e.putBit(false, p[1])
+			p = &probs[bands[n]][0]
+			continue
+		}
+		e.putBit(true, p[1])
+
+		v := level
+		if v < 0 {
+			v = -v
+		}
+		if v == 1 {
+			e.putBit(false, p[2])
+			e.putFlag(level < 0)
+			p = &probs[bands[n]][1]
+		} else {
+			e.putBit(true, p[2])
+			putLevel(e, p, v)
+			e.putFlag(level < 0)
+			p = &probs[bands[n]][2]
+		}
+
+		if n == 16 {
+			break
+		}
+		e.putBit(n <= last, p[0]) // Whether more tokens follow
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
+
+// putLevel writes a level of 2 or more, after its first two token bits
+func putLevel(e *boolEncoder, p *[nProb]uint8, v int32) {
+	switch {
+	case v <= 4:
+		e.putBit(false, p[3])
+		if v == 2 {
+			e.putBit(false, p[4])
+		} else {
+			e.putBit(true, p[4])
+			e.putBit(v == 4, p[5])
+		}
+	case v <= 10:
+		e.putBit(true, p[3])
+		e.putBit(false, p[6])
+		if v <= 6 {
+			e.putBit(false, p[7])
+			e.putBit(v == 6, 159) // Category 1
+		} else {
+			e.putBit(true, p[7])
+			e.putBit((v-7)&2 != 0, 165) // Category 2
+			e.putBit((v-7)&1 != 0, 145)
+		}
+	default:
+		e.putBit(true, p[3])
+		e.putBit(true, p[6])
+		cat := 0 // Categories 3 to 6 cover 11-18, 19-34, 35-66 and 67-2114
+		for cat < 3 && v >= 3+(8<<(cat+1)) {
+			cat++
+		}
+		e.putBit(cat >= 2, p[8])
+		e.putBit(cat&1 != 0, p[9+cat/2])
+		extra := uint32(v - 3 - (8 << cat))
+		bits := cat3456[cat]
+		for i, prob := range bits {
+			e.putBit(extra&(1<<(len(bits)-1-i)) != 0, prob)
+		}
+	}
+}
+
+// frame assembles the frame header, the first partition with the headers
+// of every macroblock, and the coefficient partitions
+func (e *vp8Encoder) frame() []byte {
+	skipped := 0
+	for _, mb := range e.mbs {
+		if mb.skip {
+			skipped++
+		}
+	}
+
+	fp := newBoolEncoder()
+	fp.putFlag(false) // Color space
+	fp.putFlag(false) // Clamping type
+	fp.putFlag(false) // No segmentation
+	fp.putFlag(false) // Normal loop filter
+	fp.putUint(uint32(e.filterLevel), 6, uniformProb)
+	fp.putUint(0, 3, uniformProb) // Sharpness
+	fp.putFlag(false)             // No loop filter adjustments
+	log2Partitions := 0
+	for 1<<log2Partitions < len(e.partitions) {
+		log2Partitions++
+	}
+	fp.putUint(uint32(log2Partitions), 2, uniformProb)
+	fp.putUint(uint32(e.quantIndex), 7, uniformProb)
+	for i := 0; i < 5; i++ {
+		fp.putFlag(false) // No quantizer deltas
+	}
+	fp.putFlag(false) // Refresh entropy probabilities
+	for i := range tokenProbUpdateProb {
+		for j := range tokenProbUpdateProb[i] {
+			for k := range tokenProbUpdateProb[i][j] {
+				for l := range tokenProbUpdateProb[i][j][k] {
+					fp.putBit(false, tokenProbUpdateProb[i][j][k][l])
+				}
+			}
+		}
+	}
+
+	// Skip flags pay for themselves when some macroblocks have no
+	// coefficients
+	useSkip := skipped > 0
+	var skipProb uint8
+	fp.putFlag(useSkip)
+	if useSkip {
+		skipProb = uint8(max(1, min(255, (len(e.mbs)-skipped)*256/len(e.mbs))))
+		fp.putUint(uint32(skipProb), 8, uniformProb)
+	}
+
+	for _, mb := range e.mbs {
+		if useSkip {
+			fp.putBit(mb.skip, skipProb)
+		}
+		fp.putBit(true, 145) // 16x16 luma prediction
+		switch mb.yMode {
+		case predDC:
+			fp.putBit(false, 156)
+			fp.putBit(false, 163)
+		case predVE:
+			fp.putBit(false, 156)
+			fp.putBit(true, 163)
+		case predHE:
+			fp.putBit(true, 156)
+			fp.putBit(false, 128)
+		case predTM:
+			fp.putBit(true, 156)
+			fp.putBit(true, 128)
+		}
+		switch mb.uvMode {
+		case predDC:
+			fp.putBit(false, 142)
+		case predVE:
+			fp.putBit(true, 142)
+			fp.putBit(false, 114)
+		case predHE:
+			fp.putBit(true, 142)
+			fp.putBit(true, 114)
+			fp.putBit(false, 183)
+		case predTM:
+			fp.putBit(true, 142)
+			fp.putBit(true, 114)
+			fp.putBit(true, 183)
+		}
+	}
+	first := fp.finish()
+
+	var out []byte
+	tag := uint32(len(first))<<5 | 1<<4 // Key frame, version 0, shown
+	out = append(out, byte(tag), byte(tag>>8), byte(tag>>16))
+	out = append(out, 0x9d, 0x01, 0x2a)
+	out = binary.LittleEndian.AppendUint16(out, uint16(e.width))
+	out = binary.LittleEndian.AppendUint16(out, uint16(e.height))
+	out = append(out, first...)
+
+	// The sizes of all but the last coefficient partition precede them
+	parts := make([][]byte, len(e.partitions))
+	for i, p := range e.partitions {
+		parts[i] = p.finish()
+	}
+	for _, part := range parts[:len(parts)-1] {
+		size := len(part)
+		out = append(out, byte(size), byte(size>>8), byte(size>>16))
+	}
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func allZero(levels []int32) bool {
+	for _, l := range levels {
+		if l != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func flatten[T any](blocks [][16]T) []T {
+	out := make([]T, 0, len(blocks)*16)
+	for _, b := range blocks {
+		out = append(out, b[:]...)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package webp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// photo returns a deterministic image with smooth gradients, hard edges and
+// fine noise, like a photograph
+func photo(width, height int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			noise := rng.Intn(9) - 4
+			r := 40 + 160*x/max(1, width) + noise
+			g := 60 + 140*y/max(1, height) + noise
+			b := 120 + noise
+			if (x-width/2)*(x-width/2)+(y-height/2)*(y-height/2) < width*height/16 {
+				r, g, b = 230+noise, 200+noise, 40+noise
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), 255})
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal-to-noise ratio of b against a, in dB
+func psnr(t *testing.T, a, b image.Image) float64 {
+	t.Helper()
+	if a.Bounds().Size() != b.Bounds().Size() {
+		t.Fatalf("size = %v, want %v", b.Bounds().Size(), a.Bounds().Size())
+	}
+	var sum float64
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			for _, d := range [3]float64{
+				float64(r1>>8) - float64(r2>>8),
+				float64(g1>>8) - float64(g2>>8),
+				float64(b1>>8) - float64(b2>>8),
+			} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(3*ab.Dx()*ab.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func encode(t *testing.T, img image.Image, opts *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, opts); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return img
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	// Sizes that are not whole macroblocks exercise the edge padding; the
+	// large image is split over several coefficient partitions. Chroma is
+	// stored at half resolution, which limits the fidelity of the disc's
+	// edge in the smallest images.
+	sizes := []image.Point{{1, 1}, {16, 16}, {17, 33}, {203, 117}, {2100, 2100}}
+	for _, size := range sizes {
+		src := photo(size.X, size.Y)
+		data := encode(t, src, nil)
+		if string(data[12:16]) != "VP8 " {
+			t.Errorf("%v: first chunk = %q, want a lossy VP8 chunk", size, data[12:16])
+		}
+		if got := psnr(t, src, decode(t, data)); got < 22 {
+			t.Errorf("%v: PSNR = %.1f dB, want at least 22", size, got)
+		}
+	}
+}
+
+func TestQuality(t *testing.T) {
+	src := photo(256, 192)
+	var lastSize int
+	var lastPSNR float64
+	for _, quality := range []int{10, 50, 80, 95} {
+		data := encode(t, src, &Options{Quality: quality})
+		got := psnr(t, src, decode(t, data))
+		if quality > 10 && (len(data) <= lastSize || got <= lastPSNR) {
+			t.Errorf("quality %d: %d bytes at %.1f dB, not larger and better than %d bytes at %.1f dB",
+				quality, len(data), got, lastSize, lastPSNR)
+		}
+		if quality == DefaultQuality && got < 32 {
+			t.Errorf("quality %d: PSNR = %.1f dB, want at least 32", quality, got)
+		}
+		lastSize, lastPSNR = len(data), got
+	}
+}
+
+func TestSmallerThanLossless(t *testing.T) {
+	src := photo(256, 192)
+	var lossless bytes.Buffer
+	if err := nativewebp.Encode(&lossless, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if lossy := encode(t, src, nil); len(lossy)*3 > lossless.Len() {
+		t.Errorf("lossy = %d bytes, want under a third of lossless (%d bytes)", len(lossy), lossless.Len())
+	}
+}
+
+func TestLargeCoefficients(t *testing.T) {
+	// Black and white stripes at a fine quantizer need the longest tokens
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(0)
+			if (x/3+y/5)%2 == 0 {
+				v = 255
+			}
+			src.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	if got := psnr(t, src, decode(t, encode(t, src, &Options{Quality: 99}))); got < 35 {
+		t.Errorf("PSNR = %.1f dB, want at least 35", got)
+	}
+}
+
+func TestFlatColours(t *testing.T) {
+	// A decoder must get the colours back with libwebp's conversion
+	for _, c := range []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {200, 30, 30, 255}, {30, 64, 175, 255}} {
+		src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		for i := 0; i < len(src.Pix); i += 4 {
+			src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		r, g, b, _ := decode(t, encode(t, src, nil)).At(20, 20).RGBA()
+		got := [3]int{int(r >> 8), int(g >> 8), int(b >> 8)}
+		want := [3]int{int(c.R), int(c.G), int(c.B)}
+		for i := range got {
+			if d := got[i] - want[i]; d < -3 || d > 3 {
+				t.Errorf("%v decoded as %v", want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestAlpha(t *testing.T) {
+	src := photo(40, 24)
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			src.Pix[src.PixOffset(x, y)+3] = uint8(x * 6)
+		}
+	}
+	data := encode(t, src, nil)
+	if string(data[12:16]) != "VP8X" {
+		t.Fatalf("first chunk = %q, want VP8X", data[12:16])
+	}
+
+	got := decode(t, data)
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			if _, _, _, a := got.At(x, y).RGBA(); a>>8 != uint32(x*6) {
+				t.Fatalf("alpha at (%d, %d) = %d, want %d", x, y, a>>8, x*6)
+			}
+		}
+	}
+}
+
+func TestLossless(t *testing.T) {
+	src := photo(40, 24)
+	data := encode(t, src, &Options{Quality: 100})
+	if string(data[12:16]) != "VP8L" {
+		t.Fatalf("first chunk = %q, want VP8L", data[12:16])
+	}
+	if got := psnr(t, src, decode(t, data)); !math.IsInf(got, 1) {
+		t.Errorf("PSNR = %.1f dB, want an exact copy", got)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, photo(8, 8), &Options{Quality: 101}); !errors.Is(err, ErrInvalidQuality) {
+		t.Errorf("quality 101: err = %v, want ErrInvalidQuality", err)
+	}
+	if err := Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 0, 0)), nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: err = %v, want ErrEmptyImage", err)
+	}
+	if err := Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 16384, 1)), nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("16384 wide: err = %v, want ErrTooLarge", err)
+	}
+}